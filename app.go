@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"runtime"
@@ -20,8 +21,9 @@ import (
 )
 
 const (
-	Success = "success"
-	Failed  = "failed"
+	Success   = "success"
+	Failed    = "failed"
+	Cancelled = "cancelled"
 )
 
 type Config struct {
@@ -29,6 +31,10 @@ type Config struct {
 	GaharaDir string `json:"gaharadir"`
 	//ProjectDir: the project directory for a video editing project
 	ProjectDir string `json:"projectdir,omitempty"`
+	// AutosaveInterval: the interval in seconds at which the timeline is autosaved (negative disables autosave)
+	AutosaveInterval int `json:"autosave_interval,omitempty"`
+	// ExportConcurrency: the number of exports of a batch that run at the same time (0 uses the number of CPUs)
+	ExportConcurrency int `json:"export_concurrency,omitempty"`
 }
 
 // App struct
@@ -41,38 +47,73 @@ type App struct {
 	Timeline video.Timeline `json:"timeline"`
 	// FFmpegPath: the configured ffmpeg on build
 	FFmpegPath string
+	// FFprobePath: the configured ffprobe on build, extracted next to ffmpeg
+	FFprobePath string
+	// timelineLock: guards the timeline, it is edited by the bound methods while the autosave and the exports read it
+	timelineLock sync.Mutex
+	// configLock: guards the settings of the configuration changed while the app runs
+	configLock sync.Mutex
+	// saveLock: serializes the writes of the timeline (save, autosave, recovery)
+	saveLock sync.Mutex
+	// lastSaved: the timeline document last written or loaded, autosave skips unchanged timelines
+	lastSaved []byte
+	// presets: the export presets, built-in and saved by the user
+	presets *video.PresetRegistry
+	// presetsLock: guards the export presets, they are changed and saved by the bound methods
+	presetsLock sync.Mutex
+	// executor: runs the ffmpeg and ffprobe commands
+	executor Executor
+	// notifier: sends the events and logs to the frontend, set on startup
+	notifier Notifier
+	// jobs: the FFmpeg queries that are running
+	jobs *JobRegistry
+	// historyLock: serializes the writes of the job history of the project
+	historyLock sync.Mutex
+	// previewLock: serializes the renders of the preview, they share its cache
+	previewLock sync.Mutex
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{Timeline: video.NewTimeline()}
+	return &App{Timeline: video.NewTimeline(), presets: video.NewPresetRegistry(), executor: &execExecutor{}, jobs: NewJobRegistry(context.Background())}
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.notifier = &wailsNotifier{ctx: ctx}
 	err := a.gaharaSetup()
 	if err != nil {
 		wruntime.LogFatal(a.ctx, err.Error())
 	}
+	a.loadPresets()
 	FFmpegPath, err := ExtractFFmpeg()
 	if err != nil {
 		wruntime.LogFatal(a.ctx, fmt.Sprintf("could not initialize FFmpeg: %s", err.Error()))
 	}
 	a.FFmpegPath = FFmpegPath
-	wruntime.LogInfo(a.ctx, fmt.Sprintf("initialized FFmpeg at %s", a.FFmpegPath))
+	a.FFprobePath = filepath.Join(filepath.Dir(FFmpegPath), "ffprobe")
+	a.notifier.LogInfo(fmt.Sprintf("initialized FFmpeg at %s", a.FFmpegPath))
+
+	go a.autosaveLoop(ctx)
 }
 
 func (a *App) cleanup(ctx context.Context) {
-	_, cancel := context.WithTimeout(ctx, 5*time.Second)
+	// ffmpeg does not outlive the app, the running queries are cancelled and remove their partial outputs. ffmpeg
+	// is killed once the grace period is over, so the wait is bounded
+	a.jobs.CancelAll()
+	ctx, cancel := context.WithTimeout(ctx, CANCEL_GRACE_PERIOD+time.Second)
 	defer cancel()
+	if err := a.jobs.Wait(ctx); err != nil {
+		a.notifier.LogError("the running queries did not end before the cleanup of FFmpeg")
+	}
 
 	err := os.RemoveAll(filepath.Dir(a.FFmpegPath))
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not cleanup FFmpeg")
+		a.notifier.LogError("could not cleanup FFmpeg")
 	}
-	wruntime.LogInfo(a.ctx, "FFmpeg was cleaned")
+	a.notifier.LogInfo("FFmpeg was cleaned")
 }
 
 // FilePicker: opens the native file picker for the user
@@ -90,7 +131,7 @@ func (a *App) FilePicker() error {
 
 	filepath, err := wruntime.OpenFileDialog(a.ctx, openDialogOpts)
 	if err != nil {
-		wruntime.LogError(a.ctx, err.Error())
+		a.notifier.LogError(err.Error())
 		return err
 	}
 
@@ -123,7 +164,7 @@ func (a *App) OpenFile(filepath string) error {
 func (a *App) createWorkspace() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		wruntime.LogFatal(a.ctx, "user home directory does not exists, cannot create workspace for Gahara")
+		a.notifier.LogError("user home directory does not exists, cannot create workspace for Gahara")
 		return "", fmt.Errorf("user home directory does not exists, cannot create workspace for Gahara")
 	}
 
@@ -133,12 +174,12 @@ func (a *App) createWorkspace() (string, error) {
 	// check if the gahara directory does not exists
 	if os.IsNotExist(err) {
 		if err := os.MkdirAll(gaharaDir, os.ModePerm); err != nil {
-			wruntime.LogError(a.ctx, err.Error())
+			a.notifier.LogError(err.Error())
 			return "", err
 		}
-		wruntime.LogInfo(a.ctx, "Gahara workspace has been created!")
+		a.notifier.LogInfo("Gahara workspace has been created!")
 	} else if err != nil {
-		wruntime.LogError(a.ctx, "could not create gahara workspace")
+		a.notifier.LogError("could not create gahara workspace")
 		return "", err
 	}
 	return gaharaDir, nil
@@ -152,41 +193,50 @@ func (a *App) CreateProjectWorkspace(projectName string) (string, error) {
 	file, err := os.Stat(projectDir)
 	if os.IsNotExist(err) {
 		if err := os.MkdirAll(projectDir, os.ModePerm); err != nil {
-			wruntime.LogError(a.ctx, err.Error())
+			a.notifier.LogError(err.Error())
 			return Failed, err
 		}
-		wruntime.LogInfo(a.ctx, fmt.Sprintf("project %s workspace has been created", projectName))
+		a.notifier.LogInfo(fmt.Sprintf("project %s workspace has been created", projectName))
 	} else if err != nil {
-		wruntime.LogError(a.ctx, fmt.Sprintf("could not create the %s workspace\n", projectName))
+		a.notifier.LogError(fmt.Sprintf("could not create the %s workspace\n", projectName))
 		return Failed, err
 	}
 
 	if file != nil {
-		wruntime.LogError(a.ctx, fmt.Sprintf("project name (%s) already exists in gahara workspace", projectName))
+		a.notifier.LogError(fmt.Sprintf("project name (%s) already exists in gahara workspace", projectName))
 		return Failed, fmt.Errorf("project name (%s) already exists in gahara workspace", projectName)
 	}
 
+	a.saveLock.Lock()
 	a.config.ProjectDir = projectDir
+	a.lastSaved = nil
+	a.saveLock.Unlock()
 	return Success, nil
 }
 
-// SetProjectDirectory: sets the project directory (used with loading projects)
-func (a *App) SetProjectDirectory(projectDir string) {
+// SetProjectDirectory: sets the project directory (used with loading projects), an autosave newer than the
+// saved timeline is reported so it can be recovered
+func (a *App) SetProjectDirectory(projectDir string) AutosaveRecovery {
+	a.saveLock.Lock()
+	defer a.saveLock.Unlock()
+
 	a.config.ProjectDir = path.Join(a.config.GaharaDir, projectDir)
+	a.lastSaved = nil
+	return a.checkAutosave()
 }
 
 // ReadGaharaWorkspace: retrieve all the project workspaces
 func (a *App) ReadGaharaWorkspace() ([]string, error) {
 	gaharaDir, err := os.Open(a.config.GaharaDir)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the gahara workspace")
+		a.notifier.LogError("could not read the gahara workspace")
 		return nil, err
 	}
 	defer gaharaDir.Close()
 
 	projects, err := gaharaDir.Readdir(0)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not retrieve projects in the gahara workspace")
+		a.notifier.LogError("could not retrieve projects in the gahara workspace")
 		return nil, err
 	}
 
@@ -198,11 +248,11 @@ func (a *App) ReadGaharaWorkspace() ([]string, error) {
 	}
 
 	if len(projectsDirectories) <= 0 {
-		wruntime.LogError(a.ctx, "Gahara workspace exists, but no project workspace was found")
+		a.notifier.LogError("Gahara workspace exists, but no project workspace was found")
 		return nil, fmt.Errorf("gahara workspace exists, but no project workspace was found")
 	}
 
-	wruntime.LogInfo(a.ctx, "project directories loaded successfully")
+	a.notifier.LogInfo("project directories loaded successfully")
 	return projectsDirectories, nil
 }
 
@@ -210,14 +260,14 @@ func (a *App) ReadGaharaWorkspace() ([]string, error) {
 func (a *App) ReadProjectWorkspace() ([]Video, error) {
 	projectDir, err := os.Open(a.config.ProjectDir)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the gahara workspace")
+		a.notifier.LogError("could not read the gahara workspace")
 		return nil, err
 	}
 	defer projectDir.Close()
 
 	files, err := projectDir.Readdir(0)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not retrieve projects in the gahara workspace")
+		a.notifier.LogError("could not retrieve projects in the gahara workspace")
 		return nil, err
 	}
 
@@ -228,25 +278,25 @@ func (a *App) ReadProjectWorkspace() ([]Video, error) {
 				continue
 			}
 
-			duration, err := getVideoDuration(a.FFmpegPath, video.ProcessingOpts{
-				Filename:    strings.Split(project.Name(), ".")[0],
-				VideoFormat: filepath.Ext(project.Name()),
-				InputPath:   a.config.ProjectDir,
-			})
+			info, err := a.probeMedia(path.Join(a.config.ProjectDir, project.Name()))
 			if err != nil {
-				wruntime.LogError(a.ctx, fmt.Sprintf("could not check video duration: %s", err.Error()))
+				a.notifier.LogError(fmt.Sprintf("could not check video duration: %s", err.Error()))
 				continue
 			}
-			projectFiles = append(projectFiles, Video{Name: strings.Split(project.Name(), ".")[0], Extension: filepath.Ext(project.Name()), FilePath: a.config.ProjectDir, Duration: duration})
+			if !info.HasVideo() {
+				a.notifier.LogError(fmt.Sprintf("%s has no video stream", project.Name()))
+				continue
+			}
+			projectFiles = append(projectFiles, Video{Name: strings.Split(project.Name(), ".")[0], Extension: filepath.Ext(project.Name()), FilePath: a.config.ProjectDir, Duration: info.Duration()})
 		}
 	}
 
 	if len(projectFiles) <= 0 {
-		wruntime.LogError(a.ctx, "Project workspace exists, but no files were found")
+		a.notifier.LogError("Project workspace exists, but no files were found")
 		return nil, fmt.Errorf("project workspace exists, but no files were found")
 	}
 
-	wruntime.LogInfo(a.ctx, "project files loaded successfully")
+	a.notifier.LogInfo("project files loaded successfully")
 	return projectFiles, nil
 }
 
@@ -291,7 +341,7 @@ func (a *App) SetDefaultAppMenu() {
 func (a *App) EnableExportMenus() {
 	exportMenu := menu.NewMenu()
 	exportMenu.AddText("Back to Project", keys.Shift("b"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_ROUTE, "video")
+		a.notifier.EventsEmit(video.EVT_CHANGE_ROUTE, "video")
 	})
 
 	appMenu := a.AppMenu()
@@ -307,92 +357,108 @@ func (a *App) EnableExportMenus() {
 func (a *App) EnableVideoMenus() {
 	timelineMenu := menu.NewMenu()
 	timelineMenu.AddText("Open File", keys.CmdOrCtrl("o"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_UPLOAD_FILE)
+		a.notifier.EventsEmit(video.EVT_UPLOAD_FILE)
 	})
 
 	timelineMenu.AddText("Play Track", keys.Shift("space"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_PLAY_TRACK)
+		a.notifier.EventsEmit(video.EVT_PLAY_TRACK)
 	})
 	timelineMenu.AddText("Save Timeline", keys.CmdOrCtrl("s"), func(cd *menu.CallbackData) {
 		err := a.SaveTimeline()
 		if err != nil {
-			wruntime.LogError(a.ctx, "could not save timeline")
+			a.notifier.LogError("could not save timeline")
 		}
-		wruntime.EventsEmit(a.ctx, video.EVT_SAVED_TIMELINE, "-- SAVED --")
+		a.notifier.EventsEmit(video.EVT_SAVED_TIMELINE, "-- SAVED --")
 	})
-	timelineMenu.AddText("Rename Clip", keys.CmdOrCtrl("r"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_OPEN_RENAME_CLIP_MODAL)
+	timelineMenu.AddText("Rename Clip", keys.Key("f2"), func(cd *menu.CallbackData) {
+		a.notifier.EventsEmit(video.EVT_OPEN_RENAME_CLIP_MODAL)
 	})
 	timelineMenu.AddText("Mark/Unmark Clip (Lossless Export)", keys.Key("m"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TOGGLE_LOSSLESS)
+		a.notifier.EventsEmit(video.EVT_TOGGLE_LOSSLESS)
 	})
 	timelineMenu.AddText("Mark All Clips (Lossless Export)", keys.Shift("m"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_MARK_ALL_LOSSLESS)
+		a.notifier.EventsEmit(video.EVT_MARK_ALL_LOSSLESS)
 	})
 	timelineMenu.AddText("Unmark All Clips (Lossless Export)", keys.Shift("u"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_UNMARK_ALL_LOSSLESS)
+		a.notifier.EventsEmit(video.EVT_UNMARK_ALL_LOSSLESS)
 	})
 
 	timelineMenu.AddText("Change Project", keys.Shift("b"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_ROUTE, "main")
+		a.notifier.EventsEmit(video.EVT_CHANGE_ROUTE, "main")
 	})
 
 	timelineMenu.AddText("Export Project", keys.Shift("e"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_ROUTE, "export")
+		a.notifier.EventsEmit(video.EVT_CHANGE_ROUTE, "export")
 	})
 	timelineMenu.AddText("Toggle Vim Mode", keys.CmdOrCtrl("i"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TOGGLE_VIM_MODE)
-		wruntime.EventsEmit(a.ctx, video.EVT_TRACK_MOVE, 0)
+		a.notifier.EventsEmit(video.EVT_TOGGLE_VIM_MODE)
+		a.notifier.EventsEmit(video.EVT_TRACK_MOVE, 0)
 	})
 	vimCommandsMenu := timelineMenu.AddSubmenu("Vim Commands")
 	vimCommandsMenu.AddText("Normal Mode", keys.Key("i"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_VIM_MODE, "select")
+		a.notifier.EventsEmit(video.EVT_CHANGE_VIM_MODE, "select")
 	})
 	vimCommandsMenu.AddText("Delete Mode", keys.Key("d"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_VIM_MODE, "remove")
+		a.notifier.EventsEmit(video.EVT_CHANGE_VIM_MODE, "remove")
 	})
 	vimCommandsMenu.AddText("Timeline Mode", keys.Key("t"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_CHANGE_VIM_MODE, "timeline")
+		a.notifier.EventsEmit(video.EVT_CHANGE_VIM_MODE, "timeline")
 	})
 	vimCommandsMenu.AddText("Split clip", keys.Key("x"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_SPLITCLIP_EDIT)
+		a.notifier.EventsEmit(video.EVT_SPLITCLIP_EDIT)
 	})
 	vimCommandsMenu.AddText("Yank clip", keys.Key("y"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_YANK_CLIP)
+		a.notifier.EventsEmit(video.EVT_YANK_CLIP)
 	})
 	vimCommandsMenu.AddText("Paste clip", keys.Key("p"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_INSERTCLIP_EDIT)
+		a.notifier.EventsEmit(video.EVT_INSERTCLIP_EDIT)
 	})
 	vimCommandsMenu.AddText("Execute Edit", keys.Key("enter"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_EXECUTE_EDIT)
+		a.notifier.EventsEmit(video.EVT_EXECUTE_EDIT)
 	})
 	vimCommandsMenu.AddText("Move Track Left", keys.Key("h"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TRACK_MOVE, -1)
+		a.notifier.EventsEmit(video.EVT_TRACK_MOVE, -1)
 	})
 	vimCommandsMenu.AddText("Move Track Right", keys.Key("l"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TRACK_MOVE, 1)
+		a.notifier.EventsEmit(video.EVT_TRACK_MOVE, 1)
 	})
 	vimCommandsMenu.AddText("Move to Beginning of Track", keys.Key("0"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TRACK_MOVE, -len(a.Timeline.VideoNodes))
+		a.notifier.EventsEmit(video.EVT_TRACK_MOVE, -len(a.GetTimeline().VideoNodes))
 	})
 	vimCommandsMenu.AddText("Move to End of Track", keys.Key("$"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_TRACK_MOVE, len(a.Timeline.VideoNodes))
+		a.notifier.EventsEmit(video.EVT_TRACK_MOVE, len(a.GetTimeline().VideoNodes))
 	})
 	vimCommandsMenu.AddText("Zoom In Timeline", keys.Shift("+"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_ZOOM_TIMELINE, "in")
+		a.notifier.EventsEmit(video.EVT_ZOOM_TIMELINE, "in")
 	})
 	vimCommandsMenu.AddText("Zoom Out Timeline", keys.Shift("-"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_ZOOM_TIMELINE, "out")
+		a.notifier.EventsEmit(video.EVT_ZOOM_TIMELINE, "out")
 	})
 	vimCommandsMenu.AddText("Save Timeline", keys.Shift("w"), func(cd *menu.CallbackData) {
 		err := a.SaveTimeline()
 		if err != nil {
-			wruntime.LogError(a.ctx, "could not save timeline")
+			a.notifier.LogError("could not save timeline")
 		}
-		wruntime.EventsEmit(a.ctx, video.EVT_SAVED_TIMELINE, "-- SAVED --")
+		a.notifier.EventsEmit(video.EVT_SAVED_TIMELINE, "-- SAVED --")
 	})
 	vimCommandsMenu.AddText("Open Search List", keys.Key("/"), func(cd *menu.CallbackData) {
-		wruntime.EventsEmit(a.ctx, video.EVT_OPEN_SEARCH_LIST)
+		a.notifier.EventsEmit(video.EVT_OPEN_SEARCH_LIST)
+	})
+	vimCommandsMenu.AddText("Undo", keys.Key("u"), func(cd *menu.CallbackData) {
+		timeline, err := a.Undo()
+		if err != nil {
+			a.notifier.LogInfo(err.Error())
+			return
+		}
+		a.notifier.EventsEmit(video.EVT_TIMELINE_CHANGED, timeline)
+	})
+	vimCommandsMenu.AddText("Redo", keys.Control("r"), func(cd *menu.CallbackData) {
+		timeline, err := a.Redo()
+		if err != nil {
+			a.notifier.LogInfo(err.Error())
+			return
+		}
+		a.notifier.EventsEmit(video.EVT_TIMELINE_CHANGED, timeline)
 	})
 
 	appMenu := a.AppMenu()
@@ -410,7 +476,7 @@ func (a *App) gaharaSetup() error {
 	if err != nil {
 		return err
 	}
-	wruntime.LogInfo(a.ctx, "Gahara workspace has been found!")
+	a.notifier.LogInfo("Gahara workspace has been found!")
 
 	// config.json
 	configPath := path.Join(gaharaDir, "config.json")
@@ -430,20 +496,20 @@ func (a *App) gaharaSetup() error {
 
 		bytes, err := json.MarshalIndent(gaharaConfig, "", "\t")
 		if err != nil {
-			wruntime.LogError(a.ctx, "could not marshal Config struct")
+			a.notifier.LogError("could not marshal Config struct")
 			return err
 		}
 
 		_, err = file.Write(bytes)
 		if err != nil {
-			wruntime.LogError(a.ctx, "could not write bytes into json file")
+			a.notifier.LogError("could not write bytes into json file")
 			return err
 		}
 
-		wruntime.LogInfo(a.ctx, "config.json file for gahara has been created!")
+		a.notifier.LogInfo("config.json file for gahara has been created!")
 
 	} else if err != nil {
-		wruntime.LogError(a.ctx, fmt.Sprintf("could not setup gahara: %s\n", err.Error()))
+		a.notifier.LogError(fmt.Sprintf("could not setup gahara: %s\n", err.Error()))
 		return err
 
 	}
@@ -451,16 +517,16 @@ func (a *App) gaharaSetup() error {
 	// the file exists, read it into the struct
 	bytes, err := os.ReadFile(configPath)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the config file path")
+		a.notifier.LogError("could not read the config file path")
 		return err
 	}
 
 	err = json.Unmarshal(bytes, &a.config)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not unmarshal the config")
+		a.notifier.LogError("could not unmarshal the config")
 		return err
 	}
 
-	wruntime.LogInfo(a.ctx, "config.json file has been found!")
+	a.notifier.LogInfo("config.json file has been found!")
 	return nil
 }
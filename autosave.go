@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/k1nho/gahara/internal/storage"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// AUTOSAVE_FILE: the file where the timeline is autosaved, next to timeline.json
+	AUTOSAVE_FILE = "timeline.autosave.json"
+	// DEFAULT_AUTOSAVE_INTERVAL: the autosave interval in seconds when none is configured
+	DEFAULT_AUTOSAVE_INTERVAL = 60
+	// PROJECT_BACKUPS: the number of backups kept of timeline.json and metadata.json
+	PROJECT_BACKUPS = 3
+)
+
+// AutosaveRecovery: an autosave of the project newer than its saved timeline
+type AutosaveRecovery struct {
+	// Available: an autosave newer than timeline.json was found
+	Available bool `json:"available"`
+	// SavedAt: when the autosave was written (RFC3339)
+	SavedAt string `json:"saved_at,omitempty"`
+}
+
+// autosaveInterval: the configured autosave interval, autosave is disabled if it is negative
+func (a *App) autosaveInterval() time.Duration {
+	a.configLock.Lock()
+	defer a.configLock.Unlock()
+	if a.config.AutosaveInterval == 0 {
+		return DEFAULT_AUTOSAVE_INTERVAL * time.Second
+	}
+	return time.Duration(a.config.AutosaveInterval) * time.Second
+}
+
+// autosaveLoop: autosaves the timeline of the open project periodically until the context is done
+func (a *App) autosaveLoop(ctx context.Context) {
+	for {
+		interval := a.autosaveInterval()
+		wait := interval
+		if interval <= 0 {
+			// autosave is disabled, the configuration is checked again later
+			wait = DEFAULT_AUTOSAVE_INTERVAL * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if interval <= 0 {
+			continue
+		}
+		if err := a.autosave(); err != nil {
+			a.notifier.LogError(fmt.Sprintf("could not autosave the timeline: %s", err.Error()))
+		}
+	}
+}
+
+// autosave: writes the timeline to the autosave file if it changed since it was last saved
+func (a *App) autosave() error {
+	a.saveLock.Lock()
+	defer a.saveLock.Unlock()
+
+	timeline := a.snapshotTimeline()
+	if a.config.ProjectDir == "" || len(timeline.VideoNodes) == 0 {
+		return nil
+	}
+	data, err := video.MarshalTimeline(timeline)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, a.lastSaved) {
+		return nil
+	}
+
+	if err := storage.WriteFile(path.Join(a.config.ProjectDir, AUTOSAVE_FILE), data, 0644, 0); err != nil {
+		return err
+	}
+	a.lastSaved = data
+	a.notifier.LogInfo(fmt.Sprintf("%s: timeline has been autosaved", time.Now().String()))
+	return nil
+}
+
+// checkAutosave: looks for an autosave newer than the saved timeline of the project, stale autosaves are removed
+func (a *App) checkAutosave() AutosaveRecovery {
+	autosavePath := path.Join(a.config.ProjectDir, AUTOSAVE_FILE)
+	autosaveInfo, err := os.Stat(autosavePath)
+	if err != nil {
+		return AutosaveRecovery{}
+	}
+
+	timelineInfo, err := os.Stat(path.Join(a.config.ProjectDir, "timeline.json"))
+	if err == nil && !autosaveInfo.ModTime().After(timelineInfo.ModTime()) {
+		_ = os.Remove(autosavePath)
+		return AutosaveRecovery{}
+	}
+
+	a.notifier.LogInfo("an autosave newer than the saved timeline was found")
+	return AutosaveRecovery{Available: true, SavedAt: autosaveInfo.ModTime().Format(time.RFC3339)}
+}
+
+// RecoverAutosave: replaces the saved timeline of the project with its autosave and loads it
+func (a *App) RecoverAutosave() (video.Timeline, error) {
+	a.saveLock.Lock()
+	autosavePath := path.Join(a.config.ProjectDir, AUTOSAVE_FILE)
+	data, err := os.ReadFile(autosavePath)
+	if err != nil {
+		a.saveLock.Unlock()
+		return a.GetTimeline(), fmt.Errorf("no autosave found for this project")
+	}
+	// a broken autosave must not replace the saved timeline
+	if _, err := video.UnmarshalTimeline(data); err != nil {
+		a.saveLock.Unlock()
+		return a.GetTimeline(), fmt.Errorf("the autosave could not be recovered: %s", err.Error())
+	}
+	err = storage.WriteFile(path.Join(a.config.ProjectDir, "timeline.json"), data, 0644, PROJECT_BACKUPS)
+	if err != nil {
+		a.saveLock.Unlock()
+		return a.GetTimeline(), err
+	}
+	_ = os.Remove(autosavePath)
+	a.saveLock.Unlock()
+
+	a.notifier.LogInfo("autosave has been recovered")
+	return a.LoadTimeline()
+}
+
+// DiscardAutosave: deletes the autosave of the project
+func (a *App) DiscardAutosave() error {
+	a.saveLock.Lock()
+	defer a.saveLock.Unlock()
+
+	err := os.Remove(path.Join(a.config.ProjectDir, AUTOSAVE_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not discard the autosave: %s", err.Error())
+	}
+	return nil
+}
+
+// SetAutosaveInterval: sets the autosave interval in seconds (negative disables autosave) and stores it in config.json
+func (a *App) SetAutosaveInterval(seconds int) error {
+	a.configLock.Lock()
+	a.config.AutosaveInterval = seconds
+	a.configLock.Unlock()
+	return a.saveConfig()
+}
+
+// saveConfig: stores the configuration of gahara in config.json
+func (a *App) saveConfig() error {
+	// the project directory is session state, it is not stored
+	a.configLock.Lock()
+	config := a.config
+	a.configLock.Unlock()
+	config.ProjectDir = ""
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(path.Join(a.config.GaharaDir, "config.json"), data, 0644, 0)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// TestAutosaveConcurrentEdits: the timeline is autosaved while it is edited, run with -race
+func TestAutosaveConcurrentEdits(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := app.autosave(); err != nil {
+				t.Error(err)
+				return
+			}
+			_ = app.autosaveInterval()
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if _, err := app.InsertInterval(sources[0], "intro", 0, 2, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := app.SplitInterval(video.EVT_INTERVAL_CUT, 0, 0.5, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := app.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := app.Redo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := app.SetClipSpeed(video.MAIN_TRACK_ID, 0, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.SetAutosaveInterval(i + 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.SaveTimeline(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// the last edits are autosaved whole
+	if err := app.RenameVideoNode(0, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.autosave(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(app.config.ProjectDir, AUTOSAVE_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	autosaved, err := video.UnmarshalTimeline(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(autosaved.VideoNodes) != len(app.GetTimeline().VideoNodes) || autosaved.VideoNodes[0].Name != "Intro" {
+		t.Errorf("expected the autosave to match the timeline, got %+v", autosaved.VideoNodes)
+	}
+}
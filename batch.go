@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// BatchSummary: the outcome of a batch export, emitted once every export of the batch has ended
+type BatchSummary struct {
+	// JobID: the id of the job of the batch
+	JobID string `json:"job_id"`
+	// Total: the number of exports in the batch
+	Total int `json:"total"`
+	// Succeeded: the number of exports that succeeded
+	Succeeded int `json:"succeeded"`
+	// Failed: the number of exports that failed
+	Failed int `json:"failed"`
+	// Cancelled: the number of exports stopped or never started because the job was cancelled
+	Cancelled int `json:"cancelled"`
+}
+
+// exportConcurrency: the configured number of concurrent exports of a batch (the number of CPUs if unset)
+func (a *App) exportConcurrency() int {
+	a.configLock.Lock()
+	defer a.configLock.Unlock()
+	if a.config.ExportConcurrency <= 0 {
+		return runtime.NumCPU()
+	}
+	return a.config.ExportConcurrency
+}
+
+// SetExportConcurrency: sets the number of concurrent exports of a batch (0 uses the number of CPUs) and stores it in config.json
+func (a *App) SetExportConcurrency(concurrency int) error {
+	if concurrency < 0 {
+		return fmt.Errorf("the export concurrency cannot be negative")
+	}
+	a.configLock.Lock()
+	a.config.ExportConcurrency = concurrency
+	a.configLock.Unlock()
+	return a.saveConfig()
+}
+
+/*
+runBatch: runs n tasks on a pool of at most concurrency workers. The results are reported in the order of the
+tasks as soon as all the previous tasks have ended, whatever the order in which they complete. Once ctx is
+done, the tasks that have not started are reported as cancelled without running
+*/
+func runBatch(ctx context.Context, n int, concurrency int, task func(i int) VideoProcessingResult, report func(i int, result VideoProcessingResult)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		wg      = new(sync.WaitGroup)
+		tasks   = make(chan int)
+		results = make(chan indexedResult)
+	)
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				results <- indexedResult{i: i, result: task(i)}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(tasks)
+		for i := 0; i < n; i++ {
+			if ctx.Err() != nil {
+				results <- indexedResult{i: i, result: VideoProcessingResult{Status: Cancelled}}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				results <- indexedResult{i: i, result: VideoProcessingResult{Status: Cancelled}}
+			case tasks <- i:
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// the results that completed before a previous task are held until it ends
+	pending := map[int]VideoProcessingResult{}
+	next := 0
+	for completed := range results {
+		pending[completed.i] = completed.result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			report(next, result)
+			next++
+		}
+	}
+}
+
+// indexedResult: the result of the task at index i of a batch
+type indexedResult struct {
+	i      int
+	result VideoProcessingResult
+}
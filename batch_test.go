@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func TestRunBatch(t *testing.T) {
+	t.Run("bounded and reported in order", func(t *testing.T) {
+		var (
+			lock                sync.Mutex
+			running, maxRunning int
+		)
+		task := func(i int) VideoProcessingResult {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+
+			// the first tasks complete last
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			return VideoProcessingResult{Name: strconv.Itoa(i), Status: Success}
+		}
+
+		reported := []string{}
+		runBatch(context.Background(), 10, 3, task, func(i int, result VideoProcessingResult) {
+			if result.Name != strconv.Itoa(i) {
+				t.Errorf("result %s was reported as %d", result.Name, i)
+			}
+			reported = append(reported, result.Name)
+		})
+
+		if !slices.Equal(reported, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}) {
+			t.Errorf("expected the results in order, got %v", reported)
+		}
+		if maxRunning > 3 {
+			t.Errorf("expected at most 3 tasks at a time, got %d", maxRunning)
+		}
+	})
+
+	t.Run("cancelled batch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		statuses := []string{}
+		runBatch(ctx, 4, 2, func(i int) VideoProcessingResult {
+			t.Errorf("task %d of a cancelled batch was started", i)
+			return VideoProcessingResult{Status: Success}
+		}, func(i int, result VideoProcessingResult) {
+			statuses = append(statuses, result.Status)
+		})
+		if !slices.Equal(statuses, []string{Cancelled, Cancelled, Cancelled, Cancelled}) {
+			t.Errorf("expected every task to be cancelled, got %v", statuses)
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		runBatch(context.Background(), 0, 4, nil, func(i int, result VideoProcessingResult) {
+			t.Errorf("unexpected result %d", i)
+		})
+	})
+}
+
+func TestLosslessCutBatch(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	if _, err := app.InsertInterval(sources[0], "outro", 5, 7, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.MarkAllLossless(); err != nil {
+		t.Fatal(err)
+	}
+	app.config.ExportConcurrency = 2
+	fake.on("ffmpeg", sources[1]).withStderr("talk.mov: Invalid data found when processing input").withExitCode(1)
+
+	outputPath := t.TempDir()
+	if err := app.FFmpegQuery(video.QUERY_LOSSLESS_CUT, video.ProcessingOpts{VideoFormat: ".mov", OutputPath: outputPath, Filename: "cut"}); err != nil {
+		t.Fatal(err)
+	}
+
+	names, statuses := []string{}, []string{}
+	for _, event := range notifier.eventsOf(video.EVT_FFMPEG_RESULT) {
+		result := event[0].(VideoProcessingResult)
+		names, statuses = append(names, result.Name), append(statuses, result.Status)
+	}
+	if !slices.Equal(names, []string{"intro", "talk", "outro"}) || !slices.Equal(statuses, []string{Success, Failed, Success}) {
+		t.Errorf("expected the results in the order of the timeline, got %v %v", names, statuses)
+	}
+
+	// every node is written to its own file
+	outputs := []string{}
+	for _, command := range fake.commands("ffmpeg") {
+		outputs = append(outputs, command.Outputs...)
+	}
+	slices.Sort(outputs)
+	expected := []string{filepath.Join(outputPath, "intro.mov"), filepath.Join(outputPath, "outro.mov"), filepath.Join(outputPath, "talk.mov")}
+	if !slices.Equal(outputs, expected) {
+		t.Errorf("expected the outputs %v, got %v", expected, outputs)
+	}
+
+	summaries := notifier.eventsOf(video.EVT_BATCH_SUMMARY)
+	if len(summaries) != 1 || summaries[0][0] != (BatchSummary{JobID: summaries[0][0].(BatchSummary).JobID, Total: 3, Succeeded: 2, Failed: 1}) {
+		t.Errorf("unexpected summary %v", summaries)
+	}
+}
+
+func TestLosslessCutSplitClip(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	// intro is cut in three nodes sharing its name, a clip is already named like the suffixed nodes
+	if _, err := app.SplitInterval(video.EVT_INTERVAL_CUT, 0, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RenameVideoNode(3, "intro-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.MarkAllLossless(); err != nil {
+		t.Fatal(err)
+	}
+	app.config.ExportConcurrency = 4
+
+	outputPath := t.TempDir()
+	if err := app.FFmpegQuery(video.QUERY_LOSSLESS_CUT, video.ProcessingOpts{VideoFormat: ".mov", OutputPath: outputPath, Filename: "cut"}); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := map[string]string{}
+	for _, command := range fake.commands("ffmpeg") {
+		outputs[command.Outputs[0]] = command.Args[slices.Index(command.Args, "-i")+1]
+	}
+	expected := map[string]string{
+		filepath.Join(outputPath, "intro.mov"):   sources[0],
+		filepath.Join(outputPath, "intro-3.mov"): sources[0],
+		filepath.Join(outputPath, "intro-4.mov"): sources[0],
+		filepath.Join(outputPath, "intro-2.mov"): sources[1],
+	}
+	if !maps.Equal(outputs, expected) {
+		t.Errorf("expected every node to be written to its own file %v, got %v", expected, outputs)
+	}
+	for _, event := range notifier.eventsOf(video.EVT_FFMPEG_RESULT) {
+		if result := event[0].(VideoProcessingResult); result.Status != Success {
+			t.Errorf("expected %s to be cut, got %+v", result.Name, result)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// EXIT_FAILURE: the exit code of a command that failed
+	EXIT_FAILURE = 1
+	// EXIT_USAGE: the exit code of a command with invalid flags
+	EXIT_USAGE = 2
+)
+
+// exportCommand: the flags of gahara export
+type exportCommand struct {
+	project  string
+	preset   string
+	out      string
+	name     string
+	format   string
+	lossless bool
+	ffmpeg   string
+	verbose  bool
+}
+
+/*
+runExportCommand: exports the saved timeline of a project of the gahara workspace without the window, with the
+same queries as FFmpegQuery. The progress is written to stdout, and the exit code is non zero if the export
+failed. The export is cancelled once ctx is done
+Ex: gahara export --project trip --preset web-1080p-h264 --out ~/Videos
+*/
+func runExportCommand(ctx context.Context, a *App, args []string, stdout io.Writer, stderr io.Writer) int {
+	cmd := exportCommand{}
+	flags := flag.NewFlagSet("gahara export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cmd.project, "project", "", "the name of the project in the gahara workspace (required)")
+	flags.StringVar(&cmd.preset, "preset", "", "the id or name of the export preset (required unless --lossless)")
+	flags.StringVar(&cmd.out, "out", "", "the directory of the export (the project directory by default)")
+	flags.StringVar(&cmd.name, "name", "", "the file name of the export without extension (the project name by default)")
+	flags.StringVar(&cmd.format, "format", "", "the video format of the export (.mp4, .mov), overrides the format of the preset")
+	flags.BoolVar(&cmd.lossless, "lossless", false, "joins the clips of the main track without re-encoding")
+	flags.StringVar(&cmd.ffmpeg, "ffmpeg", "", "the path of ffmpeg, ffprobe is expected next to it (the bundled or installed ffmpeg by default)")
+	flags.BoolVar(&cmd.verbose, "verbose", false, "writes the logs of gahara to stderr")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return EXIT_USAGE
+	}
+	if cmd.project == "" || (cmd.preset == "" && !cmd.lossless) {
+		fmt.Fprintln(stderr, "gahara export: --project and --preset (or --lossless) are required")
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	a.notifier = newConsoleNotifier(stdout, stderr, cmd.verbose)
+	if err := cmd.run(ctx, a); err != nil {
+		fmt.Fprintf(stderr, "gahara export: %s\n", err.Error())
+		return EXIT_FAILURE
+	}
+	return 0
+}
+
+// run: loads the project and runs its export until it ends or ctx is done
+func (c *exportCommand) run(ctx context.Context, a *App) error {
+	// the export is cancelled even if ctx is done before its job is started
+	a.jobs = NewJobRegistry(ctx)
+	if err := a.gaharaSetup(); err != nil {
+		return err
+	}
+	a.loadPresets()
+
+	projectDir := path.Join(a.config.GaharaDir, c.project)
+	if info, err := os.Stat(projectDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("project %s was not found in %s", c.project, a.config.GaharaDir)
+	}
+	a.config.ProjectDir = projectDir
+
+	// the timelines saved before frame accurate intervals are probed on load
+	cleanup, err := c.setupFFmpeg(a)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := a.LoadTimeline(); err != nil {
+		return fmt.Errorf("could not load the timeline of %s: %s", c.project, err.Error())
+	}
+	queryType, opts, err := c.processingOpts(a)
+	if err != nil {
+		return err
+	}
+
+	return a.FFmpegQuery(queryType, opts)
+}
+
+// processingOpts: the query and the processing options of the export given the flags
+func (c *exportCommand) processingOpts(a *App) (string, video.ProcessingOpts, error) {
+	outputPath, filename := c.out, c.name
+	if outputPath == "" {
+		outputPath = a.config.ProjectDir
+	}
+	if filename == "" {
+		filename = c.project
+	}
+
+	if c.lossless {
+		// the clips are copied, their container is kept unless another one is given
+		videoNodes := a.GetTimeline().VideoNodes
+		if len(videoNodes) == 0 {
+			return "", video.ProcessingOpts{}, fmt.Errorf("the main track of %s has no clips to export", c.project)
+		}
+		format := c.format
+		if format == "" {
+			format = filepath.Ext(videoNodes[0].RID)
+		}
+		return video.QUERY_LOSSLESS_MERGE, video.ProcessingOpts{OutputPath: outputPath, Filename: filename, VideoFormat: format}, nil
+	}
+
+	presets := a.ListExportPresets()
+	preset, ok := findPreset(presets, c.preset)
+	if !ok {
+		ids := []string{}
+		for _, preset := range presets {
+			ids = append(ids, preset.ID)
+		}
+		return "", video.ProcessingOpts{}, fmt.Errorf("preset %s was not found (%s)", c.preset, strings.Join(ids, ", "))
+	}
+	opts := preset.ProcessingOpts(filename, outputPath)
+	if c.format != "" {
+		opts.VideoFormat = c.format
+	}
+	return video.QUERY_FILTERGRAPH, opts, nil
+}
+
+// findPreset: finds an export preset by its id, or by its name ignoring case
+func findPreset(presets []video.ExportPreset, idOrName string) (video.ExportPreset, bool) {
+	for _, preset := range presets {
+		if preset.ID == idOrName {
+			return preset, true
+		}
+	}
+	for _, preset := range presets {
+		if strings.EqualFold(preset.Name, strings.TrimSpace(idOrName)) {
+			return preset, true
+		}
+	}
+	return video.ExportPreset{}, false
+}
+
+/*
+setupFFmpeg: sets the ffmpeg and ffprobe of the export. The ffmpeg of the flags is used first, then the bundled
+ffmpeg, and the ffmpeg installed in the PATH on the platforms without a bundled one. The returned cleanup removes
+the extracted binaries
+*/
+func (c *exportCommand) setupFFmpeg(a *App) (func(), error) {
+	if c.ffmpeg != "" {
+		a.FFmpegPath = c.ffmpeg
+		a.FFprobePath = filepath.Join(filepath.Dir(c.ffmpeg), "ffprobe")
+		return func() {}, nil
+	}
+	if a.FFmpegPath != "" {
+		return func() {}, nil
+	}
+
+	if FFmpegPath, err := ExtractFFmpeg(); err == nil {
+		a.FFmpegPath = FFmpegPath
+		a.FFprobePath = filepath.Join(filepath.Dir(FFmpegPath), "ffprobe")
+		return func() { _ = os.RemoveAll(filepath.Dir(FFmpegPath)) }, nil
+	}
+
+	FFmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg was not found, set its path with --ffmpeg")
+	}
+	FFprobePath, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe was not found in the PATH")
+	}
+	a.FFmpegPath, a.FFprobePath = FFmpegPath, FFprobePath
+	return func() {}, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// mockExportProject: saves the edited timeline to the "project" project of a workspace found in the home directory
+func mockExportProject(t *testing.T) (*App, *fakeFFmpeg) {
+	t.Helper()
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	if err := app.SaveTimeline(); err != nil {
+		t.Fatal(err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if err := os.Mkdir(filepath.Join(home, ".gahara"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(`{"gaharadir": "` + filepath.ToSlash(app.config.GaharaDir) + `"}`)
+	if err := os.WriteFile(filepath.Join(home, ".gahara", "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the export loads the saved timeline
+	app.Timeline = video.NewTimeline()
+	app.config.ProjectDir = ""
+	return app, fake
+}
+
+func TestExportCommand(t *testing.T) {
+	app, fake := mockExportProject(t)
+	fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=5000000", "speed=2.0x", "progress=continue", "progress=end")
+	out := t.TempDir()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runExportCommand(context.Background(), app, []string{"--project", "project", "--preset", "web 720p (h.264)", "--out", out}, stdout, stderr)
+	if code != 0 {
+		t.Fatalf("expected the export to succeed, got %d: %s", code, stderr)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, "project.mp4")); err != nil {
+		t.Errorf("expected the export in the output directory: %s", err.Error())
+	}
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 1 || !strings.Contains(commands[0].String(), "scale=1280x720") {
+		t.Errorf("expected the query of the preset, got %v", commands)
+	}
+	for _, line := range []string{" 50.0%  eta 3s  speed 2.00x", "100.0%", "Finished exporting project.mp4"} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected %q in the output, got %s", line, stdout)
+		}
+	}
+}
+
+func TestExportCommandLossless(t *testing.T) {
+	app, fake := mockExportProject(t)
+	// the clips of a lossless export share the same streams
+	fake.on("ffprobe", filepath.Join(app.config.GaharaDir, "project", "talk.mov")).withStdout(mockProbeOutput(60, true))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := runExportCommand(context.Background(), app, []string{"--project", "project", "--lossless", "--name", "joined"}, stdout, stderr); code != 0 {
+		t.Fatalf("expected the export to succeed, got %d: %s", code, stderr)
+	}
+	// the clips keep the container of their sources
+	if _, err := os.Stat(filepath.Join(app.config.ProjectDir, "joined.mov")); err != nil {
+		t.Errorf("expected the lossless export in the project directory: %s", err.Error())
+	}
+	commands := fake.commands("ffmpeg")
+	if last := commands[len(commands)-1]; !strings.Contains(last.String(), "concat") {
+		t.Errorf("expected the segments to be joined, got %s", last)
+	}
+}
+
+func TestExportCommandFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		fail   bool
+		code   int
+		stderr string
+	}{
+		{name: "missing project", args: []string{"--preset", "web-1080p-h264"}, code: EXIT_USAGE, stderr: "--project"},
+		{name: "missing preset", args: []string{"--project", "project"}, code: EXIT_USAGE, stderr: "--preset"},
+		{name: "unknown flag", args: []string{"--project", "project", "--bitrate", "4M"}, code: EXIT_USAGE, stderr: "bitrate"},
+		{name: "unknown project", args: []string{"--project", "missing", "--preset", "web-1080p-h264"}, code: EXIT_FAILURE, stderr: "project missing was not found"},
+		{name: "unknown preset", args: []string{"--project", "project", "--preset", "missing"}, code: EXIT_FAILURE, stderr: "preset missing was not found"},
+		{name: "ffmpeg failure", args: []string{"--project", "project", "--preset", "web-1080p-h264"}, fail: true, code: EXIT_FAILURE, stderr: "Error while opening encoder"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, fake := mockExportProject(t)
+			if tt.fail {
+				fake.on("ffmpeg", "-filter_complex").withStderr("Error while opening encoder").withExitCode(1)
+			}
+
+			stderr := &bytes.Buffer{}
+			code := runExportCommand(context.Background(), app, tt.args, &bytes.Buffer{}, stderr)
+			if code != tt.code || !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("expected exit code %d with %q, got %d: %s", tt.code, tt.stderr, code, stderr)
+			}
+		})
+	}
+}
+
+func TestExportCommandCancel(t *testing.T) {
+	app, fake := mockExportProject(t)
+	script := fake.on("ffmpeg", "-filter_complex").untilCancelled()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-script.running
+		cancel()
+	}()
+
+	stderr := &bytes.Buffer{}
+	code := runExportCommand(ctx, app, []string{"--project", "project", "--preset", "web-1080p-h264"}, &bytes.Buffer{}, stderr)
+	if code != EXIT_FAILURE || !strings.Contains(stderr.String(), ErrJobCancelled.Error()) {
+		t.Errorf("expected the cancelled export to fail, got %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(app.config.ProjectDir, "project.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial export to be removed")
+	}
+}
+
+func TestExportCommandCancelBeforeStart(t *testing.T) {
+	app, fake := mockExportProject(t)
+	// the interrupt is received while the project is loaded, before the job of the export is started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stderr := &bytes.Buffer{}
+	code := runExportCommand(ctx, app, []string{"--project", "project", "--preset", "web-1080p-h264"}, &bytes.Buffer{}, stderr)
+	if code != EXIT_FAILURE || !strings.Contains(stderr.String(), ErrJobCancelled.Error()) {
+		t.Errorf("expected the cancelled export to fail, got %d: %s", code, stderr)
+	}
+	if commands := fake.commands("ffmpeg"); len(commands) != 0 {
+		t.Errorf("expected ffmpeg not to run, got %v", commands)
+	}
+}
+
+func TestExportCommandLosslessEmptyTimeline(t *testing.T) {
+	app, _ := mockExportProject(t)
+	// the main track has no clip to take the container from
+	cmd := exportCommand{project: "project", lossless: true}
+	if _, _, err := cmd.processingOpts(app); err == nil || !strings.Contains(err.Error(), "no clips") {
+		t.Errorf("expected the export of an empty main track to fail, got %v", err)
+	}
+}
@@ -8,24 +8,25 @@ import (
 	"path/filepath"
 )
 
-//go:embed resources/darwin/ffmpeg
+//go:embed resources/darwin/ffmpeg resources/darwin/ffprobe
 var FFmpegBinary embed.FS
 
+// ExtractFFmpeg: extracts ffmpeg and ffprobe to a temporary directory, returns the path of ffmpeg
 func ExtractFFmpeg() (string, error) {
-	data, err := FFmpegBinary.ReadFile("resources/darwin/ffmpeg")
-	if err != nil {
-		return "", err
-	}
-
 	tempDir, err := os.MkdirTemp("", "ffmpeg")
 	if err != nil {
 		return "", err
 	}
 
-	ffmpegPath := filepath.Join(tempDir, "ffmpeg")
-	err = os.WriteFile(ffmpegPath, data, 0755)
-	if err != nil {
-		return "", err
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		data, err := FFmpegBinary.ReadFile("resources/darwin/" + binary)
+		if err != nil {
+			return "", err
+		}
+		err = os.WriteFile(filepath.Join(tempDir, binary), data, 0755)
+		if err != nil {
+			return "", err
+		}
 	}
-	return ffmpegPath, nil
+	return filepath.Join(tempDir, "ffmpeg"), nil
 }
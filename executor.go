@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/k1nho/gahara/ffmpegbuilder"
+)
+
+// CANCEL_GRACE_PERIOD: the time given to ffmpeg to exit after it is interrupted, it is killed afterwards
+const CANCEL_GRACE_PERIOD = 5 * time.Second
+
+// Executor: runs the ffmpeg and ffprobe commands of the app
+type Executor interface {
+	// Run: runs a command until it exits or ctx is cancelled, the stderr of the command (progress, errors) is written to stderr
+	Run(ctx context.Context, query ffmpegbuilder.Command, stderr io.Writer) error
+	// Output: runs a command until it exits, and returns its stdout
+	Output(query ffmpegbuilder.Command) ([]byte, error)
+}
+
+// execExecutor: the Executor that runs the commands as processes, arguments are never interpreted by a shell
+type execExecutor struct{}
+
+func (e *execExecutor) Run(ctx context.Context, query ffmpegbuilder.Command, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, query.Path, query.Args...)
+	cmd.Stderr = stderr
+	// ffmpeg is interrupted so it stops reading its inputs and closes its outputs, windows has no interrupt
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = CANCEL_GRACE_PERIOD
+	return cmd.Run()
+}
+
+func (e *execExecutor) Output(query ffmpegbuilder.Command) ([]byte, error) {
+	return exec.Command(query.Path, query.Args...).Output()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/k1nho/gahara/ffmpegbuilder"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// fakeScript: the scripted behaviour of the fake ffmpeg for the commands that contain all the args of match
+type fakeScript struct {
+	match []string
+	// progress: the lines of -progress written to stderr (out_time_us=1000000)
+	progress []string
+	// stderr: written to stderr after the progress
+	stderr string
+	// stdout: the output of the command (ffprobe json)
+	stdout string
+	// exitCode: a non zero exit code fails the command
+	exitCode int
+	// running: closed once the command runs until it is cancelled, nil if it exits on its own
+	running chan struct{}
+	// exited: called once the command has written its outputs, before it exits on its own
+	exited func()
+}
+
+func (s *fakeScript) withProgress(lines ...string) *fakeScript {
+	s.progress = append(s.progress, lines...)
+	return s
+}
+
+func (s *fakeScript) withStderr(stderr string) *fakeScript {
+	s.stderr = stderr
+	return s
+}
+
+func (s *fakeScript) withStdout(stdout string) *fakeScript {
+	s.stdout = stdout
+	return s
+}
+
+func (s *fakeScript) withExitCode(exitCode int) *fakeScript {
+	s.exitCode = exitCode
+	return s
+}
+
+func (s *fakeScript) onExit(exited func()) *fakeScript {
+	s.exited = exited
+	return s
+}
+
+// untilCancelled: the command writes a partial output, and runs until it is cancelled
+func (s *fakeScript) untilCancelled() *fakeScript {
+	s.running = make(chan struct{})
+	return s
+}
+
+/*
+fakeFFmpeg: an Executor that replays the scripts of the commands instead of running ffmpeg and ffprobe. The
+script added last that matches a command is replayed, a successful ffmpeg command creates its output file.
+Ex: fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=5000000").withExitCode(1)
+*/
+type fakeFFmpeg struct {
+	mu      sync.Mutex
+	scripts []*fakeScript
+	calls   []ffmpegbuilder.Command
+}
+
+func newFakeFFmpeg() *fakeFFmpeg {
+	return &fakeFFmpeg{}
+}
+
+// on: adds the script of the commands whose path or args contain all the given values
+func (f *fakeFFmpeg) on(match ...string) *fakeScript {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	script := &fakeScript{match: match}
+	f.scripts = append(f.scripts, script)
+	return script
+}
+
+// replay: records a command and returns its script
+func (f *fakeFFmpeg) replay(query ffmpegbuilder.Command) *fakeScript {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, query)
+
+	values := append([]string{query.Path}, query.Args...)
+	for i := len(f.scripts) - 1; i >= 0; i-- {
+		matches := true
+		for _, value := range f.scripts[i].match {
+			if !slices.Contains(values, value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return f.scripts[i]
+		}
+	}
+	return &fakeScript{}
+}
+
+func (f *fakeFFmpeg) Run(ctx context.Context, query ffmpegbuilder.Command, stderr io.Writer) error {
+	script := f.replay(query)
+	for _, line := range script.progress {
+		fmt.Fprintln(stderr, line)
+	}
+	if script.running != nil {
+		for _, output := range query.Outputs {
+			if output != "-" && !strings.HasPrefix(output, "pipe:") {
+				_ = os.WriteFile(output, []byte("partial"), 0644)
+			}
+		}
+		close(script.running)
+		<-ctx.Done()
+		return fmt.Errorf("signal: interrupt")
+	}
+	if script.stderr != "" {
+		fmt.Fprintln(stderr, script.stderr)
+	}
+	if script.exitCode != 0 {
+		return fmt.Errorf("exit status %d", script.exitCode)
+	}
+
+	// the null muxer writes to "-"
+	for _, output := range query.Outputs {
+		if _, err := os.Stat(filepath.Dir(output)); err == nil && output != "-" && !strings.HasPrefix(output, "pipe:") {
+			if err := os.WriteFile(output, []byte{}, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	if script.exited != nil {
+		script.exited()
+	}
+	return nil
+}
+
+func (f *fakeFFmpeg) Output(query ffmpegbuilder.Command) ([]byte, error) {
+	script := f.replay(query)
+	if script.exitCode != 0 {
+		return nil, fmt.Errorf("exit status %d", script.exitCode)
+	}
+	if script.exited != nil {
+		script.exited()
+	}
+	return []byte(script.stdout), nil
+}
+
+// commands: returns the commands of a binary (ffmpeg, ffprobe) run so far
+func (f *fakeFFmpeg) commands(path string) []ffmpegbuilder.Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := []ffmpegbuilder.Command{}
+	for _, call := range f.calls {
+		if call.Path == path {
+			commands = append(commands, call)
+		}
+	}
+	return commands
+}
+
+// fakeEvent: an event emitted to the frontend
+type fakeEvent struct {
+	name string
+	data []interface{}
+}
+
+// fakeNotifier: a Notifier that records the events, and discards the logs
+type fakeNotifier struct {
+	mu     sync.Mutex
+	events []fakeEvent
+	// errors: the errors logged
+	errors []string
+}
+
+func (n *fakeNotifier) EventsEmit(eventName string, optionalData ...interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, fakeEvent{name: eventName, data: optionalData})
+}
+
+func (n *fakeNotifier) LogDebug(message string) {}
+
+func (n *fakeNotifier) LogInfo(message string) {}
+
+func (n *fakeNotifier) LogError(message string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.errors = append(n.errors, message)
+}
+
+// eventsOf: returns the data of the events emitted with a name, in order
+func (n *fakeNotifier) eventsOf(eventName string) [][]interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	events := [][]interface{}{}
+	for _, event := range n.events {
+		if event.name == eventName {
+			events = append(events, event.data)
+		}
+	}
+	return events
+}
+
+// newTestApp: returns an app that runs the fake ffmpeg in a temporary project directory
+func newTestApp(t *testing.T) (*App, *fakeFFmpeg, *fakeNotifier) {
+	t.Helper()
+	fake, notifier := newFakeFFmpeg(), &fakeNotifier{}
+	gaharaDir := t.TempDir()
+	projectDir := filepath.Join(gaharaDir, "project")
+	if err := os.Mkdir(projectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp()
+	app.executor, app.notifier = fake, notifier
+	app.FFmpegPath, app.FFprobePath = "ffmpeg", "ffprobe"
+	app.config = Config{GaharaDir: gaharaDir, ProjectDir: projectDir}
+	return app, fake, notifier
+}
+
+// mockProbeOutput: the ffprobe json of a 1080p 30fps h264 video of the given duration
+func mockProbeOutput(duration float64, audio bool) string {
+	streams := fmt.Sprintf(`{"index": 0, "codec_type": "video", "codec_name": "h264", "profile": "High", "width": 1920, "height": 1080, "pix_fmt": "yuv420p", "r_frame_rate": "30/1", "time_base": "1/15360", "duration": "%f"}`, duration)
+	if audio {
+		streams += fmt.Sprintf(`, {"index": 1, "codec_type": "audio", "codec_name": "aac", "sample_rate": "48000", "channels": 2, "duration": "%f"}`, duration)
+	}
+	return fmt.Sprintf(`{"streams": [%s], "format": {"filename": "clip", "format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "%f"}}`, streams, duration)
+}
+
+// mockExportOpts: valid options of a filtergraph export to the project directory
+func mockExportOpts(app *App) video.ProcessingOpts {
+	return video.ProcessingOpts{
+		Resolution: video.SCALE_1920X1080, Codec: video.CODEC_H264, CRF: video.CRF_23, Preset: video.PRESET_MEDIUM,
+		VideoFormat: ".mp4", OutputPath: app.config.ProjectDir, Filename: "export",
+	}
+}
@@ -2,6 +2,7 @@ package ffmpegbuilder
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/k1nho/gahara/internal/video"
@@ -17,6 +18,23 @@ type FFmpegBuilder struct {
 	Outputs            []string
 }
 
+// Command: an ffmpeg command, its arguments are passed to ffmpeg as they are (no shell is involved)
+type Command struct {
+	// Path: the ffmpeg executable
+	Path string
+	// Args: the arguments of the command
+	Args []string
+	// Outputs: the outputs written by the command, partial outputs are removed when the command is cancelled
+	Outputs []string
+	// query: the display rendering of the command
+	query string
+}
+
+// String: the command as a shell query, for display and debugging only
+func (c Command) String() string {
+	return c.query
+}
+
 // PreInputParams: all the parameters for input
 type PreInputParams struct {
 	// VerboseMode: -v in fffmpeg (sets the log level quiet, panic, fatal, error, warning, info, verbose, debug, trace)
@@ -29,11 +47,17 @@ type PreInputParams struct {
 	HideBanner bool
 	// StartTime: -ss in ffmpeg (seek time, or start time of a video)
 	StartTime float64
+	// InputFormat: -f in ffmpeg before the inputs, forces the demuxer of the inputs (concat)
+	InputFormat string
+	// Safe: -safe in ffmpeg, 0 allows the concat demuxer to read any file path (absolute paths)
+	Safe string
 }
 
 type FilterGraphParams struct {
 	// Scale: -s in ffmpeg, the scale of the output (1920x1080)
 	Scale string
+	// SilentInputs: the inputs that have no audio stream, silence is generated in their place
+	SilentInputs map[string]bool
 }
 
 // OutputParams: all the parameters for output
@@ -44,6 +68,32 @@ type OutputParams struct {
 	VideoCodec string
 	// AudioCodec: -c:a in ffmpeg
 	AudioCodec string
+	// AudioBitrate: -b:a in ffmpeg, the bitrate of the audio stream (128k, 192k, 320k)
+	AudioBitrate string
+	// VideoProfile: -profile:v in ffmpeg, the profile of the video encoder (high, main)
+	VideoProfile string
+	// PixelFormat: -pix_fmt in ffmpeg, the pixel format of the video stream (yuv420p)
+	PixelFormat string
+	// FrameRate: -r in ffmpeg, the frame rate of the video stream (30000/1001)
+	FrameRate string
+	// TrackTimescale: -video_track_timescale in ffmpeg, the timescale of the video track of mov and mp4 outputs
+	TrackTimescale string
+	// SampleRate: -ar in ffmpeg, the sample rate of the audio stream (48000)
+	SampleRate string
+	// AudioChannels: -ac in ffmpeg, the number of channels of the audio stream
+	AudioChannels string
+	// VideoBitrate: -b:v in ffmpeg, the target bitrate of the video stream (2500k, 8M)
+	VideoBitrate string
+	// MaxRate: -maxrate in ffmpeg, the maximum bitrate of the video stream
+	MaxRate string
+	// BufSize: -bufsize in ffmpeg, the size of the buffer in which the maximum bitrate is enforced
+	BufSize string
+	// Pass: -pass in ffmpeg, the pass of a two-pass encoding (1, 2), -x265-params pass for libx265
+	Pass int
+	// PassLogFile: -passlogfile in ffmpeg, the prefix of the statistics written by the first pass
+	PassLogFile string
+	// OutputFormat: -f in ffmpeg before the outputs, forces the muxer of the outputs (null)
+	OutputFormat string
 	// Duration: -t in ffmpeg, represents how long should the video last from a StartTime (00:00:20, 42.37)
 	Duration float64
 	// StopTime: -to in ffmpeg, represents when should the the video stop reading or writing(00:00:20, 42.37),
@@ -59,6 +109,8 @@ type OutputParams struct {
 	CRF string
 	// Preset: -preset in ffmpeg, encoding speed to compression ratio (slow, medium, fast)
 	Preset string
+	// GOP: -g in ffmpeg, the maximum number of frames between two keyframes
+	GOP string
 	// AvoidNegativeTS: -avoid_negative_ts in ffmpeg, avoids negative timestamps (make_zero: first ts 0, make_non_negative, disabled)
 	AvoidNegativeTS string
 	// MovFlags: -movflags in ffmpeg, mov, mp4, and ismv support fragmentation. The metadata about all packets is stored in one location,
@@ -66,6 +118,12 @@ type OutputParams struct {
 	MovFlags string
 	// NullOutput: -f null -  in ffmpeg (used to check info only)
 	NullOutput string
+	// MapMetadata: -map_metadata in ffmpeg, the input whose global metadata is copied to the output
+	MapMetadata string
+	// MapChapters: -map_chapters in ffmpeg, the input whose chapters are copied to the output
+	MapChapters string
+	// Maps: -map in ffmpeg, the streams (or filtergraph outputs) written to the output
+	Maps []string
 }
 
 func NewDefaultFFmpegBuilder(FFmpegPath string) *FFmpegBuilder {
@@ -112,6 +170,13 @@ func (f *FFmpegBuilder) WithInputStartTime(startTime float64) *FFmpegBuilder {
 	return f
 }
 
+// WithConcatDemuxer: reads the input as a concat list, the files it lists are joined without re-encoding
+func (f *FFmpegBuilder) WithConcatDemuxer() *FFmpegBuilder {
+	f.PreInputParams.InputFormat = "concat"
+	f.PreInputParams.Safe = "0"
+	return f
+}
+
 func (f *FFmpegBuilder) WithStatsPeriod(statsPeriod string) *FFmpegBuilder {
 	f.PreInputParams.StatsPeriod = statsPeriod
 	return f
@@ -142,6 +207,79 @@ func (f *FFmpegBuilder) WithAudioCodec(audioCodec string) *FFmpegBuilder {
 	return f
 }
 
+func (f *FFmpegBuilder) WithAudioBitrate(audioBitrate string) *FFmpegBuilder {
+	f.OutputParams.AudioBitrate = audioBitrate
+	return f
+}
+
+// WithVideoProfile: sets the profile of the video encoder
+func (f *FFmpegBuilder) WithVideoProfile(profile string) *FFmpegBuilder {
+	f.OutputParams.VideoProfile = profile
+	return f
+}
+
+// WithPixelFormat: sets the pixel format of the video stream
+func (f *FFmpegBuilder) WithPixelFormat(pixelFormat string) *FFmpegBuilder {
+	f.OutputParams.PixelFormat = pixelFormat
+	return f
+}
+
+// WithFrameRate: sets the frame rate of the video stream
+func (f *FFmpegBuilder) WithFrameRate(frameRate string) *FFmpegBuilder {
+	f.OutputParams.FrameRate = frameRate
+	return f
+}
+
+// WithTrackTimescale: sets the timescale of the video track (mov and mp4 outputs only)
+func (f *FFmpegBuilder) WithTrackTimescale(timescale string) *FFmpegBuilder {
+	f.OutputParams.TrackTimescale = timescale
+	return f
+}
+
+// WithSampleRate: sets the sample rate of the audio stream
+func (f *FFmpegBuilder) WithSampleRate(sampleRate string) *FFmpegBuilder {
+	f.OutputParams.SampleRate = sampleRate
+	return f
+}
+
+// WithAudioChannels: sets the number of channels of the audio stream
+func (f *FFmpegBuilder) WithAudioChannels(channels string) *FFmpegBuilder {
+	f.OutputParams.AudioChannels = channels
+	return f
+}
+
+// WithGOP: sets the maximum number of frames between two keyframes, a short GOP is fast to seek
+func (f *FFmpegBuilder) WithGOP(gop string) *FFmpegBuilder {
+	f.OutputParams.GOP = gop
+	return f
+}
+
+// WithVideoBitrate: sets the target bitrate of the video stream
+func (f *FFmpegBuilder) WithVideoBitrate(bitrate string) *FFmpegBuilder {
+	f.OutputParams.VideoBitrate = bitrate
+	return f
+}
+
+// WithRateLimit: sets the maximum bitrate of the video stream and the buffer in which it is enforced
+func (f *FFmpegBuilder) WithRateLimit(maxRate string, bufSize string) *FFmpegBuilder {
+	f.OutputParams.MaxRate = maxRate
+	f.OutputParams.BufSize = bufSize
+	return f
+}
+
+// WithPass: sets the pass of a two-pass encoding, the statistics of the first pass are written to logFile
+func (f *FFmpegBuilder) WithPass(pass int, logFile string) *FFmpegBuilder {
+	f.OutputParams.Pass = pass
+	f.OutputParams.PassLogFile = logFile
+	return f
+}
+
+// WithOutputFormat: forces the muxer of the outputs
+func (f *FFmpegBuilder) WithOutputFormat(format string) *FFmpegBuilder {
+	f.OutputParams.OutputFormat = format
+	return f
+}
+
 func (f *FFmpegBuilder) WithOutputStopTime(stopTime float64) *FFmpegBuilder {
 	f.OutputParams.StopTime = stopTime
 	return f
@@ -193,150 +331,443 @@ func (f *FFmpegBuilder) WithFScale(scale string) *FFmpegBuilder {
 	return f
 }
 
+// WithSilentInputs: sets the inputs that have no audio stream to be used within the filtergraph
+func (f *FFmpegBuilder) WithSilentInputs(inputs ...string) *FFmpegBuilder {
+	if f.FilterGraphParams.SilentInputs == nil {
+		f.FilterGraphParams.SilentInputs = map[string]bool{}
+	}
+	for _, input := range inputs {
+		f.FilterGraphParams.SilentInputs[input] = true
+	}
+	return f
+}
+
+// WithMaps: sets the streams (or filtergraph outputs) written to the output
+func (f *FFmpegBuilder) WithMaps(maps ...string) *FFmpegBuilder {
+	f.OutputParams.Maps = append(f.OutputParams.Maps, maps...)
+	return f
+}
+
+// WithChapters: adds an ffmpeg metadata file as the last input, its metadata and chapters are copied to the output
+func (f *FFmpegBuilder) WithChapters(metadataPath string) *FFmpegBuilder {
+	f.Inputs = append(f.Inputs, metadataPath)
+	idx := strconv.Itoa(len(uniqueInputs(f.Inputs)) - 1)
+	f.OutputParams.MapMetadata = idx
+	f.OutputParams.MapChapters = idx
+	return f
+}
+
 // ConcatFilter: returns a concatenation query to be used in filter complex, given video nodes
 func (f *FFmpegBuilder) ConcatFilter(videoNodes []video.VideoNode) (string, error) {
-	if len(videoNodes) == 0 {
-		return "", fmt.Errorf("no video nodes were provided")
+	return f.TimelineFilter(video.Timeline{VideoNodes: videoNodes})
+}
+
+// TimelineFilter: returns the filtergraph to be used in filter complex to export a timeline, its outputs are [out]
+// and [aout]. The main track is concatenated, the nodes of the video tracks are overlaid on top of it, and the
+// audio tracks are mixed
+func (f *FFmpegBuilder) TimelineFilter(tl video.Timeline) (string, error) {
+	graph, err := f.TimelineGraph(tl)
+	if err != nil {
+		return "", err
+	}
+	return graph.Render()
+}
+
+// TimelineGraph: returns the filtergraph to export a timeline (see TimelineFilter)
+func (f *FFmpegBuilder) TimelineGraph(tl video.Timeline) (*Graph, error) {
+	if len(tl.VideoNodes) == 0 {
+		return nil, fmt.Errorf("no video nodes were provided")
 	}
 
-	var concatQuery strings.Builder
-	var pos int
-	ridToPos := map[string]int{}
+	graph := NewGraph().Outputs("out", "aout")
+	ridToPos := inputPositions(tl)
 
-	concatQuery.WriteString("\"")
-	for i, videoNode := range videoNodes {
-		if pos, ok := ridToPos[videoNode.RID]; ok {
-			concatQuery.WriteString(fmt.Sprintf("[%d:v]trim=start=%.4f:end=%.4f,setpts=PTS-STARTPTS,scale=%s[v%d];", pos, videoNode.Start, videoNode.End, f.FilterGraphParams.Scale, i))
-			continue
+	// xfade requires all the segments to share the same frame rate and pixel format
+	transitions := hasTransitions(tl)
+	frameRate := tl.VideoNodes[0].FrameRate
+	if !frameRate.IsValid() {
+		frameRate = video.DefaultFrameRate()
+	}
+
+	for i, videoNode := range tl.VideoNodes {
+		segment := From(streamPad(ridToPos[videoNode.RID], "v")).
+			Filter("trim", Opt("start", videoNode.Start), Opt("end", videoNode.End)).
+			Filter("setpts", Opt("", setpts(videoNode))).
+			Filter("scale", Opt("", f.FilterGraphParams.Scale))
+		if transitions {
+			segment.Filter("fps", Opt("", frameRate)).Filter("format", Opt("", "yuv420p"))
 		}
-		ridToPos[videoNode.RID] = pos
-		concatQuery.WriteString(fmt.Sprintf("[%d:v]trim=start=%.4f:end=%.4f,setpts=PTS-STARTPTS,scale=%s[v%d];", pos, videoNode.Start, videoNode.End, f.FilterGraphParams.Scale, i))
-		pos += 1
+		graph.Add(segment.To(fmt.Sprintf("v%d", i)))
+		graph.Add(f.audioTrim(ridToPos[videoNode.RID], videoNode).To(fmt.Sprintf("a%d", i)))
+	}
+
+	overlays := 0
+	for _, track := range tl.VideoTracks {
+		overlays += len(track.Nodes)
+	}
+
+	audioTrackNodes := 0
+	for _, track := range tl.AudioTracks {
+		audioTrackNodes += len(track.Nodes)
 	}
 
-	for i := range videoNodes {
-		concatQuery.WriteString(fmt.Sprintf("[v%d]", i))
+	videoOut, audioOut := "out", "aout"
+	if overlays > 0 {
+		videoOut = "base"
+	}
+	if audioTrackNodes > 0 {
+		audioOut = "amain"
+	}
+	if transitions {
+		graph.Add(transitionFold(tl, videoOut, audioOut)...)
+	} else {
+		pads := []string{}
+		for i := range tl.VideoNodes {
+			pads = append(pads, fmt.Sprintf("v%d", i), fmt.Sprintf("a%d", i))
+		}
+		graph.Add(From(pads...).Filter("concat", concatOptions(len(tl.VideoNodes))...).To(videoOut, audioOut))
 	}
 
-	concatQuery.WriteString(fmt.Sprintf("concat=n=%d:v=1:a=0[out]\" -map \"[out]\"", len(videoNodes)))
-	return concatQuery.String(), nil
+	stage := 0
+	for t, track := range tl.VideoTracks {
+		for n, videoNode := range track.Nodes {
+			label := fmt.Sprintf("ov%d_%d", t, n)
+			graph.Add(From(streamPad(ridToPos[videoNode.RID], "v")).
+				Filter("trim", Opt("start", videoNode.Start), Opt("end", videoNode.End)).
+				Filter("setpts", Opt("", fmt.Sprintf("%s+%.4f/TB", setpts(videoNode), videoNode.Position))).
+				Filter("scale", Opt("", f.FilterGraphParams.Scale)).
+				To(label))
+
+			stage += 1
+			out := fmt.Sprintf("o%d", stage)
+			if stage == overlays {
+				out = "out"
+			}
+			graph.Add(From(videoOut, label).
+				Filter("overlay", Opt("eof_action", "pass"),
+					Expr("enable", fmt.Sprintf("between(t,%.4f,%.4f)", videoNode.Position, videoNode.Position+videoNode.Duration()))).
+				To(out))
+			videoOut = out
+		}
+	}
+
+	if audioTrackNodes > 0 {
+		audioPads := []string{audioOut}
+		for t, track := range tl.AudioTracks {
+			for n, videoNode := range track.Nodes {
+				label := fmt.Sprintf("a%d_%d", t, n)
+				graph.Add(f.audioTrim(ridToPos[videoNode.RID], videoNode).
+					Filter("adelay", Opt("", int64(videoNode.Position*1000)), Opt("all", 1)).
+					To(label))
+				audioPads = append(audioPads, label)
+			}
+		}
+		graph.Add(From(audioPads...).Filter("amix", Opt("inputs", audioTrackNodes+1), Opt("duration", "first")).To("aout"))
+	}
+
+	return graph, nil
 }
 
-// BuildQuery: returns the ffmpeg query with all the parameters given
-func (f *FFmpegBuilder) BuildQuery() (string, error) {
-	var cmd strings.Builder
-	cmd.WriteString(fmt.Sprintf("%s ", f.FFmpegPath))
+// streamPad: the pad of a stream of an input (0:v, 1:a)
+func streamPad(input int, stream string) string {
+	return fmt.Sprintf("%d:%s", input, stream)
+}
+
+// concatOptions: the options of a concat filter joining n segments with one video and one audio stream
+func concatOptions(n int) []Option {
+	return []Option{Opt("n", n), Opt("v", 1), Opt("a", 1)}
+}
+
+// hasTransitions: checks if any pair of adjacent video nodes of the main track has a transition
+func hasTransitions(tl video.Timeline) bool {
+	for i := range tl.VideoNodes {
+		if _, ok := tl.TransitionAfter(i); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionFold: joins the segments of the main track one at a time, adjacent segments are blended with
+// xfade/acrossfade when they have a transition and concatenated otherwise
+func transitionFold(tl video.Timeline, videoOut, audioOut string) []*Chain {
+	fold := []*Chain{}
+	prevVideo, prevAudio := "v0", "a0"
+	offset := tl.VideoNodes[0].Duration()
+
+	for i := 1; i < len(tl.VideoNodes); i++ {
+		outVideo, outAudio := fmt.Sprintf("xv%d", i), fmt.Sprintf("xa%d", i)
+		if i == len(tl.VideoNodes)-1 {
+			outVideo, outAudio = videoOut, audioOut
+		}
+		nextVideo, nextAudio := fmt.Sprintf("v%d", i), fmt.Sprintf("a%d", i)
+
+		duration := tl.VideoNodes[i].Duration()
+		if transition, ok := tl.TransitionAfter(i - 1); ok {
+			fold = append(fold,
+				From(prevVideo, nextVideo).Filter("xfade", Opt("transition", xfadeTransition(transition.Type)),
+					Opt("duration", transition.Duration), Opt("offset", offset-transition.Duration)).To(outVideo),
+				From(prevAudio, nextAudio).Filter("acrossfade", Opt("d", transition.Duration)).To(outAudio))
+			offset += duration - transition.Duration
+		} else {
+			fold = append(fold, From(prevVideo, prevAudio, nextVideo, nextAudio).Filter("concat", concatOptions(2)...).To(outVideo, outAudio))
+			offset += duration
+		}
+		prevVideo, prevAudio = outVideo, outAudio
+	}
+	return fold
+}
+
+// xfadeTransition: the xfade transition used for a timeline transition type
+func xfadeTransition(transitionType string) string {
+	switch transitionType {
+	case video.TRANSITION_DIP_TO_BLACK:
+		return "fadeblack"
+	case video.TRANSITION_WIPE:
+		return "wipeleft"
+	case video.TRANSITION_SLIDE:
+		return "slideleft"
+	}
+	return "fade"
+}
+
+// audioTrim: returns the audio chain of a video node, silence is generated if its source has no audio stream
+func (f *FFmpegBuilder) audioTrim(input int, videoNode video.VideoNode) *Chain {
+	if f.FilterGraphParams.SilentInputs[videoNode.RID] {
+		return From().Filter("anullsrc", Opt("channel_layout", "stereo"), Opt("sample_rate", 48000)).
+			Filter("atrim", Opt("duration", videoNode.Duration()))
+	}
+	chain := From(streamPad(input, "a")).
+		Filter("atrim", Opt("start", videoNode.Start), Opt("end", videoNode.End)).
+		Filter("asetpts", Opt("", "PTS-STARTPTS"))
+	return atempo(chain, videoNode.SpeedFactor())
+}
+
+// setpts: returns the setpts expression of a video node, its frames are retimed by its speed
+func setpts(videoNode video.VideoNode) string {
+	if speed := videoNode.SpeedFactor(); speed != 1 {
+		return fmt.Sprintf("(PTS-STARTPTS)/%.4f", speed)
+	}
+	return "PTS-STARTPTS"
+}
+
+// atempo: appends the atempo filters to change the speed of an audio stream to a chain. A single atempo only
+// accepts factors in [0.5, 2], other speeds are reached by chaining them
+func atempo(chain *Chain, speed float64) *Chain {
+	for speed > 2 {
+		chain.Filter("atempo", Opt("", "2.0"))
+		speed /= 2
+	}
+	for speed < 0.5 {
+		chain.Filter("atempo", Opt("", "0.5"))
+		speed /= 0.5
+	}
+	if speed != 1 {
+		chain.Filter("atempo", Opt("", speed))
+	}
+	return chain
+}
+
+// arg: an argument of the ffmpeg command, quote is how it is quoted in the display rendering of the query (none, ", ')
+type arg struct {
+	value string
+	quote byte
+}
+
+// args: returns the arguments of the ffmpeg command with all the parameters given
+func (f *FFmpegBuilder) args() []arg {
+	args := []arg{}
+	add := func(quote byte, values ...string) {
+		for _, value := range values {
+			args = append(args, arg{value: value, quote: quote})
+		}
+	}
 
 	if f.PreInputParams.HideBanner {
-		cmd.WriteString("-hide_banner ")
+		add(0, "-hide_banner")
 	}
 	if f.PreInputParams.VerboseMode != "" {
-		cmd.WriteString("-v ")
-		cmd.WriteString(f.PreInputParams.VerboseMode)
-		cmd.WriteString(" ")
+		add(0, "-v", f.PreInputParams.VerboseMode)
 	}
 	if f.PreInputParams.StatsPeriod != "" {
-		cmd.WriteString("-stats_period ")
-		cmd.WriteString(f.PreInputParams.StatsPeriod)
-		cmd.WriteString(" ")
+		add(0, "-stats_period", f.PreInputParams.StatsPeriod)
 	}
 	if f.PreInputParams.Progress != "" {
-		cmd.WriteString("-progress ")
-		cmd.WriteString(f.PreInputParams.Progress)
-		cmd.WriteString(" ")
+		add(0, "-progress", f.PreInputParams.Progress)
 	}
 
 	if f.PreInputParams.StartTime != 0 {
-		cmd.WriteString(fmt.Sprintf("-ss %.4f ", f.PreInputParams.StartTime))
+		add(0, "-ss", fmt.Sprintf("%.4f", f.PreInputParams.StartTime))
+	}
+	if f.PreInputParams.InputFormat != "" {
+		add(0, "-f", f.PreInputParams.InputFormat)
+	}
+	if f.PreInputParams.Safe != "" {
+		add(0, "-safe", f.PreInputParams.Safe)
 	}
 
 	// Append inputs
-	dups := make(map[string]struct{})
-	for _, input := range f.Inputs {
-		if _, ok := dups[input]; ok {
-			continue
-		}
-		cmd.WriteString("-i ")
-		cmd.WriteString(fmt.Sprintf("\"%s\"", input))
-		cmd.WriteString(" ")
-		dups[input] = struct{}{}
+	for _, input := range uniqueInputs(f.Inputs) {
+		add(0, "-i")
+		add('"', input)
 	}
 
 	// Append complex filter graph
 	if len(f.ComplexFilterGraph) > 0 {
-		cmd.WriteString("-filter_complex ")
-		for _, filterGraph := range f.ComplexFilterGraph {
-			cmd.WriteString(filterGraph)
-			cmd.WriteString(" ")
-		}
+		add(0, "-filter_complex")
+		add('"', strings.Join(f.ComplexFilterGraph, ";"))
+	}
+	for _, streamMap := range f.OutputParams.Maps {
+		add(0, "-map")
+		add('"', streamMap)
 	}
 
 	// Append output parameters
+	if f.OutputParams.MapMetadata != "" {
+		add(0, "-map_metadata", f.OutputParams.MapMetadata)
+	}
+	if f.OutputParams.MapChapters != "" {
+		add(0, "-map_chapters", f.OutputParams.MapChapters)
+	}
 	if f.OutputParams.NullOutput != "" {
-		cmd.WriteString(fmt.Sprintf("%s ", f.OutputParams.NullOutput))
+		add(0, strings.Fields(f.OutputParams.NullOutput)...)
 	}
 	if f.OutputParams.Duration != 0 {
-		cmd.WriteString(fmt.Sprintf("-t %.4f ", f.OutputParams.Duration))
+		add(0, "-t", fmt.Sprintf("%.4f", f.OutputParams.Duration))
 	}
 	if f.OutputParams.StopTime != 0 {
-		cmd.WriteString(fmt.Sprintf("-to %.4f ", f.OutputParams.StopTime))
+		add(0, "-to", fmt.Sprintf("%.4f", f.OutputParams.StopTime))
 	}
 
 	if f.OutputParams.AvoidNegativeTS != "" {
-		cmd.WriteString(fmt.Sprintf("-avoid_negative_ts %s ", f.OutputParams.AvoidNegativeTS))
+		add(0, "-avoid_negative_ts", f.OutputParams.AvoidNegativeTS)
 	}
 
 	if f.OutputParams.Codec != "" {
-		cmd.WriteString("-c ")
-		cmd.WriteString(f.OutputParams.Codec)
-		cmd.WriteString(" ")
+		add(0, "-c", f.OutputParams.Codec)
 	}
 	if f.OutputParams.VideoCodec != "" {
-		cmd.WriteString("-c:v ")
-		cmd.WriteString(f.OutputParams.VideoCodec)
-		cmd.WriteString(" ")
+		add(0, "-c:v", f.OutputParams.VideoCodec)
 	}
 	if f.OutputParams.AudioCodec != "" {
-		cmd.WriteString("-c:a ")
-		cmd.WriteString(f.OutputParams.AudioCodec)
-		cmd.WriteString(" ")
+		add(0, "-c:a", f.OutputParams.AudioCodec)
+	}
+	if f.OutputParams.AudioBitrate != "" {
+		add(0, "-b:a", f.OutputParams.AudioBitrate)
+	}
+	if f.OutputParams.VideoProfile != "" {
+		add(0, "-profile:v", f.OutputParams.VideoProfile)
+	}
+	if f.OutputParams.PixelFormat != "" {
+		add(0, "-pix_fmt", f.OutputParams.PixelFormat)
+	}
+	if f.OutputParams.FrameRate != "" {
+		add(0, "-r", f.OutputParams.FrameRate)
+	}
+	if f.OutputParams.TrackTimescale != "" {
+		add(0, "-video_track_timescale", f.OutputParams.TrackTimescale)
+	}
+	if f.OutputParams.SampleRate != "" {
+		add(0, "-ar", f.OutputParams.SampleRate)
+	}
+	if f.OutputParams.AudioChannels != "" {
+		add(0, "-ac", f.OutputParams.AudioChannels)
 	}
 
 	if f.OutputParams.MovFlags != "" {
-		cmd.WriteString(fmt.Sprintf("-movflags '%s' ", f.OutputParams.MovFlags))
+		add(0, "-movflags")
+		add('\'', f.OutputParams.MovFlags)
 	}
 
 	if f.OutputParams.CRF != "" {
-		cmd.WriteString("-crf ")
-		cmd.WriteString(f.OutputParams.CRF)
-		cmd.WriteString(" ")
+		add(0, "-crf", f.OutputParams.CRF)
 	}
 	if f.OutputParams.Preset != "" {
-		cmd.WriteString("-preset ")
-		cmd.WriteString(f.OutputParams.Preset)
-		cmd.WriteString(" ")
+		add(0, "-preset", f.OutputParams.Preset)
+	}
+	if f.OutputParams.GOP != "" {
+		add(0, "-g", f.OutputParams.GOP)
+	}
+	if f.OutputParams.VideoBitrate != "" {
+		add(0, "-b:v", f.OutputParams.VideoBitrate)
+	}
+	if f.OutputParams.MaxRate != "" {
+		add(0, "-maxrate", f.OutputParams.MaxRate)
+	}
+	if f.OutputParams.BufSize != "" {
+		add(0, "-bufsize", f.OutputParams.BufSize)
+	}
+	if f.OutputParams.Pass > 0 {
+		// libx265 does not read -pass, its passes are given as x265 parameters
+		if f.OutputParams.VideoCodec == video.CODEC_H265 {
+			add(0, "-x265-params")
+			add('"', fmt.Sprintf("pass=%d:stats=%s.log", f.OutputParams.Pass, f.OutputParams.PassLogFile))
+		} else {
+			add(0, "-pass", strconv.Itoa(f.OutputParams.Pass))
+			add(0, "-passlogfile")
+			add('"', f.OutputParams.PassLogFile)
+		}
 	}
 
 	if f.OutputParams.CopyTS {
-		cmd.WriteString("-copyts ")
+		add(0, "-copyts")
 	}
 
 	if f.OutputParams.VideoFrames != "" {
-		cmd.WriteString("-frames:v ")
-		cmd.WriteString(f.OutputParams.VideoFrames)
-		cmd.WriteString(" ")
+		add(0, "-frames:v", f.OutputParams.VideoFrames)
 	}
 	if f.OutputParams.Scale != "" {
-		cmd.WriteString("-s ")
-		cmd.WriteString(f.OutputParams.Scale)
-		cmd.WriteString(" ")
+		add(0, "-s", f.OutputParams.Scale)
 	}
 
 	// Append outputs
-	for _, output := range f.Outputs {
-		cmd.WriteString(fmt.Sprintf("\"%s\"", output))
-		cmd.WriteString(" ")
+	if f.OutputParams.OutputFormat != "" {
+		add(0, "-f", f.OutputParams.OutputFormat)
+	}
+	add('"', f.Outputs...)
+	return args
+}
+
+// BuildArgs: returns the arguments of the ffmpeg command, to be executed without a shell (exec.Command)
+func (f *FFmpegBuilder) BuildArgs() ([]string, error) {
+	args := []string{}
+	for _, a := range f.args() {
+		args = append(args, a.value)
 	}
+	return args, nil
+}
 
+// BuildCommand: returns the ffmpeg command with all the parameters given
+func (f *FFmpegBuilder) BuildCommand() (Command, error) {
+	args, err := f.BuildArgs()
+	if err != nil {
+		return Command{}, err
+	}
+	query, err := f.BuildQuery()
+	if err != nil {
+		return Command{}, err
+	}
+	return Command{Path: f.FFmpegPath, Args: args, Outputs: append([]string{}, f.Outputs...), query: query}, nil
+}
+
+// BuildQuery: returns the ffmpeg query with all the parameters given. The query is for display and
+// debugging only, commands are executed from their arguments (BuildArgs)
+func (f *FFmpegBuilder) BuildQuery() (string, error) {
+	var cmd strings.Builder
+	cmd.WriteString(fmt.Sprintf("%s ", f.FFmpegPath))
+	for _, a := range f.args() {
+		switch a.quote {
+		case '"':
+			cmd.WriteString(fmt.Sprintf("\"%s\"", displayEscaper.Replace(a.value)))
+		case '\'':
+			cmd.WriteString(fmt.Sprintf("'%s'", strings.ReplaceAll(a.value, "'", `'\''`)))
+		default:
+			cmd.WriteString(a.value)
+		}
+		cmd.WriteString(" ")
+	}
 	return cmd.String(), nil
 }
+
+// displayEscaper: escapes the characters that are special within double quotes in a shell
+var displayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
@@ -1,7 +1,10 @@
 package ffmpegbuilder
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/k1nho/gahara/internal/video"
@@ -31,6 +34,57 @@ func TestFFmpegBuilder(t *testing.T) {
 		}
 	})
 
+	t.Run("hostile filenames are passed as single arguments", func(t *testing.T) {
+		hostile := []string{
+			`my "quoted" clip`,
+			"$(touch pwned) and $HOME",
+			"`touch pwned`",
+			"it's; rm -rf ~ & echo",
+			`back\slash`,
+		}
+
+		for _, name := range hostile {
+			videoNode := video.VideoNode{RID: "inputs/" + name + ".mp4", ID: "1", Name: name, Start: 1, End: 2}
+			query, err := LosslessCutQuery("ffmpeg", videoNode, video.ProcessingOpts{OutputPath: "outputs", VideoFormat: ".mp4"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedArgs := []string{"-hide_banner", "-v", "quiet", "-stats_period", "5s", "-progress", "pipe:2", "-ss", "1.0000",
+				"-i", "inputs/" + name + ".mp4", "-t", "1.0000", "-avoid_negative_ts", "make_zero", "-c", "copy",
+				"-movflags", "+faststart", "outputs/" + name + ".mp4"}
+			if query.Path != "ffmpeg" || !slices.Equal(query.Args, expectedArgs) {
+				t.Errorf("\ngot: %q\nexp: %q", query.Args, expectedArgs)
+			}
+		}
+
+		// the display query escapes the characters that are special within double quotes
+		query, err := LosslessCutQuery("ffmpeg", video.VideoNode{RID: "in/" + hostile[1] + hostile[2], Name: "out", Start: 1, End: 2}, video.ProcessingOpts{OutputPath: "outputs", VideoFormat: ".mp4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "-i \"in/\\$(touch pwned) and \\$HOME\\`touch pwned\\`\" "; !strings.Contains(query.String(), expected) {
+			t.Errorf("\ngot: %s\nexp: %s", query.String(), expected)
+		}
+
+		query, err = MergeClipsQuery("ffmpeg", []video.VideoNode{{RID: hostile[0], ID: "1", Name: "a", Start: 0, End: 1}}, video.ProcessingOpts{
+			Resolution:  "640x480",
+			Codec:       "libx264",
+			CRF:         "23",
+			Preset:      "fast",
+			VideoFormat: ".mp4",
+			OutputPath:  "outputs",
+			Filename:    hostile[1],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := query.Args
+		if args[8] != hostile[0] || args[10][0] != '[' || args[12] != "[out]" || args[14] != "[aout]" || args[len(args)-1] != "outputs/"+hostile[1]+".mp4" {
+			t.Errorf("unexpected merge arguments: %q", args)
+		}
+	})
+
 	t.Run("generate proxy file query", func(t *testing.T) {
 		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"inputpath/input.mp4\" -c copy \"outputpath/input.mov\" "
 		query, err := CreateProxyFileQuery("ffmpeg", video.ProcessingOpts{
@@ -42,7 +96,7 @@ func TestFFmpegBuilder(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if query != expectedQuery {
+		if query.String() != expectedQuery {
 			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
 		}
 	})
@@ -58,13 +112,13 @@ func TestFFmpegBuilder(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if query != expectedQuery {
+		if query.String() != expectedQuery {
 			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
 		}
 	})
 
 	t.Run("concat filter query", func(t *testing.T) {
-		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -i \"root3\" -filter_complex \"[0:v]trim=start=20.1000:end=25.2000,setpts=PTS-STARTPTS,scale=1920x1080[v0];[0:v]trim=start=1.1200:end=10.2000,setpts=PTS-STARTPTS,scale=1920x1080[v1];[1:v]trim=start=12.2000:end=21.2000,setpts=PTS-STARTPTS,scale=1920x1080[v2];[2:v]trim=start=69.1120:end=80.2300,setpts=PTS-STARTPTS,scale=1920x1080[v3];[v0][v1][v2][v3]concat=n=4:v=1:a=0[out]\" -map \"[out]\" -c:v libx264 -crf 18 -preset medium \"outputpath/myvideo.mp4\" "
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -i \"root3\" -filter_complex \"[0:v]trim=start=20.1000:end=25.2000,setpts=PTS-STARTPTS,scale=1920x1080[v0];[0:a]atrim=start=20.1000:end=25.2000,asetpts=PTS-STARTPTS[a0];[0:v]trim=start=1.1200:end=10.2000,setpts=PTS-STARTPTS,scale=1920x1080[v1];[0:a]atrim=start=1.1200:end=10.2000,asetpts=PTS-STARTPTS[a1];[1:v]trim=start=12.2000:end=21.2000,setpts=PTS-STARTPTS,scale=1920x1080[v2];[1:a]atrim=start=12.2000:end=21.2000,asetpts=PTS-STARTPTS[a2];[2:v]trim=start=69.1120:end=80.2300,setpts=PTS-STARTPTS,scale=1920x1080[v3];[2:a]atrim=start=69.1120:end=80.2300,asetpts=PTS-STARTPTS[a3];[v0][a0][v1][a1][v2][a2][v3][a3]concat=n=4:v=1:a=1[out][aout]\" -map \"[out]\" -map \"[aout]\" -c:v libx264 -c:a aac -crf 18 -preset medium \"outputpath/myvideo.mp4\" "
 
 		query, err := MergeClipsQuery("ffmpeg", mockTl().VideoNodes, video.ProcessingOpts{
 			Resolution:  "1920x1080",
@@ -79,9 +133,185 @@ func TestFFmpegBuilder(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		if query != expectedQuery {
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("multi track timeline query", func(t *testing.T) {
+		tl := video.Timeline{
+			VideoNodes: []video.VideoNode{
+				{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 10},
+			},
+			VideoTracks: []video.Track{
+				{ID: "t1", Type: video.TRACK_VIDEO, Nodes: []video.VideoNode{
+					{RID: "root2", ID: "2", Name: "broll", Start: 5, End: 7, Position: 2},
+				}},
+			},
+			AudioTracks: []video.Track{
+				{ID: "t2", Type: video.TRACK_AUDIO, Nodes: []video.VideoNode{
+					{RID: "root3", ID: "3", Name: "music", Start: 0, End: 8, Position: 1.5},
+				}},
+			},
+		}
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -i \"root3\" -filter_complex \"[0:v]trim=start=0.0000:end=10.0000,setpts=PTS-STARTPTS,scale=1280x720[v0];[0:a]atrim=start=0.0000:end=10.0000,asetpts=PTS-STARTPTS[a0];[v0][a0]concat=n=1:v=1:a=1[base][amain];[1:v]trim=start=5.0000:end=7.0000,setpts=PTS-STARTPTS+2.0000/TB,scale=1280x720[ov0_0];[base][ov0_0]overlay=eof_action=pass:enable='between(t,2.0000,4.0000)'[out];[2:a]atrim=start=0.0000:end=8.0000,asetpts=PTS-STARTPTS,adelay=1500:all=1[a0_0];[amain][a0_0]amix=inputs=2:duration=first[aout]\" -map \"[out]\" -map \"[aout]\" -c:v libx264 -c:a aac -crf 18 -preset medium \"outputpath/myvideo.mp4\" "
+
+		query, err := MergeTimelineQuery("ffmpeg", tl, video.ProcessingOpts{
+			Resolution:  "1280x720",
+			Codec:       "libx264",
+			CRF:         "18",
+			Preset:      "medium",
+			VideoFormat: ".mp4",
+			OutputPath:  "outputpath",
+			Filename:    "myvideo",
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("concat filter query with silent input", func(t *testing.T) {
+		videoNodes := []video.VideoNode{
+			{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 2},
+			{RID: "root2", ID: "2", Name: "input2", Start: 1, End: 4},
+		}
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -filter_complex \"[0:v]trim=start=0.0000:end=2.0000,setpts=PTS-STARTPTS,scale=640x480[v0];[0:a]atrim=start=0.0000:end=2.0000,asetpts=PTS-STARTPTS[a0];[1:v]trim=start=1.0000:end=4.0000,setpts=PTS-STARTPTS,scale=640x480[v1];anullsrc=channel_layout=stereo:sample_rate=48000,atrim=duration=3.0000[a1];[v0][a0][v1][a1]concat=n=2:v=1:a=1[out][aout]\" -map \"[out]\" -map \"[aout]\" -c:v libvpx-vp9 -c:a libopus -b:a 192k -crf 23 -preset fast \"outputpath/myvideo.webm\" "
+
+		query, err := MergeClipsQuery("ffmpeg", videoNodes, video.ProcessingOpts{
+			Resolution:   "640x480",
+			Codec:        "libvpx-vp9",
+			CRF:          "23",
+			Preset:       "fast",
+			AudioBitrate: "192k",
+			VideoFormat:  ".webm",
+			OutputPath:   "outputpath",
+			Filename:     "myvideo",
+		}, "root2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("timeline query with transitions", func(t *testing.T) {
+		tl := video.Timeline{
+			VideoNodes: []video.VideoNode{
+				{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 4},
+				{RID: "root2", ID: "2", Name: "input2", Start: 1, End: 4},
+				{RID: "root1", ID: "3", Name: "input3", Start: 5, End: 7},
+			},
+			Transitions: []video.Transition{{ID: "t1", From: "1", To: "2", Type: video.TRANSITION_DIP_TO_BLACK, Duration: 1}},
+		}
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -filter_complex \"[0:v]trim=start=0.0000:end=4.0000,setpts=PTS-STARTPTS,scale=1920x1080,fps=30/1,format=yuv420p[v0];[0:a]atrim=start=0.0000:end=4.0000,asetpts=PTS-STARTPTS[a0];[1:v]trim=start=1.0000:end=4.0000,setpts=PTS-STARTPTS,scale=1920x1080,fps=30/1,format=yuv420p[v1];[1:a]atrim=start=1.0000:end=4.0000,asetpts=PTS-STARTPTS[a1];[0:v]trim=start=5.0000:end=7.0000,setpts=PTS-STARTPTS,scale=1920x1080,fps=30/1,format=yuv420p[v2];[0:a]atrim=start=5.0000:end=7.0000,asetpts=PTS-STARTPTS[a2];[v0][v1]xfade=transition=fadeblack:duration=1.0000:offset=3.0000[xv1];[a0][a1]acrossfade=d=1.0000[xa1];[xv1][xa1][v2][a2]concat=n=2:v=1:a=1[out][aout]\" -map \"[out]\" -map \"[aout]\" -c:v libx264 -c:a aac -crf 23 -preset medium \"outputpath/myvideo.mp4\" "
+
+		query, err := MergeTimelineQuery("ffmpeg", tl, video.ProcessingOpts{
+			Resolution:  "1920x1080",
+			Codec:       "libx264",
+			CRF:         "23",
+			Preset:      "medium",
+			VideoFormat: ".mp4",
+			OutputPath:  "outputpath",
+			Filename:    "myvideo",
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+
+		tl.Transitions[0].Duration = 3.5
+		if _, err := MergeTimelineQuery("ffmpeg", tl, video.ProcessingOpts{
+			Resolution:  "1920x1080",
+			Codec:       "libx264",
+			CRF:         "23",
+			Preset:      "medium",
+			VideoFormat: ".mp4",
+			OutputPath:  "outputpath",
+			Filename:    "myvideo",
+		}, ""); err == nil || !strings.Contains(err.Error(), "transition") {
+			t.Errorf("expected a transition longer than its clip to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("timeline query with chapters", func(t *testing.T) {
+		tl := video.Timeline{
+			VideoNodes: []video.VideoNode{
+				{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 4},
+				{RID: "root2", ID: "2", Name: "input2", Start: 0, End: 6},
+			},
+			Markers: []video.Marker{
+				{ID: "m1", Name: "Intro", Position: 0},
+				{ID: "m2", Name: "Take #2; final=yes", Position: 4.5},
+				{ID: "m3", Name: "After the end", Position: 20},
+			},
+		}
+		expectedMetadata := ";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=4500\ntitle=Intro\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=4500\nEND=10000\ntitle=Take \\#2\\; final\\=yes\n"
+
+		metadata, err := ChaptersMetadata(tl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata != expectedMetadata {
+			t.Errorf("\ngot: %s\nexp: %s", metadata, expectedMetadata)
+		}
+
+		query, err := MergeTimelineQuery("ffmpeg", tl, video.ProcessingOpts{
+			Resolution:  "1280x720",
+			Codec:       "libx264",
+			CRF:         "23",
+			Preset:      "medium",
+			VideoFormat: ".mkv",
+			OutputPath:  "outputpath",
+			Filename:    "myvideo",
+		}, "project/chapters.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(query.String(), "-i \"root2\" -i \"project/chapters.txt\" -filter_complex") || !strings.Contains(query.String(), "-map_metadata 2 -map_chapters 2 ") {
+			t.Errorf("expected the chapters to be mapped from the last input, got: %s", query)
+		}
+
+		if _, err := ChaptersMetadata(video.Timeline{VideoNodes: tl.VideoNodes}); err == nil {
+			t.Errorf("expected a timeline without markers to have no chapters")
+		}
+	})
+
+	t.Run("concat filter query with speed changes", func(t *testing.T) {
+		videoNodes := []video.VideoNode{
+			{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 2, Speed: 0.25},
+			{RID: "root2", ID: "2", Name: "input2", Start: 1, End: 7, Speed: 3},
+		}
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -filter_complex \"[0:v]trim=start=0.0000:end=2.0000,setpts=(PTS-STARTPTS)/0.2500,scale=640x480[v0];[0:a]atrim=start=0.0000:end=2.0000,asetpts=PTS-STARTPTS,atempo=0.5,atempo=0.5000[a0];[1:v]trim=start=1.0000:end=7.0000,setpts=(PTS-STARTPTS)/3.0000,scale=640x480[v1];anullsrc=channel_layout=stereo:sample_rate=48000,atrim=duration=2.0000[a1];[v0][a0][v1][a1]concat=n=2:v=1:a=1[out][aout]\" -map \"[out]\" -map \"[aout]\" -c:v libx264 -c:a aac -crf 23 -preset fast \"outputpath/myvideo.mp4\" "
+
+		query, err := MergeClipsQuery("ffmpeg", videoNodes, video.ProcessingOpts{
+			Resolution:  "640x480",
+			Codec:       "libx264",
+			CRF:         "23",
+			Preset:      "fast",
+			VideoFormat: ".mp4",
+			OutputPath:  "outputpath",
+			Filename:    "myvideo",
+		}, "root2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if query.String() != expectedQuery {
 			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
 		}
+
+		if _, err := LosslessCutQuery("ffmpeg", videoNodes[0], video.ProcessingOpts{OutputPath: "outputpath", VideoFormat: ".mp4"}); err == nil {
+			t.Errorf("expected a clip with a speed change to be rejected for lossless export")
+		}
 	})
 
 	t.Run("lossless cut query", func(t *testing.T) {
@@ -99,8 +329,86 @@ func TestFFmpegBuilder(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if query != expectedQuery {
+		if query.String() != expectedQuery {
 			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
 		}
 	})
+
+	t.Run("lossless merge query", func(t *testing.T) {
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -f concat -safe 0 -i \"segments/segments.txt\" -c copy -movflags '+faststart' \"outputpath/merged.mp4\" "
+
+		query, err := LosslessMergeQuery("ffmpeg", "segments/segments.txt", video.ProcessingOpts{
+			OutputPath:  "outputpath",
+			Filename:    "merged",
+			VideoFormat: ".mp4",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("two-pass timeline query", func(t *testing.T) {
+		opts := video.ProcessingOpts{
+			Resolution: "1920x1080", Codec: "libx264", Preset: "slow", VideoFormat: ".mp4", OutputPath: "outputpath", Filename: "myvideo",
+			RateControl: video.RATE_CONTROL_BITRATE, VideoBitrate: "5M", MaxRate: "6M", BufSize: "10M", TwoPass: true,
+		}
+		queries, err := MergeTimelinePasses("ffmpeg", *mockTl(), opts, "", "logs/pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queries) != 2 {
+			t.Fatalf("expected 2 passes, got %d", len(queries))
+		}
+
+		firstPass, secondPass := queries[0].String(), queries[1].String()
+		if !strings.HasSuffix(firstPass, "-c:v libx264 -c:a aac -preset slow -b:v 5M -maxrate 6M -bufsize 10M -pass 1 -passlogfile \"logs/pass\" -f null \"-\" ") {
+			t.Errorf("unexpected first pass: %s", firstPass)
+		}
+		if !strings.HasSuffix(secondPass, "-c:v libx264 -c:a aac -preset slow -b:v 5M -maxrate 6M -bufsize 10M -pass 2 -passlogfile \"logs/pass\" \"outputpath/myvideo.mp4\" ") {
+			t.Errorf("unexpected second pass: %s", secondPass)
+		}
+
+		opts.Codec = "libx265"
+		queries, err = MergeTimelinePasses("ffmpeg", *mockTl(), opts, "", "logs/pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(queries[0].String(), "-x265-params \"pass=1:stats=logs/pass.log\"") {
+			t.Errorf("expected the passes of libx265 as x265 parameters, got %s", queries[0].String())
+		}
+	})
+
+	t.Run("target size timeline query", func(t *testing.T) {
+		opts := video.ProcessingOpts{
+			Resolution: "1920x1080", Codec: "libx264", Preset: "medium", VideoFormat: ".mp4", OutputPath: "outputpath", Filename: "myvideo",
+			RateControl: video.RATE_CONTROL_TARGET_SIZE, TargetSize: 25,
+		}
+		queries, err := MergeTimelinePasses("ffmpeg", *mockTl(), opts, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 25MB over the 34.298s of the timeline, without the container overhead and 128k of audio
+		if len(queries) != 1 || !strings.Contains(queries[0].String(), "-preset medium -b:v 5586k \"outputpath/myvideo.mp4\"") {
+			t.Errorf("unexpected target size query: %v", queries)
+		}
+		if strings.Contains(queries[0].String(), "-crf") {
+			t.Errorf("expected no constant rate factor with a target size, got %s", queries[0].String())
+		}
+	})
+
+	t.Run("invalid merge query reports every missing field", func(t *testing.T) {
+		_, err := MergeClipsQuery("ffmpeg", mockTl().VideoNodes, video.ProcessingOpts{Codec: "libx264", VideoFormat: ".mp4", OutputPath: "outputpath", Filename: "myvideo"})
+		var verr *video.ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("expected a *video.ValidationError, got %v", err)
+		}
+		for _, field := range []string{"resolution", "preset", "crf"} {
+			if !verr.HasField(field) {
+				t.Errorf("expected a violation of %s, got %+v", field, verr.Violations)
+			}
+		}
+	})
 }
@@ -0,0 +1,226 @@
+// filtergraph.go: implements a typed filtergraph (chains of filters connected by named pads) for -filter_complex
+package ffmpegbuilder
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// padLabelRegex: the characters allowed in a pad label
+	padLabelRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	// streamPadRegex: a stream of an input file (0:v, 1:a, 2:v:0), they are not produced by the graph
+	streamPadRegex = regexp.MustCompile(`^[0-9]+:[vas](:[0-9]+)?$`)
+	// optionEscaper: escapes the characters that are special within the value of a filter option
+	optionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	// graphEscaper: escapes the characters that are special within a filtergraph description
+	graphEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// Option: an option of a filter, positional when it has no key
+type Option struct {
+	// Key: the name of the option (empty for a positional option)
+	Key string
+	// value: the rendered value of the option
+	value string
+}
+
+// Opt: creates a filter option, the value is formatted by its type (float64 with 4 decimals) and escaped
+func Opt(key string, value any) Option {
+	var rendered string
+	switch v := value.(type) {
+	case string:
+		rendered = v
+	case float64:
+		rendered = fmt.Sprintf("%.4f", v)
+	case int:
+		rendered = fmt.Sprintf("%d", v)
+	case int64:
+		rendered = fmt.Sprintf("%d", v)
+	case bool:
+		rendered = "0"
+		if v {
+			rendered = "1"
+		}
+	case fmt.Stringer:
+		rendered = v.String()
+	default:
+		rendered = fmt.Sprint(v)
+	}
+	return Option{Key: key, value: graphEscaper.Replace(optionEscaper.Replace(rendered))}
+}
+
+// Expr: creates a filter option with an ffmpeg expression, the expression is quoted as a whole (between(t,1,2))
+func Expr(key string, expr string) Option {
+	return Option{Key: key, value: "'" + strings.ReplaceAll(expr, "'", `'\''`) + "'"}
+}
+
+func (o Option) String() string {
+	if o.Key == "" {
+		return o.value
+	}
+	return o.Key + "=" + o.value
+}
+
+// Filter: a filter of the graph with its options (trim, scale, concat)
+type Filter struct {
+	// Name: the name of the ffmpeg filter
+	Name string
+	// Options: the options of the filter, in order
+	Options []Option
+}
+
+func (f Filter) String() string {
+	if len(f.Options) == 0 {
+		return f.Name
+	}
+	options := make([]string, len(f.Options))
+	for i, option := range f.Options {
+		options[i] = option.String()
+	}
+	return f.Name + "=" + strings.Join(options, ":")
+}
+
+// Chain: a sequence of filters, the output of a filter is the input of the next one. The inputs are the pads
+// consumed by the first filter, and the outputs are the pads produced by the last filter
+type Chain struct {
+	inputs  []string
+	filters []Filter
+	outputs []string
+}
+
+// From: starts a chain that consumes the given pads (labels or input streams), no pads for source filters
+func From(inputs ...string) *Chain {
+	return &Chain{inputs: inputs}
+}
+
+// Filter: appends a filter to the chain
+func (c *Chain) Filter(name string, options ...Option) *Chain {
+	c.filters = append(c.filters, Filter{Name: name, Options: options})
+	return c
+}
+
+// To: sets the pads produced by the chain
+func (c *Chain) To(outputs ...string) *Chain {
+	c.outputs = append(c.outputs, outputs...)
+	return c
+}
+
+func (c *Chain) String() string {
+	var chain strings.Builder
+	for _, input := range c.inputs {
+		chain.WriteString("[" + input + "]")
+	}
+	filters := make([]string, len(c.filters))
+	for i, filter := range c.filters {
+		filters[i] = filter.String()
+	}
+	chain.WriteString(strings.Join(filters, ","))
+	for _, output := range c.outputs {
+		chain.WriteString("[" + output + "]")
+	}
+	return chain.String()
+}
+
+// Graph: the chains of a filtergraph, the pads that are not consumed by another chain are the outputs of the graph
+type Graph struct {
+	chains  []*Chain
+	outputs []string
+}
+
+func NewGraph() *Graph {
+	return &Graph{chains: []*Chain{}, outputs: []string{}}
+}
+
+// Add: appends chains to the graph
+func (g *Graph) Add(chains ...*Chain) *Graph {
+	g.chains = append(g.chains, chains...)
+	return g
+}
+
+// Outputs: declares the pads that are outputs of the graph (mapped to the output file)
+func (g *Graph) Outputs(outputs ...string) *Graph {
+	g.outputs = append(g.outputs, outputs...)
+	return g
+}
+
+// extendOutput: adds a chain consuming an output of the graph, the outputs of the chain replace it as outputs of the graph
+func (g *Graph) extendOutput(output string, chain *Chain) *Graph {
+	if idx := slices.Index(g.outputs, output); idx >= 0 {
+		g.outputs = slices.Replace(g.outputs, idx, idx+1, chain.outputs...)
+	}
+	return g.Add(chain)
+}
+
+// Maps: the -map arguments of the outputs of the graph ([out])
+func (g *Graph) Maps() []string {
+	maps := make([]string, len(g.outputs))
+	for i, output := range g.outputs {
+		maps[i] = "[" + output + "]"
+	}
+	return maps
+}
+
+// Validate: checks that the pads are valid labels, produced once, and consumed once (or declared as outputs)
+func (g *Graph) Validate() error {
+	produced := map[string]int{}
+	consumed := map[string]int{}
+	for i, chain := range g.chains {
+		if len(chain.filters) == 0 {
+			return fmt.Errorf("chain %d of the filtergraph has no filters", i)
+		}
+		for _, input := range chain.inputs {
+			if streamPadRegex.MatchString(input) {
+				continue
+			}
+			if !padLabelRegex.MatchString(input) {
+				return fmt.Errorf("invalid pad label [%s]", input)
+			}
+			consumed[input] += 1
+		}
+		for _, output := range chain.outputs {
+			if !padLabelRegex.MatchString(output) {
+				return fmt.Errorf("invalid pad label [%s]", output)
+			}
+			produced[output] += 1
+		}
+	}
+	for _, output := range g.outputs {
+		consumed[output] += 1
+	}
+
+	for pad, n := range produced {
+		if n > 1 {
+			return fmt.Errorf("pad [%s] is produced %d times", pad, n)
+		}
+		if consumed[pad] == 0 {
+			return fmt.Errorf("pad [%s] is not connected to any input", pad)
+		}
+	}
+	for pad, n := range consumed {
+		if produced[pad] == 0 {
+			return fmt.Errorf("pad [%s] is not produced by the filtergraph", pad)
+		}
+		if n > 1 {
+			return fmt.Errorf("pad [%s] is consumed %d times", pad, n)
+		}
+	}
+	return nil
+}
+
+// Render: returns the filtergraph description to be used in -filter_complex
+func (g *Graph) Render() (string, error) {
+	if len(g.chains) == 0 {
+		return "", fmt.Errorf("the filtergraph is empty")
+	}
+	if err := g.Validate(); err != nil {
+		return "", err
+	}
+	chains := make([]string, len(g.chains))
+	for i, chain := range g.chains {
+		chains[i] = chain.String()
+	}
+	return strings.Join(chains, ";"), nil
+}
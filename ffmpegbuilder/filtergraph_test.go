@@ -0,0 +1,94 @@
+package ffmpegbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFiltergraph(t *testing.T) {
+	t.Parallel()
+
+	t.Run("render chains", func(t *testing.T) {
+		expectedGraph := "[0:v]trim=start=1.5000:end=3.0000,setpts=PTS-STARTPTS[v0];[0:a]atrim=start=1.5000:end=3.0000[a0];" +
+			"[v0][a0]concat=n=1:v=1:a=1[out][aout]"
+		graph := NewGraph().Outputs("out", "aout").Add(
+			From("0:v").Filter("trim", Opt("start", 1.5), Opt("end", 3.0)).Filter("setpts", Opt("", "PTS-STARTPTS")).To("v0"),
+			From("0:a").Filter("atrim", Opt("start", 1.5), Opt("end", 3.0)).To("a0"),
+			From("v0", "a0").Filter("concat", Opt("n", 1), Opt("v", 1), Opt("a", 1)).To("out", "aout"),
+		)
+		rendered, err := graph.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered != expectedGraph {
+			t.Errorf("\ngot: %s\nexp: %s", rendered, expectedGraph)
+		}
+		if maps := graph.Maps(); len(maps) != 2 || maps[0] != "[out]" || maps[1] != "[aout]" {
+			t.Errorf("expected the maps [out] [aout], got %v", maps)
+		}
+	})
+
+	t.Run("options are escaped", func(t *testing.T) {
+		expectedFilter := `drawtext=text=it\\\'s 10\\:00\, \[live\]\;:fontsize=24:box=1:enable='between(t,1,2)'`
+		filter := Filter{Name: "drawtext", Options: []Option{
+			Opt("text", "it's 10:00, [live];"), Opt("fontsize", 24), Opt("box", true), Expr("enable", "between(t,1,2)"),
+		}}
+		if filter.String() != expectedFilter {
+			t.Errorf("\ngot: %s\nexp: %s", filter.String(), expectedFilter)
+		}
+	})
+
+	t.Run("pads must be connected and unique", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			graph *Graph
+			err   string
+		}{
+			{
+				name: "duplicated output",
+				graph: NewGraph().Outputs("out").Add(
+					From("0:v").Filter("null").To("v0"),
+					From("1:v").Filter("null").To("v0"),
+					From("v0").Filter("null").To("out"),
+				),
+				err: "produced 2 times",
+			},
+			{
+				name: "consumed twice",
+				graph: NewGraph().Outputs("out", "out2").Add(
+					From("0:v").Filter("null").To("v0"),
+					From("v0").Filter("null").To("out"),
+					From("v0").Filter("null").To("out2"),
+				),
+				err: "consumed 2 times",
+			},
+			{
+				name:  "dangling output",
+				graph: NewGraph().Outputs("out").Add(From("0:v").Filter("null").To("out"), From("0:a").Filter("anull").To("a0")),
+				err:   "not connected",
+			},
+			{
+				name:  "missing input",
+				graph: NewGraph().Outputs("out").Add(From("v0").Filter("null").To("out")),
+				err:   "not produced",
+			},
+			{
+				name:  "invalid label",
+				graph: NewGraph().Outputs("out").Add(From("0:v").Filter("null").To("out];[x")),
+				err:   "invalid pad label",
+			},
+			{
+				name:  "chain without filters",
+				graph: NewGraph().Outputs("out").Add(From("0:v").To("out")),
+				err:   "no filters",
+			},
+		}
+
+		for _, test := range tests {
+			_, err := test.graph.Render()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", test.name, test.err, err)
+			}
+		}
+	})
+}
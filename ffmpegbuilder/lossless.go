@@ -0,0 +1,152 @@
+// lossless.go: implements the preflight and the concat list of a lossless export of the whole timeline
+package ffmpegbuilder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/k1nho/gahara/internal/probe"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// LosslessBlocker: a reason why the timeline cannot be exported losslessly
+type LosslessBlocker struct {
+	// ID: the id of the video node that blocks the export (empty if the timeline blocks it)
+	ID string `json:"id,omitempty"`
+	// Name: the name of the video node
+	Name string `json:"name,omitempty"`
+	// Position: the position of the video node in the main track (-1 if the timeline blocks it)
+	Position int `json:"position"`
+	// Reason: why the node cannot be copied into the export
+	Reason string `json:"reason"`
+}
+
+// LosslessReport: the result of the lossless preflight of a timeline
+type LosslessReport struct {
+	// Lossless: the timeline can be exported without re-encoding
+	Lossless bool `json:"lossless"`
+	// Blockers: the reasons that block the lossless export
+	Blockers []LosslessBlocker `json:"blockers"`
+}
+
+// Error: describes the blockers of the report as an error, nil if the timeline can be exported losslessly
+func (r LosslessReport) Error() error {
+	if r.Lossless {
+		return nil
+	}
+	reasons := make([]string, len(r.Blockers))
+	for i, blocker := range r.Blockers {
+		reasons[i] = blocker.Reason
+		if blocker.Name != "" {
+			reasons[i] = fmt.Sprintf("%s: %s", blocker.Name, blocker.Reason)
+		}
+	}
+	return fmt.Errorf("the timeline cannot be exported losslessly (%s)", strings.Join(reasons, "; "))
+}
+
+/*
+LosslessPreflight: checks if the main track of a timeline can be exported losslessly, its segments are copied
+and joined by the concat demuxer. The other tracks, transitions, and speed changes require re-encoding, and all
+the sources must share the codec parameters of the first one. infos are the probed sources of the nodes
+*/
+func LosslessPreflight(tl video.Timeline, infos map[string]probe.MediaInfo) LosslessReport {
+	report := LosslessReport{Blockers: []LosslessBlocker{}}
+	block := func(pos int, reason string) {
+		blocker := LosslessBlocker{Position: pos, Reason: reason}
+		if pos >= 0 {
+			blocker.ID, blocker.Name = tl.VideoNodes[pos].ID, tl.VideoNodes[pos].Name
+		}
+		report.Blockers = append(report.Blockers, blocker)
+	}
+
+	if len(tl.VideoNodes) == 0 {
+		block(-1, "the main track is empty")
+	}
+	for _, track := range tl.VideoTracks {
+		if len(track.Nodes) > 0 {
+			block(-1, fmt.Sprintf("video track %s is overlaid on the main track", track.Name))
+		}
+	}
+	for _, track := range tl.AudioTracks {
+		if len(track.Nodes) > 0 {
+			block(-1, fmt.Sprintf("audio track %s is mixed into the main track", track.Name))
+		}
+	}
+
+	var reference probe.MediaInfo
+	for pos, videoNode := range tl.VideoNodes {
+		if videoNode.SpeedFactor() != 1 {
+			block(pos, fmt.Sprintf("its speed is %.2fx", videoNode.SpeedFactor()))
+		}
+		if transition, ok := tl.TransitionAfter(pos); ok {
+			block(pos, fmt.Sprintf("it has a %s transition to the next clip", transition.Type))
+		}
+
+		info, ok := infos[videoNode.RID]
+		if !ok {
+			block(pos, "its media could not be probed")
+			continue
+		}
+		if !info.HasVideo() {
+			block(pos, "its media has no video stream")
+			continue
+		}
+		if reference.Streams == nil {
+			reference = info
+			continue
+		}
+		if mismatch := codecMismatch(reference, info); mismatch != "" {
+			block(pos, fmt.Sprintf("%s differs from the first clip", mismatch))
+		}
+	}
+
+	report.Lossless = len(report.Blockers) == 0
+	return report
+}
+
+// codecMismatch: describes the first codec parameter of media that differs from the reference (empty if none)
+func codecMismatch(reference, media probe.MediaInfo) string {
+	refVideo, _ := reference.VideoStream()
+	mediaVideo, _ := media.VideoStream()
+	switch {
+	case refVideo.CodecName != mediaVideo.CodecName:
+		return fmt.Sprintf("video codec %s", mediaVideo.CodecName)
+	case refVideo.Profile != mediaVideo.Profile:
+		return fmt.Sprintf("video profile %s", mediaVideo.Profile)
+	case refVideo.Width != mediaVideo.Width || refVideo.Height != mediaVideo.Height:
+		return fmt.Sprintf("resolution %dx%d", mediaVideo.Width, mediaVideo.Height)
+	case refVideo.PixelFormat != mediaVideo.PixelFormat:
+		return fmt.Sprintf("pixel format %s", mediaVideo.PixelFormat)
+	case refVideo.FrameRate != mediaVideo.FrameRate:
+		return fmt.Sprintf("frame rate %s", mediaVideo.FrameRate.String())
+	case refVideo.Rotation != mediaVideo.Rotation:
+		return fmt.Sprintf("rotation %d", mediaVideo.Rotation)
+	}
+
+	refAudio, mediaAudio := reference.AudioStreams(), media.AudioStreams()
+	if len(refAudio) != len(mediaAudio) {
+		return fmt.Sprintf("the number of audio streams (%d)", len(mediaAudio))
+	}
+	for i := range refAudio {
+		switch {
+		case refAudio[i].CodecName != mediaAudio[i].CodecName:
+			return fmt.Sprintf("audio codec %s", mediaAudio[i].CodecName)
+		case refAudio[i].SampleRate != mediaAudio[i].SampleRate:
+			return fmt.Sprintf("sample rate %d", mediaAudio[i].SampleRate)
+		case refAudio[i].Channels != mediaAudio[i].Channels:
+			return fmt.Sprintf("audio channels %d", mediaAudio[i].Channels)
+		}
+	}
+	return ""
+}
+
+// ConcatList: returns the concat demuxer script that joins the given segments in order
+func ConcatList(segments []string) string {
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for _, segment := range segments {
+		// paths are single quoted, a quote is closed, escaped, and reopened
+		list.WriteString(fmt.Sprintf("file '%s'\n", strings.ReplaceAll(segment, "'", `'\''`)))
+	}
+	return list.String()
+}
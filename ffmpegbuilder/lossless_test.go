@@ -0,0 +1,82 @@
+package ffmpegbuilder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/k1nho/gahara/internal/probe"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func mockMediaInfo(codec string, width, height int) probe.MediaInfo {
+	return probe.MediaInfo{Streams: []probe.Stream{
+		{Index: 0, CodecType: probe.STREAM_VIDEO, CodecName: codec, Width: width, Height: height, PixelFormat: "yuv420p", FrameRate: video.Rational{Num: 30, Den: 1}},
+		{Index: 1, CodecType: probe.STREAM_AUDIO, CodecName: "aac", SampleRate: 48000, Channels: 2},
+	}}
+}
+
+func TestLosslessPreflight(t *testing.T) {
+	t.Parallel()
+
+	infos := map[string]probe.MediaInfo{
+		"root1": mockMediaInfo("h264", 1920, 1080),
+		"root2": mockMediaInfo("h264", 1920, 1080),
+		"root3": mockMediaInfo("hevc", 1920, 1080),
+	}
+
+	t.Run("matching sources are lossless", func(t *testing.T) {
+		tl := video.Timeline{VideoNodes: []video.VideoNode{
+			{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 5},
+			{RID: "root2", ID: "2", Name: "input2", Start: 2, End: 4},
+			{RID: "root1", ID: "3", Name: "input3", Start: 7, End: 9},
+		}}
+		report := LosslessPreflight(tl, infos)
+		if !report.Lossless || len(report.Blockers) != 0 || report.Error() != nil {
+			t.Errorf("expected a lossless report, got %+v", report)
+		}
+	})
+
+	t.Run("blockers are reported per node", func(t *testing.T) {
+		tl := video.Timeline{
+			VideoNodes: []video.VideoNode{
+				{RID: "root1", ID: "1", Name: "input1", Start: 0, End: 5},
+				{RID: "root3", ID: "2", Name: "input2", Start: 2, End: 4},
+				{RID: "root2", ID: "3", Name: "input3", Start: 7, End: 9, Speed: 2},
+				{RID: "missing", ID: "4", Name: "input4", Start: 0, End: 1},
+			},
+			AudioTracks: []video.Track{{ID: "a1", Name: "music", Type: video.TRACK_AUDIO, Nodes: []video.VideoNode{{RID: "root1", ID: "5", Start: 0, End: 1}}}},
+		}
+		report := LosslessPreflight(tl, infos)
+		if report.Lossless {
+			t.Fatal("expected the timeline to be blocked")
+		}
+
+		expected := []struct {
+			pos    int
+			reason string
+		}{
+			{pos: -1, reason: "audio track music"},
+			{pos: 1, reason: "video codec hevc"},
+			{pos: 2, reason: "speed"},
+			{pos: 3, reason: "could not be probed"},
+		}
+		if len(report.Blockers) != len(expected) {
+			t.Fatalf("expected %d blockers, got %+v", len(expected), report.Blockers)
+		}
+		for i, blocker := range report.Blockers {
+			if blocker.Position != expected[i].pos || !strings.Contains(blocker.Reason, expected[i].reason) {
+				t.Errorf("blocker %d: expected %q at %d, got %+v", i, expected[i].reason, expected[i].pos, blocker)
+			}
+		}
+		if err := report.Error(); err == nil || !strings.Contains(err.Error(), "input2: video codec hevc") {
+			t.Errorf("expected the error to name the blocked nodes, got %v", err)
+		}
+	})
+}
+
+func TestConcatList(t *testing.T) {
+	expectedList := "ffconcat version 1.0\nfile '/tmp/segment0000.mp4'\nfile '/tmp/it'\\''s/segment0001.mp4'\n"
+	if list := ConcatList([]string{"/tmp/segment0000.mp4", "/tmp/it's/segment0001.mp4"}); list != expectedList {
+		t.Errorf("\ngot: %s\nexp: %s", list, expectedList)
+	}
+}
@@ -0,0 +1,66 @@
+// preview.go: implements the render of the low resolution preview of the timeline, one segment per window
+package ffmpegbuilder
+
+import (
+	"fmt"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// PREVIEW_WIDTH, PREVIEW_HEIGHT: the size of the preview, the clips are scaled to it as to the resolution of an export
+	PREVIEW_WIDTH  = 640
+	PREVIEW_HEIGHT = 360
+	// PREVIEW_FRAME_RATE: the frame rate of the preview, the segments share it so they are joined without re-encoding
+	PREVIEW_FRAME_RATE = 30
+	// PREVIEW_GOP: the frames between two keyframes of the preview (half a second), the preview is scrubbed
+	PREVIEW_GOP = "15"
+	// PREVIEW_PRESET, PREVIEW_CRF: the preview favours the speed of the encoding over its quality
+	PREVIEW_PRESET = "ultrafast"
+	PREVIEW_CRF    = "30"
+	// PREVIEW_TIMESCALE: the timescale of the video track of the segments, shared to join them
+	PREVIEW_TIMESCALE = "15360"
+)
+
+/*
+PreviewSegmentQuery: returns the command that renders a window of the timeline (see video.Timeline.Windows) to a
+segment of the preview. The window is rendered with the filtergraph of the export (main track with its transitions,
+video tracks and audio tracks), and every segment is encoded with the same low resolution parameters, so the
+segments of the timeline are joined without re-encoding (see LosslessMergeQuery). silentInputs are the inputs
+without an audio stream
+*/
+func PreviewSegmentQuery(FFmpegPath string, window video.Timeline, output string, silentInputs ...string) (Command, error) {
+	if len(window.VideoNodes) == 0 || window.Duration() <= 0 {
+		return Command{}, fmt.Errorf("the window has no duration to preview")
+	}
+	if err := window.ValidateTransitions(); err != nil {
+		return Command{}, err
+	}
+
+	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(ExtractTimelineInputs(window)...).
+		WithFScale(fmt.Sprintf("%dx%d", PREVIEW_WIDTH, PREVIEW_HEIGHT)).WithSilentInputs(silentInputs...).
+		WithVideoCodec(video.CODEC_H264).WithPreset(PREVIEW_PRESET).WithCRF(PREVIEW_CRF).WithGOP(PREVIEW_GOP).
+		WithAudioCodec(video.AUDIO_CODEC_AAC).WithAudioBitrate("96k").WithSampleRate("48000").WithAudioChannels("2").
+		WithTrackTimescale(PREVIEW_TIMESCALE).WithMovFlags("+faststart").WithOutputs(output)
+
+	graph, err := querybuilder.TimelineGraph(window)
+	if err != nil {
+		return Command{}, err
+	}
+	graph.extendOutput("out", From("out").
+		Filter("setsar", Opt("", 1)).
+		Filter("fps", Opt("", PREVIEW_FRAME_RATE)).
+		Filter("format", Opt("", "yuv420p")).
+		To("preview"))
+	filter, err := graph.Render()
+	if err != nil {
+		return Command{}, err
+	}
+	querybuilder.ComplexFilterGraph = append(querybuilder.ComplexFilterGraph, filter)
+	querybuilder.WithMaps(graph.Maps()...)
+
+	if err := querybuilder.validateMergeQuery(); err != nil {
+		return Command{}, err
+	}
+	return querybuilder.BuildCommand()
+}
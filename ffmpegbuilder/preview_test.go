@@ -0,0 +1,50 @@
+package ffmpegbuilder
+
+import (
+	"testing"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func TestPreviewSegmentQuery(t *testing.T) {
+	t.Parallel()
+
+	window := video.Timeline{
+		VideoNodes: []video.VideoNode{
+			{ID: "0", RID: "root1", Name: "input1", Start: 8, End: 10},
+			{ID: "1", RID: "root2", Name: "input2", Start: 0, End: 6, Speed: 2},
+		},
+		Transitions: []video.Transition{{ID: "0", From: "0", To: "1", Type: "fade", Duration: 1}},
+		VideoTracks: []video.Track{{ID: "v1", Type: video.TRACK_VIDEO, Nodes: []video.VideoNode{{ID: "0", RID: "root3", Start: 0, End: 2, Position: 1}}}},
+	}
+
+	t.Run("the window is rendered with the export graph", func(t *testing.T) {
+		t.Parallel()
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -i \"root1\" -i \"root2\" -i \"root3\" -filter_complex " +
+			"\"[0:v]trim=start=8.0000:end=10.0000,setpts=PTS-STARTPTS,scale=640x360,fps=30/1,format=yuv420p[v0];" +
+			"[0:a]atrim=start=8.0000:end=10.0000,asetpts=PTS-STARTPTS[a0];" +
+			"[1:v]trim=start=0.0000:end=6.0000,setpts=(PTS-STARTPTS)/2.0000,scale=640x360,fps=30/1,format=yuv420p[v1];" +
+			"anullsrc=channel_layout=stereo:sample_rate=48000,atrim=duration=3.0000[a1];" +
+			"[v0][v1]xfade=transition=fade:duration=1.0000:offset=1.0000[base];[a0][a1]acrossfade=d=1.0000[aout];" +
+			"[2:v]trim=start=0.0000:end=2.0000,setpts=PTS-STARTPTS+1.0000/TB,scale=640x360[ov0_0];" +
+			"[base][ov0_0]overlay=eof_action=pass:enable='between(t,1.0000,3.0000)'[out];" +
+			"[out]setsar=1,fps=30,format=yuv420p[preview]\" " +
+			"-map \"[preview]\" -map \"[aout]\" -c:v libx264 -c:a aac -b:a 96k -video_track_timescale 15360 -ar 48000 -ac 2 " +
+			"-movflags '+faststart' -crf 30 -preset ultrafast -g 15 \"preview/segment.mp4\" "
+		query, err := PreviewSegmentQuery("ffmpeg", window, "preview/segment.mp4", "root2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("empty window", func(t *testing.T) {
+		t.Parallel()
+		empty := video.Timeline{VideoNodes: []video.VideoNode{{ID: "0", RID: "root1", Name: "input1", Start: 4, End: 4}}}
+		if _, err := PreviewSegmentQuery("ffmpeg", empty, "preview/segment.mp4"); err == nil {
+			t.Error("expected a window without duration to be rejected")
+		}
+	})
+}
@@ -2,22 +2,13 @@
 package ffmpegbuilder
 
 import (
+	"fmt"
+
 	"github.com/k1nho/gahara/internal/video"
 )
 
-func CheckVideoDuration(FFmpegPath string, userOpts video.ProcessingOpts) (string, error) {
-	input := GetFullInputPath(userOpts)
-
-	query, err := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(input).
-		WithNullOutput().WithVerbose("").BuildQuery()
-	if err != nil {
-		return "", err
-	}
-	return query, nil
-}
-
 // CreateProxyFileQuery: creates a proxy file for a video
-func CreateProxyFileQuery(FFmpegPath string, userOpts video.ProcessingOpts, format string) (string, error) {
+func CreateProxyFileQuery(FFmpegPath string, userOpts video.ProcessingOpts, format string) (Command, error) {
 	input := GetFullInputPath(userOpts)
 	userOpts.VideoFormat = format
 	output := GetFullOutputPath(userOpts)
@@ -26,71 +17,169 @@ func CreateProxyFileQuery(FFmpegPath string, userOpts video.ProcessingOpts, form
 		WithOutputs(output)
 
 	if err := querybuilder.validateProxyFileCreationQuery(); err != nil {
-		return "", err
+		return Command{}, err
 	}
 
-	query, err := querybuilder.BuildQuery()
-	if err != nil {
-		return "", err
-	}
-
-	return query, nil
+	return querybuilder.BuildCommand()
 }
 
 // CreateThumbnailQuery: generates a thumbnail taking the 1 frame of a video
-func CreateThumbnailQuery(FFmpegPath string, userOpts video.ProcessingOpts, format string) (string, error) {
+func CreateThumbnailQuery(FFmpegPath string, userOpts video.ProcessingOpts, format string) (Command, error) {
 	input := GetFullInputPath(userOpts)
 	userOpts.VideoFormat = format
 	output := GetFullOutputPath(userOpts)
 
-	query, err := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(input).WithScale(userOpts.Resolution).
-		WithVideoFrames("1").WithOutputs(output).BuildQuery()
+	return NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(input).WithScale(userOpts.Resolution).
+		WithVideoFrames("1").WithOutputs(output).BuildCommand()
+}
+
+// MergeClipsQuery: returns the query to concatenate a series of video nodes, silentInputs are the
+// inputs without an audio stream
+func MergeClipsQuery(FFmpegPath string, videoNodes []video.VideoNode, userOpts video.ProcessingOpts, silentInputs ...string) (Command, error) {
+	return MergeTimelineQuery(FFmpegPath, video.Timeline{VideoNodes: videoNodes}, userOpts, "", silentInputs...)
+}
+
+// MergeTimelineQuery: returns the query to export a timeline (main track, video tracks, and audio tracks),
+// chaptersPath is an ffmpeg metadata file with the chapters of the export (none if empty), silentInputs are
+// the inputs without an audio stream
+func MergeTimelineQuery(FFmpegPath string, tl video.Timeline, userOpts video.ProcessingOpts, chaptersPath string, silentInputs ...string) (Command, error) {
+	querybuilder, err := timelineQueryBuilder(FFmpegPath, tl, userOpts, chaptersPath, silentInputs...)
 	if err != nil {
-		return "", err
+		return Command{}, err
 	}
+	return querybuilder.BuildCommand()
+}
 
-	return query, nil
+/*
+MergeTimelinePasses: returns the queries to export a timeline in order, a single query or the two passes of a
+two-pass encoding. The first pass writes its statistics to passLogFile and discards its output, the second pass
+reads them to encode the export (see MergeTimelineQuery)
+*/
+func MergeTimelinePasses(FFmpegPath string, tl video.Timeline, userOpts video.ProcessingOpts, chaptersPath string, passLogFile string, silentInputs ...string) ([]Command, error) {
+	if !userOpts.TwoPass {
+		query, err := MergeTimelineQuery(FFmpegPath, tl, userOpts, chaptersPath, silentInputs...)
+		if err != nil {
+			return nil, err
+		}
+		return []Command{query}, nil
+	}
+	if passLogFile == "" {
+		return nil, fmt.Errorf("no pass log file was provided")
+	}
+
+	firstPass, err := timelineQueryBuilder(FFmpegPath, tl, userOpts, "", silentInputs...)
+	if err != nil {
+		return nil, err
+	}
+	firstPass.Outputs = []string{"-"}
+	firstPass.WithPass(1, passLogFile).WithOutputFormat("null")
+
+	secondPass, err := timelineQueryBuilder(FFmpegPath, tl, userOpts, chaptersPath, silentInputs...)
+	if err != nil {
+		return nil, err
+	}
+	secondPass.WithPass(2, passLogFile)
+
+	queries := []Command{}
+	for _, querybuilder := range []*FFmpegBuilder{firstPass, secondPass} {
+		query, err := querybuilder.BuildCommand()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
 }
 
-// MergeClipsQuery: returns the query to concatenate a series of video nodes
-func MergeClipsQuery(FFmpegPath string, videoNodes []video.VideoNode, userOpts video.ProcessingOpts) (string, error) {
-	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(ExtractInputs(videoNodes)...).
-		WithPreset(userOpts.Preset).WithCRF(userOpts.CRF).WithVideoCodec(userOpts.Codec).
-		WithFScale(userOpts.Resolution).WithOutputs(GetFullOutputPath(userOpts))
+// timelineQueryBuilder: returns the validated builder of the query to export a timeline
+func timelineQueryBuilder(FFmpegPath string, tl video.Timeline, userOpts video.ProcessingOpts, chaptersPath string, silentInputs ...string) (*FFmpegBuilder, error) {
+	if err := tl.ValidateTransitions(); err != nil {
+		return nil, err
+	}
+
+	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(ExtractTimelineInputs(tl)...).
+		WithPreset(userOpts.Preset).WithVideoCodec(userOpts.Codec).
+		WithAudioCodec(userOpts.GetAudioCodec()).WithAudioBitrate(userOpts.AudioBitrate).
+		WithFScale(userOpts.Resolution).WithSilentInputs(silentInputs...).WithOutputs(GetFullOutputPath(userOpts))
+	if err := querybuilder.withRateControl(tl, userOpts); err != nil {
+		return nil, err
+	}
 
-	concatFilterQuery, err := querybuilder.ConcatFilter(videoNodes)
+	graph, err := querybuilder.TimelineGraph(tl)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	timelineFilterQuery, err := graph.Render()
+	if err != nil {
+		return nil, err
 	}
 
-	querybuilder.ComplexFilterGraph = append(querybuilder.ComplexFilterGraph, concatFilterQuery)
+	querybuilder.ComplexFilterGraph = append(querybuilder.ComplexFilterGraph, timelineFilterQuery)
+	querybuilder.WithMaps(graph.Maps()...)
+	// the metadata file is the last input, so the input positions of the filtergraph are kept
+	if chaptersPath != "" {
+		querybuilder.WithChapters(chaptersPath)
+	}
 	if err := querybuilder.validateMergeQuery(); err != nil {
-		return "", err
+		return nil, err
 	}
+	return querybuilder, nil
+}
 
-	query, err := querybuilder.BuildQuery()
-	if err != nil {
-		return "", err
+// withRateControl: sets how the bitrate of the video is chosen, a constant rate factor, a target bitrate, or the
+// bitrate that fits the timeline in a target size
+func (f *FFmpegBuilder) withRateControl(tl video.Timeline, userOpts video.ProcessingOpts) error {
+	switch userOpts.GetRateControl() {
+	case video.RATE_CONTROL_CRF:
+		f.WithCRF(userOpts.CRF)
+	case video.RATE_CONTROL_BITRATE:
+		f.WithVideoBitrate(userOpts.VideoBitrate)
+	case video.RATE_CONTROL_TARGET_SIZE:
+		bitrate, err := userOpts.TargetVideoBitrate(tl.Duration())
+		if err != nil {
+			return err
+		}
+		f.WithVideoBitrate(bitrate)
+	default:
+		return fmt.Errorf("invalid rate control %s", userOpts.RateControl)
 	}
-	return query, nil
+	f.WithRateLimit(userOpts.MaxRate, userOpts.BufSize)
+	return nil
 }
 
-// LosslessCutQuery: returns the query string to make a lossless cut of a video node
-func LosslessCutQuery(FFmpegPath string, videoNode video.VideoNode, userOpts video.ProcessingOpts) (string, error) {
+// LosslessCutQuery: returns the command to make a lossless cut of a video node
+func LosslessCutQuery(FFmpegPath string, videoNode video.VideoNode, userOpts video.ProcessingOpts) (Command, error) {
 	// overwrite filename, if it was passed by default lossy opts
 	userOpts.Filename = videoNode.Name
+	return LosslessSegmentQuery(FFmpegPath, videoNode, GetFullOutputPath(userOpts))
+}
+
+// LosslessSegmentQuery: returns the command to copy the interval of a video node to an output without re-encoding
+func LosslessSegmentQuery(FFmpegPath string, videoNode video.VideoNode, output string) (Command, error) {
+	// streams are copied, so their speed cannot change
+	if videoNode.SpeedFactor() != 1 {
+		return Command{}, fmt.Errorf("%s cannot be exported losslessly at %.2fx speed", videoNode.Name, videoNode.SpeedFactor())
+	}
 
 	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(videoNode.RID).WithInputStartTime(videoNode.Start).
 		WithOutputDuration(videoNode.End - videoNode.Start).WithCodec("copy").WithAvoidNegativeTS("make_zero").
-		WithMovFlags("+faststart").WithOutputs(GetFullOutputPath(userOpts))
+		WithMovFlags("+faststart").WithOutputs(output)
 
 	if err := querybuilder.validateLosslessCutQuery(); err != nil {
-		return "", err
+		return Command{}, err
 	}
 
-	query, err := querybuilder.BuildQuery()
-	if err != nil {
-		return "", err
+	return querybuilder.BuildCommand()
+}
+
+// LosslessMergeQuery: returns the command that joins the segments of a concat list (see ConcatList) without re-encoding
+func LosslessMergeQuery(FFmpegPath string, listPath string, userOpts video.ProcessingOpts) (Command, error) {
+	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithConcatDemuxer().WithInputs(listPath).WithCodec("copy").
+		WithMovFlags("+faststart").WithOutputs(GetFullOutputPath(userOpts))
+
+	if err := querybuilder.validateLosslessCutQuery(); err != nil {
+		return Command{}, err
 	}
-	return query, nil
+
+	return querybuilder.BuildCommand()
 }
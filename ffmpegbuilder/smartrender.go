@@ -0,0 +1,174 @@
+// smartrender.go: implements smart rendering, the GOPs within a cut are copied and only its edges are re-encoded
+package ffmpegbuilder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/k1nho/gahara/internal/probe"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// keyframeTolerance: a cut point closer than this to a keyframe (in seconds) is on the keyframe
+const keyframeTolerance = 0.001
+
+// RenderSegment: an interval of the source of a video node, it is either copied or re-encoded
+type RenderSegment struct {
+	// Start: the start of the segment in the source (seconds)
+	Start float64 `json:"start"`
+	// End: the end of the segment in the source (seconds)
+	End float64 `json:"end"`
+	// Copy: the segment starts on a keyframe and ends before one, so its packets are copied
+	Copy bool `json:"copy"`
+}
+
+/*
+SmartRenderPlan: splits the interval of a video node in segments given the keyframes of its source. The GOPs fully
+inside the interval are copied, the partial GOPs at its edges are re-encoded. A cut without a whole GOP is re-encoded.
+Ex: [1.5, 9.2] with keyframes 0, 2, 4, 6, 8 -> encode [1.5, 2], copy [2, 8], encode [8, 9.2]
+*/
+func SmartRenderPlan(videoNode video.VideoNode, keyframes []float64) []RenderSegment {
+	start, end := videoNode.Start, videoNode.End
+	first, last := 0.0, 0.0
+	hasFirst, hasLast := false, false
+	for _, keyframe := range keyframes {
+		if !hasFirst && keyframe >= start-keyframeTolerance {
+			first, hasFirst = keyframe, true
+		}
+		if keyframe <= end+keyframeTolerance {
+			last, hasLast = keyframe, true
+		}
+	}
+
+	if !hasFirst || !hasLast || last-first < keyframeTolerance {
+		return []RenderSegment{{Start: start, End: end}}
+	}
+
+	segments := []RenderSegment{}
+	if first-start > keyframeTolerance {
+		segments = append(segments, RenderSegment{Start: start, End: first})
+	}
+	segments = append(segments, RenderSegment{Start: first, End: last, Copy: true})
+	if end-last > keyframeTolerance {
+		segments = append(segments, RenderSegment{Start: last, End: end})
+	}
+	return segments
+}
+
+// SmartRenderParams: the encoding parameters of the re-encoded segments, they match the source so the copied
+// and re-encoded segments can be joined
+type SmartRenderParams struct {
+	// VideoEncoder: the encoder of the video codec of the source (libx264)
+	VideoEncoder string
+	// VideoProfile: the profile of the source, in the naming of the encoder (high)
+	VideoProfile string
+	// PixelFormat: the pixel format of the source (yuv420p)
+	PixelFormat string
+	// FrameRate: the frame rate of the source (30000/1001)
+	FrameRate string
+	// Timescale: the denominator of the time base of the source video stream (15360)
+	Timescale string
+	// AudioEncoder: the encoder of the audio codec of the source (empty if it has no audio)
+	AudioEncoder string
+	// SampleRate: the sample rate of the source audio
+	SampleRate string
+	// Channels: the number of channels of the source audio
+	Channels string
+	// CRF: the constant rate factor of the re-encoded segments
+	CRF string
+	// Preset: the preset of the re-encoded segments
+	Preset string
+}
+
+// NewSmartRenderParams: returns the encoding parameters that match a probed source, the quality of the
+// re-encoded segments is given by the crf and preset of the user options
+func NewSmartRenderParams(info probe.MediaInfo, userOpts video.ProcessingOpts) (SmartRenderParams, error) {
+	stream, ok := info.VideoStream()
+	if !ok {
+		return SmartRenderParams{}, fmt.Errorf("the source has no video stream")
+	}
+	encoder, ok := getSmartRenderVideoEncoders()[stream.CodecName]
+	if !ok {
+		return SmartRenderParams{}, fmt.Errorf("smart rendering does not support %s video, export it with a full re-encode", stream.CodecName)
+	}
+
+	params := SmartRenderParams{
+		VideoEncoder: encoder,
+		VideoProfile: encoderProfile(stream.Profile),
+		PixelFormat:  stream.PixelFormat,
+		CRF:          userOpts.CRF,
+		Preset:       userOpts.Preset,
+	}
+	if stream.FrameRate.IsValid() {
+		params.FrameRate = stream.FrameRate.String()
+	}
+	if _, den, ok := strings.Cut(stream.TimeBase, "/"); ok {
+		params.Timescale = den
+	}
+	if params.CRF == "" {
+		params.CRF = video.CRF_18
+	}
+	if params.Preset == "" {
+		params.Preset = video.PRESET_MEDIUM
+	}
+
+	if audio := info.AudioStreams(); len(audio) > 0 {
+		encoder, ok := getSmartRenderAudioEncoders()[audio[0].CodecName]
+		if !ok && !strings.HasPrefix(audio[0].CodecName, "pcm_") {
+			return SmartRenderParams{}, fmt.Errorf("smart rendering does not support %s audio, export it with a full re-encode", audio[0].CodecName)
+		} else if !ok {
+			encoder = audio[0].CodecName
+		}
+		params.AudioEncoder = encoder
+		if audio[0].SampleRate > 0 {
+			params.SampleRate = strconv.Itoa(audio[0].SampleRate)
+		}
+		if audio[0].Channels > 0 {
+			params.Channels = strconv.Itoa(audio[0].Channels)
+		}
+	}
+	return params, nil
+}
+
+// getSmartRenderVideoEncoders: the encoders of the video codecs supported by smart rendering
+func getSmartRenderVideoEncoders() map[string]string {
+	return map[string]string{"h264": "libx264", "hevc": "libx265"}
+}
+
+// getSmartRenderAudioEncoders: the encoders of the audio codecs supported by smart rendering (pcm is encoded as is)
+func getSmartRenderAudioEncoders() map[string]string {
+	return map[string]string{
+		"aac": "aac", "mp3": "libmp3lame", "opus": "libopus", "vorbis": "libvorbis", "ac3": "ac3", "flac": "flac",
+	}
+}
+
+// encoderProfile: maps a profile reported by ffprobe to the profile of x264/x265 (Constrained Baseline -> baseline, Main 10 -> main10)
+func encoderProfile(profile string) string {
+	return strings.NewReplacer(" ", "", ":", "", "predictive", "", "constrained", "").Replace(strings.ToLower(profile))
+}
+
+// SmartRenderSegmentQuery: returns the command that renders a segment of a video node, copied segments are cut
+// losslessly, and the other segments are re-encoded with the parameters of the source
+func SmartRenderSegmentQuery(FFmpegPath string, videoNode video.VideoNode, segment RenderSegment, params SmartRenderParams, output string) (Command, error) {
+	videoNode.Start, videoNode.End = segment.Start, segment.End
+	if segment.Copy {
+		return LosslessSegmentQuery(FFmpegPath, videoNode, output)
+	}
+
+	querybuilder := NewDefaultFFmpegBuilder(FFmpegPath).WithInputs(videoNode.RID).WithInputStartTime(videoNode.Start).
+		WithOutputDuration(videoNode.End - videoNode.Start).WithAvoidNegativeTS("make_zero").
+		WithVideoCodec(params.VideoEncoder).WithVideoProfile(params.VideoProfile).WithPixelFormat(params.PixelFormat).
+		WithFrameRate(params.FrameRate).WithAudioCodec(params.AudioEncoder).WithSampleRate(params.SampleRate).
+		WithAudioChannels(params.Channels).WithCRF(params.CRF).WithPreset(params.Preset).WithOutputs(output)
+	// the timescale is an option of the mov muxer, copied segments keep the one of the source
+	if ext := filepath.Ext(output); ext == ".mp4" || ext == ".mov" {
+		querybuilder.WithTrackTimescale(params.Timescale).WithMovFlags("+faststart")
+	}
+
+	if err := querybuilder.validateLosslessCutQuery(); err != nil {
+		return Command{}, err
+	}
+	return querybuilder.BuildCommand()
+}
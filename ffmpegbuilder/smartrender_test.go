@@ -0,0 +1,99 @@
+package ffmpegbuilder
+
+import (
+	"testing"
+
+	"github.com/k1nho/gahara/internal/probe"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func TestSmartRenderPlan(t *testing.T) {
+	t.Parallel()
+
+	keyframes := []float64{0, 2, 4, 6, 8}
+	tests := []struct {
+		name       string
+		start, end float64
+		expected   []RenderSegment
+	}{
+		{
+			name: "edges are re-encoded", start: 1.5, end: 9.2,
+			expected: []RenderSegment{{Start: 1.5, End: 2}, {Start: 2, End: 8, Copy: true}, {Start: 8, End: 9.2}},
+		},
+		{
+			name: "cut on keyframes is copied", start: 2, end: 6,
+			expected: []RenderSegment{{Start: 2, End: 6, Copy: true}},
+		},
+		{
+			name: "cut within a GOP is re-encoded", start: 4.2, end: 5.9,
+			expected: []RenderSegment{{Start: 4.2, End: 5.9}},
+		},
+		{
+			name: "cut across a single keyframe is re-encoded", start: 3.5, end: 4.5,
+			expected: []RenderSegment{{Start: 3.5, End: 4.5}},
+		},
+		{
+			name: "start on a keyframe", start: 0, end: 5,
+			expected: []RenderSegment{{Start: 0, End: 4, Copy: true}, {Start: 4, End: 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := SmartRenderPlan(video.VideoNode{RID: "root1", Start: tt.start, End: tt.end}, keyframes)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSmartRenderSegmentQuery(t *testing.T) {
+	t.Parallel()
+
+	info := probe.MediaInfo{Streams: []probe.Stream{
+		{Index: 0, CodecType: probe.STREAM_VIDEO, CodecName: "h264", Profile: "Constrained Baseline", PixelFormat: "yuv420p", FrameRate: video.Rational{Num: 30000, Den: 1001}, TimeBase: "1/30000"},
+		{Index: 1, CodecType: probe.STREAM_AUDIO, CodecName: "aac", SampleRate: 48000, Channels: 2},
+	}}
+	params, err := NewSmartRenderParams(info, video.ProcessingOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoNode := video.VideoNode{RID: "root1", Name: "input1", Start: 1.5, End: 9.2}
+
+	t.Run("edge segment is re-encoded with the source parameters", func(t *testing.T) {
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -ss 8.0000 -i \"root1\" -t 1.2000 -avoid_negative_ts make_zero " +
+			"-c:v libx264 -c:a aac -profile:v baseline -pix_fmt yuv420p -r 30000/1001 -video_track_timescale 30000 -ar 48000 -ac 2 " +
+			"-movflags '+faststart' -crf 18 -preset medium \"segments/segment0000_2.mp4\" "
+		query, err := SmartRenderSegmentQuery("ffmpeg", videoNode, RenderSegment{Start: 8, End: 9.2}, params, "segments/segment0000_2.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("inner segment is copied", func(t *testing.T) {
+		expectedQuery := "ffmpeg -hide_banner -v quiet -stats_period 5s -progress pipe:2 -ss 2.0000 -i \"root1\" -t 6.0000 -avoid_negative_ts make_zero -c copy -movflags '+faststart' \"segments/segment0000_1.mp4\" "
+		query, err := SmartRenderSegmentQuery("ffmpeg", videoNode, RenderSegment{Start: 2, End: 8, Copy: true}, params, "segments/segment0000_1.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.String() != expectedQuery {
+			t.Errorf("\ngot: %s\nexp: %s", query, expectedQuery)
+		}
+	})
+
+	t.Run("unsupported codecs are rejected", func(t *testing.T) {
+		info := probe.MediaInfo{Streams: []probe.Stream{{Index: 0, CodecType: probe.STREAM_VIDEO, CodecName: "prores"}}}
+		if _, err := NewSmartRenderParams(info, video.ProcessingOpts{}); err == nil {
+			t.Error("expected prores to be rejected")
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package ffmpegbuilder
 
 import (
+	"fmt"
+	"math"
 	"path"
+	"strings"
 
 	"github.com/k1nho/gahara/internal/video"
 )
@@ -15,6 +18,76 @@ func ExtractInputs(videoNodes []video.VideoNode) []string {
 	return inputs
 }
 
+// ExtractTimelineInputs: extract input params from all the tracks of a timeline (main, video, and audio tracks)
+func ExtractTimelineInputs(tl video.Timeline) []string {
+	inputs := ExtractInputs(tl.VideoNodes)
+	for _, track := range tl.VideoTracks {
+		inputs = append(inputs, ExtractInputs(track.Nodes)...)
+	}
+	for _, track := range tl.AudioTracks {
+		inputs = append(inputs, ExtractInputs(track.Nodes)...)
+	}
+	return inputs
+}
+
+// inputPositions: maps every root id of a timeline to its input stream index (inputs are deduplicated)
+func inputPositions(tl video.Timeline) map[string]int {
+	ridToPos := map[string]int{}
+	for _, input := range ExtractTimelineInputs(tl) {
+		if _, ok := ridToPos[input]; !ok {
+			ridToPos[input] = len(ridToPos)
+		}
+	}
+	return ridToPos
+}
+
+// uniqueInputs: removes the repeated inputs, keeping the order in which they first appear
+func uniqueInputs(inputs []string) []string {
+	unique := []string{}
+	dups := make(map[string]struct{})
+	for _, input := range inputs {
+		if _, ok := dups[input]; ok {
+			continue
+		}
+		unique = append(unique, input)
+		dups[input] = struct{}{}
+	}
+	return unique
+}
+
+// ChaptersMetadata: returns an ffmpeg metadata file with a chapter for every marker of the timeline,
+// a chapter lasts until the next marker or the end of the timeline
+func ChaptersMetadata(tl video.Timeline) (string, error) {
+	duration := tl.Duration()
+	var metadata strings.Builder
+	metadata.WriteString(";FFMETADATA1\n")
+
+	chapters := 0
+	for i, marker := range tl.Markers {
+		end := duration
+		if i+1 < len(tl.Markers) && tl.Markers[i+1].Position < end {
+			end = tl.Markers[i+1].Position
+		}
+		startMs, endMs := int64(math.Round(marker.Position*1000)), int64(math.Round(end*1000))
+		if startMs >= endMs {
+			continue
+		}
+		metadata.WriteString(fmt.Sprintf("[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", startMs, endMs, escapeMetadata(marker.Name)))
+		chapters += 1
+	}
+
+	if chapters == 0 {
+		return "", fmt.Errorf("the timeline has no markers to export as chapters")
+	}
+	return metadata.String(), nil
+}
+
+// escapeMetadata: escapes the special characters of an ffmpeg metadata value (=, ;, #, \, newline)
+func escapeMetadata(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+	return replacer.Replace(value)
+}
+
 // getFullOutputPath: gets the full export path of the video
 func GetFullOutputPath(opts video.ProcessingOpts) string {
 	return path.Join(opts.OutputPath, opts.Filename+opts.VideoFormat)
@@ -1,54 +1,61 @@
 package ffmpegbuilder
 
-import "fmt"
+import "github.com/k1nho/gahara/internal/video"
 
+// validateMergeQuery: checks the builder of a merge query, the fields are named as in video.ProcessingOpts
 func (f *FFmpegBuilder) validateMergeQuery() error {
+	verr := &video.ValidationError{}
 	if len(f.Inputs) == 0 {
-		return fmt.Errorf("no input stream was provided")
+		verr.Add("inputs", video.VALIDATION_REQUIRED, "no input stream was provided")
 	}
 	if len(f.Outputs) == 0 {
-		return fmt.Errorf("no output stream was provided")
+		verr.Add("outputs", video.VALIDATION_REQUIRED, "no output stream was provided")
 	}
 	if f.FilterGraphParams.Scale == "" {
-		return fmt.Errorf("no resolution was provided. For this operations clips need to have the same resolution")
+		verr.Add("resolution", video.VALIDATION_REQUIRED, "no resolution was provided. For this operations clips need to have the same resolution")
 	}
 	if f.OutputParams.VideoCodec == "" {
-		return fmt.Errorf("no codec was provided")
+		verr.Add("codec", video.VALIDATION_REQUIRED, "no codec was provided")
+	}
+	if f.OutputParams.AudioCodec == "" {
+		verr.Add("audio_codec", video.VALIDATION_REQUIRED, "no audio codec was provided")
 	}
 
 	if f.OutputParams.Preset == "" {
-		return fmt.Errorf("no preset was provided")
+		verr.Add("preset", video.VALIDATION_REQUIRED, "no preset was provided")
 	}
-	if f.OutputParams.CRF == "" {
-		return fmt.Errorf("no constant rate factor was provided")
+	if f.OutputParams.CRF == "" && f.OutputParams.VideoBitrate == "" {
+		verr.Add("crf", video.VALIDATION_REQUIRED, "no constant rate factor or video bitrate was provided")
 	}
-	return nil
+	return verr.Err()
 }
 
 func (f *FFmpegBuilder) validateLosslessCutQuery() error {
+	verr := &video.ValidationError{}
 	if len(f.Inputs) != 1 {
-		return fmt.Errorf("no input stream(s) provided")
+		verr.Add("inputs", video.VALIDATION_REQUIRED, "no input stream(s) provided")
 	}
 	if len(f.Outputs) != 1 {
-		return fmt.Errorf("no output stream(s) provided")
+		verr.Add("outputs", video.VALIDATION_REQUIRED, "no output stream(s) provided")
 	}
 
 	if f.OutputParams.Duration < 0 {
-		return fmt.Errorf("specified duration of the clip is negative")
+		verr.Add("duration", video.VALIDATION_INVALID, "specified duration of the clip is negative")
 	}
-	return nil
+	return verr.Err()
 }
 
 func (f *FFmpegBuilder) validateProxyFileCreationQuery() error {
+	verr := &video.ValidationError{}
 	if len(f.Inputs) != 1 {
-		return fmt.Errorf("no input stream(s) provided")
+		verr.Add("inputs", video.VALIDATION_REQUIRED, "no input stream(s) provided")
 	}
 	if len(f.Outputs) != 1 {
-		return fmt.Errorf("no output stream(s) provided")
+		verr.Add("outputs", video.VALIDATION_REQUIRED, "no output stream(s) provided")
 	}
 
 	if f.OutputParams.Codec != "copy" {
-		return fmt.Errorf("codec must be copy. No re-encoding needed for proxy")
+		verr.Add("codec", video.VALIDATION_INVALID, "codec must be copy. No re-encoding needed for proxy")
 	}
-	return nil
+	return verr.Err()
 }
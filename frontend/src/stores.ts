@@ -260,6 +260,18 @@ function createTracksStore() {
     setTrackDuration(0);
   };
 
+  const setTracks = (newTracks: video.VideoNode[][]) => {
+    // the store is empty until a clip is added to any track
+    if (newTracks.every((track) => track.length === 0)) newTracks = [];
+    set(newTracks);
+    setTrackDuration(
+      (newTracks[0] ?? []).reduce(
+        (duration, videoNode) => duration + videoNode.end - videoNode.start,
+        0,
+      ),
+    );
+  };
+
   return {
     subscribe,
     trackTime,
@@ -274,6 +286,7 @@ function createTracksStore() {
     unmarkAllLossless,
     trackDuration,
     resetTrackStore,
+    setTracks,
   };
 }
 
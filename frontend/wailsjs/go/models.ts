@@ -73,8 +73,46 @@ export namespace video {
 	        this.losslessexport = source["losslessexport"];
 	    }
 	}
+	export class Track {
+	    id: string;
+	    name: string;
+	    type: string;
+	    nodes: VideoNode[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Track(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.nodes = this.convertValues(source["nodes"], VideoNode);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class Timeline {
 	    video_nodes: VideoNode[];
+	    video_tracks: Track[];
+	    audio_tracks: Track[];
 	
 	    static createFrom(source: any = {}) {
 	        return new Timeline(source);
@@ -83,6 +121,8 @@ export namespace video {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.video_nodes = this.convertValues(source["video_nodes"], VideoNode);
+	        this.video_tracks = this.convertValues(source["video_tracks"], Track);
+	        this.audio_tracks = this.convertValues(source["audio_tracks"], Track);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -10,6 +10,11 @@ if [[ "$PLATFORM" == "darwin/universal" ]]; then
   mv ffmpeg resources/darwin/ffmpeg
   chmod +x resources/darwin/ffmpeg
   rm -rf ffmpeg-115960-g3a5202d026.zip
+  curl -O https://evermeet.cx/ffmpeg/ffprobe-115960-g3a5202d026.zip
+  unzip ffprobe-115960-g3a5202d026.zip
+  mv ffprobe resources/darwin/ffprobe
+  chmod +x resources/darwin/ffprobe
+  rm -rf ffprobe-115960-g3a5202d026.zip
 elif [[ "$PLATFORM" == "linux/amd64" ]]; then
   echo "Setting up FFmpeg for Linux"
 elif [[ "$PLATFORM" == "windows" ]]; then
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/k1nho/gahara/internal/storage"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// HISTORY_FILE: the file of the project directory where the jobs run for the project are recorded
+	HISTORY_FILE = "history.json"
+	// HISTORY_LIMIT: the number of jobs kept in the history of a project, the oldest are dropped
+	HISTORY_LIMIT = 200
+)
+
+// HistoryEntry: a FFmpeg query run for a project, with the options it was run with and its outcome
+type HistoryEntry struct {
+	// ID: the id of the job of the query
+	ID string `json:"id"`
+	// QueryType: the query executed by the job (q_filtergraph, q_lossless_cut, ...)
+	QueryType string `json:"query_type"`
+	// Opts: the processing options of the query, a re-run uses them as they are
+	Opts video.ProcessingOpts `json:"opts"`
+	// Timeline: the timeline rendered by the query (without its undo history), a re-run renders it again
+	Timeline *video.Timeline `json:"timeline,omitempty"`
+	// Outputs: the files written by the job that exist once it ended
+	Outputs []string `json:"outputs"`
+	// StartedAt: the time at which the job started
+	StartedAt time.Time `json:"started_at"`
+	// EndedAt: the time at which the job ended
+	EndedAt time.Time `json:"ended_at"`
+	// Status: the outcome of the job (success, failed, cancelled)
+	Status string `json:"status"`
+	// Error: the reason the job failed
+	Error string `json:"error,omitempty"`
+	// Stderr: the tail of the logs of ffmpeg, of the command that failed if any
+	Stderr string `json:"stderr,omitempty"`
+}
+
+/*
+NewHistoryEntry: the entry of a job that ended with err, a job with a failed command failed even if err is nil.
+The timeline is recorded for the queries that render it
+*/
+func NewHistoryEntry(job *Job, opts video.ProcessingOpts, timeline video.Timeline, err error) HistoryEntry {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	entry := HistoryEntry{
+		ID:        job.ID,
+		QueryType: job.QueryType,
+		Opts:      opts,
+		Outputs:   []string{},
+		StartedAt: job.StartedAt,
+		EndedAt:   time.Now(),
+		Status:    Success,
+		Stderr:    job.stderr,
+	}
+	if rendersTimeline(job.QueryType) {
+		snapshot := timeline.Clone()
+		snapshot.History = video.History{}
+		entry.Timeline = &snapshot
+	}
+	for _, output := range job.outputs {
+		if _, err := os.Stat(output); err == nil && !slices.Contains(entry.Outputs, output) {
+			entry.Outputs = append(entry.Outputs, output)
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrJobCancelled):
+		entry.Status, entry.Error = Cancelled, err.Error()
+	case err != nil:
+		entry.Status, entry.Error = Failed, err.Error()
+	case job.failures > 0:
+		entry.Status, entry.Error = Failed, fmt.Sprintf("%d commands of the job failed", job.failures)
+	}
+	return entry
+}
+
+// rendersTimeline: reports if a query type renders the timeline, rather than a single source
+func rendersTimeline(queryType string) bool {
+	switch queryType {
+	case video.QUERY_FILTERGRAPH, video.QUERY_LOSSLESS_CUT, video.QUERY_LOSSLESS_MERGE, video.QUERY_SMART_RENDER:
+		return true
+	}
+	return false
+}
+
+// readHistory: reads the history of a project, oldest first, empty if the project has none
+func readHistory(projectDir string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(path.Join(projectDir, HISTORY_FILE))
+	if os.IsNotExist(err) {
+		return []HistoryEntry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read the job history: %s", err.Error())
+	}
+
+	history := []HistoryEntry{}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("could not load the job history: %s", err.Error())
+	}
+	return history, nil
+}
+
+// recordJob: appends the entry of a job to the history of the project it was run for
+func (a *App) recordJob(projectDir string, job *Job, opts video.ProcessingOpts, timeline video.Timeline, err error) error {
+	if projectDir == "" {
+		return nil
+	}
+	a.historyLock.Lock()
+	defer a.historyLock.Unlock()
+
+	// an unreadable history is kept as it is rather than replaced by the last job
+	history, herr := readHistory(projectDir)
+	if herr != nil {
+		return herr
+	}
+	history = append(history, NewHistoryEntry(job, opts, timeline, err))
+	if len(history) > HISTORY_LIMIT {
+		history = history[len(history)-HISTORY_LIMIT:]
+	}
+
+	data, herr := json.MarshalIndent(history, "", "\t")
+	if herr != nil {
+		return herr
+	}
+	return storage.WriteFile(path.Join(projectDir, HISTORY_FILE), data, 0644, 1)
+}
+
+// ListJobHistory: returns the jobs run for the project, newest first
+func (a *App) ListJobHistory() ([]HistoryEntry, error) {
+	a.historyLock.Lock()
+	history, err := readHistory(a.config.ProjectDir)
+	a.historyLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(history)
+	return history, nil
+}
+
+/*
+RerunJob: runs a job of the history again with the same query type and options. The query runs as a new job, and
+renders the timeline recorded with the job rather than the timeline as it is now. A job recorded without its
+timeline (by an earlier version) is refused if it renders the timeline
+*/
+func (a *App) RerunJob(id string) error {
+	history, err := a.ListJobHistory()
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(history, func(entry HistoryEntry) bool { return entry.ID == id })
+	if idx == -1 {
+		return fmt.Errorf("job with id %s was not found in the history", id)
+	}
+
+	entry := history[idx]
+	if entry.Timeline == nil && rendersTimeline(entry.QueryType) {
+		return fmt.Errorf("job %s was recorded without its timeline and cannot be run again", id)
+	}
+	a.notifier.LogInfo(fmt.Sprintf("running job %s again", id))
+	if entry.Timeline == nil {
+		return a.FFmpegQuery(entry.QueryType, entry.Opts)
+	}
+	return a.ffmpegQuery(entry.QueryType, entry.Opts, *entry.Timeline)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/k1nho/gahara/ffmpegbuilder"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func TestJobHistory(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+
+	opts := mockExportOpts(app)
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts); err != nil {
+		t.Fatal(err)
+	}
+	fake.on("ffmpeg", "-filter_complex").withStderr("Error while opening encoder").withExitCode(1)
+	failedOpts := opts
+	// the input path is stored as the query resolved it
+	failedOpts.Filename, failedOpts.InputPath = "failed", app.config.ProjectDir
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, failedOpts); err == nil {
+		t.Fatal("expected the export to fail")
+	}
+
+	history, err := app.ListJobHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) < 2 {
+		t.Fatalf("expected the exports in the history, got %v", history)
+	}
+
+	// the newest job comes first
+	failed, exported := history[0], history[1]
+	if failed.Status != Failed || !strings.Contains(failed.Error, "Error while opening encoder") || !strings.Contains(failed.Stderr, "Error while opening encoder") {
+		t.Errorf("expected the failed export with the logs of ffmpeg, got %+v", failed)
+	}
+	if failed.Opts != failedOpts || failed.QueryType != video.QUERY_FILTERGRAPH {
+		t.Errorf("expected the options of the failed export, got %+v", failed.Opts)
+	}
+	if exported.Status != Success || exported.Error != "" || exported.EndedAt.Before(exported.StartedAt) {
+		t.Errorf("expected the successful export, got %+v", exported)
+	}
+	if !slices.Equal(exported.Outputs, []string{filepath.Join(app.config.ProjectDir, "export.mp4")}) {
+		t.Errorf("expected the output of the export, got %v", exported.Outputs)
+	}
+}
+
+func TestCancelledJobHistory(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	script := fake.on("ffmpeg", "-filter_complex").untilCancelled()
+
+	err := cancelRunningJob(t, app, script, func() error { return app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)) })
+	if !errors.Is(err, ErrJobCancelled) {
+		t.Fatalf("expected the job to be cancelled, got %v", err)
+	}
+
+	history, err := app.ListJobHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the partial output was removed
+	if cancelled := history[0]; cancelled.Status != Cancelled || len(cancelled.Outputs) != 0 {
+		t.Errorf("expected the cancelled export without outputs, got %+v", cancelled)
+	}
+}
+
+func TestRerunJob(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+
+	opts := mockExportOpts(app)
+	opts.CRF, opts.RateControl, opts.VideoBitrate, opts.TwoPass = "", video.RATE_CONTROL_BITRATE, "4M", true
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts); err != nil {
+		t.Fatal(err)
+	}
+	history, err := app.ListJobHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the timeline is edited after the export, the re-run renders the timeline that was exported
+	if _, err := app.RippleTrim(1, video.TRIM_OUT, -2); err != nil {
+		t.Fatal(err)
+	}
+	ran := len(fake.commands("ffmpeg"))
+	if err := app.RerunJob(history[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 2*ran {
+		t.Fatalf("expected the export to run again, got %d commands", len(commands))
+	}
+	// the pass logs are named per job, the rest of the commands are identical
+	for i := 0; i < ran; i++ {
+		if len(commands[i].Args) != len(commands[ran+i].Args) || commands[i].Outputs[0] != commands[ran+i].Outputs[0] ||
+			filterGraph(commands[i]) != filterGraph(commands[ran+i]) {
+			t.Errorf("expected the same command, got %s and %s", commands[i], commands[ran+i])
+		}
+	}
+
+	rerun, err := app.ListJobHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rerun) != len(history)+1 || rerun[0].ID == history[0].ID || rerun[0].Opts != history[0].Opts {
+		t.Errorf("expected the re-run as a new job with the same options, got %+v", rerun[0])
+	}
+
+	if err := app.RerunJob("missing"); err == nil {
+		t.Errorf("expected an error for a job that is not in the history")
+	}
+}
+
+func TestRerunJobWithoutTimeline(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+
+	// the history of an earlier version does not record the timeline of the exports
+	legacy := `[{"id": "legacy", "query_type": "q_filtergraph", "opts": {"filename": "export"}, "outputs": [], "status": "success"}]`
+	if err := os.WriteFile(filepath.Join(app.config.ProjectDir, HISTORY_FILE), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RerunJob("legacy"); err == nil || !strings.Contains(err.Error(), "without its timeline") {
+		t.Errorf("expected the re-run to be refused, got %v", err)
+	}
+	if len(fake.commands("ffmpeg")) != 0 {
+		t.Errorf("expected nothing to run")
+	}
+}
+
+// filterGraph: the filtergraph of a command, empty if it has none
+func filterGraph(command ffmpegbuilder.Command) string {
+	idx := slices.Index(command.Args, "-filter_complex")
+	if idx == -1 || idx+1 >= len(command.Args) {
+		return ""
+	}
+	return command.Args[idx+1]
+}
+
+func TestJobHistoryLimit(t *testing.T) {
+	app, _, _ := newTestApp(t)
+	for i := 0; i < HISTORY_LIMIT+1; i++ {
+		job := app.jobs.Start(video.QUERY_FILTERGRAPH, "export.mp4")
+		if err := app.recordJob(app.config.ProjectDir, job, mockExportOpts(app), video.Timeline{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		app.jobs.End(job)
+	}
+
+	history, err := app.ListJobHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != HISTORY_LIMIT {
+		t.Errorf("expected %d jobs in the history, got %d", HISTORY_LIMIT, len(history))
+	}
+}
+
+func TestCorruptJobHistory(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	historyPath := filepath.Join(app.config.ProjectDir, HISTORY_FILE)
+	if err := os.WriteFile(historyPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.ListJobHistory(); err == nil {
+		t.Errorf("expected the corrupt history to be reported")
+	}
+	// the history is not replaced by the last job
+	if data, _ := os.ReadFile(historyPath); string(data) != "{" {
+		t.Errorf("expected the corrupt history to be kept, got %s", data)
+	}
+}
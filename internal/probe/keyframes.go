@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// KeyframeArgs: the arguments of ffprobe to list the packets of the first video stream, no frame is decoded
+func KeyframeArgs(input string) []string {
+	return []string{"-v", "quiet", "-select_streams", "v:0", "-show_entries", "packet=pts_time,flags", "-print_format", "json", input}
+}
+
+// ParseKeyframes: parses the packets listed by ffprobe, returns the sorted timestamps of the keyframes (K flag)
+func ParseKeyframes(data []byte) ([]float64, error) {
+	var output struct {
+		Packets []struct {
+			PtsTime string `json:"pts_time"`
+			Flags   string `json:"flags"`
+		} `json:"packets"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %s", err.Error())
+	}
+
+	keyframes := []float64{}
+	for _, packet := range output.Packets {
+		// discarded packets (D flag) and packets without a timestamp (N/A) cannot be used as cut points
+		if !strings.Contains(packet.Flags, "K") || strings.Contains(packet.Flags, "D") || strings.TrimSpace(packet.PtsTime) == "N/A" {
+			continue
+		}
+		keyframes = append(keyframes, parseFloat(packet.PtsTime))
+	}
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("no keyframes were found")
+	}
+	// packets are listed in decoding order, which differs from presentation order with b-frames
+	slices.Sort(keyframes)
+	return keyframes, nil
+}
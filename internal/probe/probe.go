@@ -0,0 +1,280 @@
+// probe.go: implements media probing with ffprobe, its json output is parsed into a typed description of the media
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// STREAM_VIDEO: codec type of a video stream
+	STREAM_VIDEO = "video"
+	// STREAM_AUDIO: codec type of an audio stream
+	STREAM_AUDIO = "audio"
+	// STREAM_SUBTITLE: codec type of a subtitle stream
+	STREAM_SUBTITLE = "subtitle"
+	// DURATION_TOLERANCE: the difference in seconds allowed against a probed duration, containers round it
+	DURATION_TOLERANCE = 0.05
+)
+
+// MediaInfo: the description of a media file, its container and its streams
+type MediaInfo struct {
+	// Format: the container of the media
+	Format Format `json:"format"`
+	// Streams: the streams of the media, in the order of the container
+	Streams []Stream `json:"streams"`
+}
+
+// Format: the container of a media file
+type Format struct {
+	// Filename: the path of the media
+	Filename string `json:"filename"`
+	// FormatName: the names of the container format (mov,mp4,m4a,3gp,3g2,mj2)
+	FormatName string `json:"format_name"`
+	// Duration: the duration of the media in seconds
+	Duration float64 `json:"duration"`
+	// Size: the size of the file in bytes
+	Size int64 `json:"size"`
+	// BitRate: the overall bitrate of the media in bits/s
+	BitRate int64 `json:"bit_rate"`
+	// Tags: the metadata of the container (title, creation_time)
+	Tags map[string]string `json:"tags"`
+}
+
+// Stream: a stream of a media file
+type Stream struct {
+	// Index: the index of the stream in the container
+	Index int `json:"index"`
+	// CodecType: the type of the stream (video, audio, subtitle, data)
+	CodecType string `json:"codec_type"`
+	// CodecName: the codec of the stream (h264, aac)
+	CodecName string `json:"codec_name"`
+	// Profile: the profile of the codec (High, LC)
+	Profile string `json:"profile,omitempty"`
+	// Duration: the duration of the stream in seconds (0 if unknown)
+	Duration float64 `json:"duration"`
+	// BitRate: the bitrate of the stream in bits/s (0 if unknown)
+	BitRate int64 `json:"bit_rate"`
+	// TimeBase: the unit of the timestamps of the stream (1/15360)
+	TimeBase string `json:"time_base"`
+	// Width: the coded width of a video stream
+	Width int `json:"width,omitempty"`
+	// Height: the coded height of a video stream
+	Height int `json:"height,omitempty"`
+	// PixelFormat: the pixel format of a video stream (yuv420p)
+	PixelFormat string `json:"pix_fmt,omitempty"`
+	// FrameRate: the frame rate of a video stream
+	FrameRate video.Rational `json:"frame_rate"`
+	// Rotation: the display rotation of a video stream in degrees (0, 90, 180, 270)
+	Rotation int `json:"rotation,omitempty"`
+	// SampleRate: the sample rate of an audio stream in Hz
+	SampleRate int `json:"sample_rate,omitempty"`
+	// Channels: the number of channels of an audio stream
+	Channels int `json:"channels,omitempty"`
+	// ChannelLayout: the channel layout of an audio stream (stereo, 5.1)
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	// Language: the language of the stream, if tagged
+	Language string `json:"language,omitempty"`
+}
+
+// ffprobeOutput: the output of ffprobe -print_format json -show_format -show_streams, most numbers are strings
+type ffprobeOutput struct {
+	Format struct {
+		Filename   string            `json:"filename"`
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Size       string            `json:"size"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		Duration      string            `json:"duration"`
+		BitRate       string            `json:"bit_rate"`
+		TimeBase      string            `json:"time_base"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		PixFmt        string            `json:"pix_fmt"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		Tags          map[string]string `json:"tags"`
+		SideDataList  []struct {
+			Rotation *float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+// Args: the arguments of ffprobe to describe an input as json
+func Args(input string) []string {
+	return []string{"-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", input}
+}
+
+// Parse: parses the json output of ffprobe, a media without streams is rejected
+func Parse(data []byte) (MediaInfo, error) {
+	var output ffprobeOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return MediaInfo{}, fmt.Errorf("invalid ffprobe output: %s", err.Error())
+	}
+	if len(output.Streams) == 0 {
+		return MediaInfo{}, fmt.Errorf("no streams were found")
+	}
+
+	info := MediaInfo{
+		Format: Format{
+			Filename:   output.Format.Filename,
+			FormatName: output.Format.FormatName,
+			Duration:   parseFloat(output.Format.Duration),
+			Size:       parseInt(output.Format.Size),
+			BitRate:    parseInt(output.Format.BitRate),
+			Tags:       output.Format.Tags,
+		},
+		Streams: make([]Stream, len(output.Streams)),
+	}
+
+	for i, s := range output.Streams {
+		stream := Stream{
+			Index:         s.Index,
+			CodecType:     s.CodecType,
+			CodecName:     s.CodecName,
+			Profile:       s.Profile,
+			Duration:      parseFloat(s.Duration),
+			BitRate:       parseInt(s.BitRate),
+			TimeBase:      s.TimeBase,
+			Width:         s.Width,
+			Height:        s.Height,
+			PixelFormat:   s.PixFmt,
+			SampleRate:    int(parseInt(s.SampleRate)),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+			Language:      s.Tags["language"],
+		}
+
+		if s.CodecType == STREAM_VIDEO {
+			// the average frame rate is the real one of variable frame rate media, r_frame_rate is the fallback
+			for _, frameRate := range []string{s.AvgFrameRate, s.RFrameRate} {
+				if rate, err := video.ParseFrameRate(frameRate); err == nil {
+					stream.FrameRate = rate
+					break
+				}
+			}
+			stream.Rotation = rotation(s.Tags["rotate"])
+			for _, sideData := range s.SideDataList {
+				if sideData.Rotation != nil {
+					stream.Rotation = normalizeRotation(int(*sideData.Rotation))
+				}
+			}
+		}
+		info.Streams[i] = stream
+	}
+	return info, nil
+}
+
+// parseFloat: parses a number of the ffprobe output, 0 if it is missing or N/A
+func parseFloat(value string) float64 {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseInt: parses an integer of the ffprobe output, 0 if it is missing or N/A
+func parseInt(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// rotation: parses the rotate tag of a video stream (older ffmpeg versions)
+func rotation(tag string) int {
+	degrees, err := strconv.Atoi(strings.TrimSpace(tag))
+	if err != nil {
+		return 0
+	}
+	return normalizeRotation(degrees)
+}
+
+// normalizeRotation: maps a rotation in degrees to [0, 360), the display matrix of ffprobe gives -90 for 270
+func normalizeRotation(degrees int) int {
+	return ((degrees % 360) + 360) % 360
+}
+
+// streams: returns the streams of a codec type
+func (m MediaInfo) streams(codecType string) []Stream {
+	streams := []Stream{}
+	for _, stream := range m.Streams {
+		if stream.CodecType == codecType {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// VideoStreams: returns the video streams of the media
+func (m MediaInfo) VideoStreams() []Stream {
+	return m.streams(STREAM_VIDEO)
+}
+
+// AudioStreams: returns the audio streams of the media
+func (m MediaInfo) AudioStreams() []Stream {
+	return m.streams(STREAM_AUDIO)
+}
+
+// VideoStream: returns the first video stream of the media
+func (m MediaInfo) VideoStream() (Stream, bool) {
+	streams := m.VideoStreams()
+	if len(streams) == 0 {
+		return Stream{}, false
+	}
+	return streams[0], true
+}
+
+// HasVideo: checks if the media has at least one video stream
+func (m MediaInfo) HasVideo() bool {
+	return len(m.VideoStreams()) > 0
+}
+
+// HasAudio: checks if the media has at least one audio stream
+func (m MediaInfo) HasAudio() bool {
+	return len(m.AudioStreams()) > 0
+}
+
+// Duration: the duration of the media in seconds, the longest stream is used if the container has none
+func (m MediaInfo) Duration() float64 {
+	if m.Format.Duration > 0 {
+		return m.Format.Duration
+	}
+	duration := 0.0
+	for _, stream := range m.Streams {
+		if stream.Duration > duration {
+			duration = stream.Duration
+		}
+	}
+	return duration
+}
+
+// DisplaySize: the size of a video stream as displayed, width and height are swapped by a rotation of 90 or 270
+func (s Stream) DisplaySize() (int, int) {
+	if s.Rotation == 90 || s.Rotation == 270 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
+
+// Resolution: the display resolution of a video stream (1920x1080)
+func (s Stream) Resolution() string {
+	width, height := s.DisplaySize()
+	return fmt.Sprintf("%dx%d", width, height)
+}
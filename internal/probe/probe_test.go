@@ -0,0 +1,154 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const mockFFprobeOutput = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "h264",
+            "profile": "High",
+            "codec_type": "video",
+            "width": 1920,
+            "height": 1080,
+            "pix_fmt": "yuv420p",
+            "r_frame_rate": "30000/1001",
+            "avg_frame_rate": "30000/1001",
+            "duration": "12.512500",
+            "bit_rate": "8000000",
+            "side_data_list": [
+                {
+                    "side_data_type": "Display Matrix",
+                    "rotation": -90
+                }
+            ]
+        },
+        {
+            "index": 1,
+            "codec_name": "aac",
+            "profile": "LC",
+            "codec_type": "audio",
+            "sample_rate": "48000",
+            "channels": 2,
+            "channel_layout": "stereo",
+            "r_frame_rate": "0/0",
+            "avg_frame_rate": "0/0",
+            "duration": "12.522667",
+            "bit_rate": "192000",
+            "tags": {
+                "language": "eng"
+            }
+        }
+    ],
+    "format": {
+        "filename": "clip.mov",
+        "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "duration": "12.522667",
+        "size": "12745931",
+        "bit_rate": "8142617",
+        "tags": {
+            "title": "clip"
+        }
+    }
+}`
+
+func TestParse(t *testing.T) {
+	info, err := Parse([]byte(mockFFprobeOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Format.FormatName != "mov,mp4,m4a,3gp,3g2,mj2" || info.Format.Size != 12745931 || info.Format.BitRate != 8142617 {
+		t.Errorf("unexpected format %+v", info.Format)
+	}
+	if info.Duration() != 12.522667 {
+		t.Errorf("expected a duration of 12.522667, got %f", info.Duration())
+	}
+	if !info.HasVideo() || !info.HasAudio() {
+		t.Errorf("expected a video and an audio stream")
+	}
+
+	stream, ok := info.VideoStream()
+	if !ok {
+		t.Fatal("expected a video stream")
+	}
+	if stream.CodecName != "h264" || stream.PixelFormat != "yuv420p" || stream.BitRate != 8000000 {
+		t.Errorf("unexpected video stream %+v", stream)
+	}
+	if stream.FrameRate != (video.Rational{Num: 30000, Den: 1001}) {
+		t.Errorf("expected a frame rate of 30000/1001, got %s", stream.FrameRate.String())
+	}
+	if stream.Rotation != 270 {
+		t.Errorf("expected a rotation of 270, got %d", stream.Rotation)
+	}
+	if stream.Resolution() != "1080x1920" {
+		t.Errorf("expected a rotated resolution of 1080x1920, got %s", stream.Resolution())
+	}
+
+	audio := info.AudioStreams()[0]
+	if audio.SampleRate != 48000 || audio.Channels != 2 || audio.ChannelLayout != "stereo" || audio.Language != "eng" {
+		t.Errorf("unexpected audio stream %+v", audio)
+	}
+	if audio.FrameRate.IsValid() {
+		t.Errorf("expected no frame rate for an audio stream, got %s", audio.FrameRate.String())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{name: "not json", output: "Invalid data found when processing input"},
+		{name: "no streams", output: `{"format": {"filename": "notes.txt", "duration": "N/A"}}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse([]byte(tt.output)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDurationFallback(t *testing.T) {
+	info, err := Parse([]byte(`{"streams": [{"index": 0, "codec_type": "video", "duration": "4.5"}, {"index": 1, "codec_type": "audio", "duration": "4.75"}], "format": {"duration": "N/A"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration() != 4.75 {
+		t.Errorf("expected the duration of the longest stream 4.75, got %f", info.Duration())
+	}
+}
+
+func TestParseKeyframes(t *testing.T) {
+	output := `{"packets": [
+		{"pts_time": "0.000000", "flags": "K__"},
+		{"pts_time": "0.133467", "flags": "___"},
+		{"pts_time": "0.066733", "flags": "___"},
+		{"pts_time": "4.004000", "flags": "K__"},
+		{"pts_time": "2.002000", "flags": "K__"},
+		{"pts_time": "-0.033367", "flags": "K_D"},
+		{"pts_time": "N/A", "flags": "K__"}
+	]}`
+	keyframes, err := ParseKeyframes([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{0, 2.002, 4.004}
+	if len(keyframes) != len(expected) {
+		t.Fatalf("expected keyframes %v, got %v", expected, keyframes)
+	}
+	for i := range expected {
+		if keyframes[i] != expected[i] {
+			t.Errorf("expected keyframes %v, got %v", expected, keyframes)
+		}
+	}
+
+	if _, err := ParseKeyframes([]byte(`{"packets": [{"pts_time": "0.5", "flags": "___"}]}`)); err == nil {
+		t.Error("expected an error when there are no keyframes")
+	}
+}
@@ -0,0 +1,147 @@
+// progress.go: implements the parsing of the -progress output of ffmpeg, and the estimation of the progress of a job
+package progress
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PROGRESS_CONTINUE: the value of the progress key that ends a block while ffmpeg is running
+	PROGRESS_CONTINUE = "continue"
+	// PROGRESS_END: the value of the progress key that ends the last block
+	PROGRESS_END = "end"
+	// UNKNOWN: the percent or eta of an estimate that cannot be computed
+	UNKNOWN = -1
+)
+
+// Report: a block of the -progress output of ffmpeg, the values ffmpeg reports as N/A are left empty
+type Report struct {
+	// Frame: the number of frames encoded
+	Frame int64 `json:"frame"`
+	// FPS: the frames encoded per second
+	FPS float64 `json:"fps"`
+	// Bitrate: the bitrate of the output so far in kbit/s
+	Bitrate float64 `json:"bitrate"`
+	// TotalSize: the size of the output so far in bytes
+	TotalSize int64 `json:"total_size"`
+	// OutTime: the timestamp of the output in seconds
+	OutTime float64 `json:"out_time"`
+	// DupFrames: the number of frames duplicated to keep the frame rate
+	DupFrames int64 `json:"dup_frames"`
+	// DropFrames: the number of frames dropped to keep the frame rate
+	DropFrames int64 `json:"drop_frames"`
+	// Speed: the seconds of output encoded per second (1.5x -> 1.5)
+	Speed float64 `json:"speed"`
+	// End: the block is the last one, ffmpeg has finished
+	End bool `json:"end"`
+}
+
+/*
+Scan: reads the -progress output of ffmpeg and calls fn with every block, a block ends with its progress key.
+Lines that are not key=value pairs (logs of ffmpeg) are skipped, and an unfinished block at the end is dropped
+Ex: frame=120\nfps=30.00\n...\nout_time_us=4000000\nspeed=1.5x\nprogress=continue
+*/
+func Scan(r io.Reader, fn func(Report)) error {
+	report := Report{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.Contains(key, " ") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "frame":
+			report.Frame = parseInt(value)
+		case "fps":
+			report.FPS = parseFloat(value)
+		case "bitrate":
+			report.Bitrate = parseFloat(strings.TrimSuffix(value, "kbits/s"))
+		case "total_size":
+			report.TotalSize = parseInt(value)
+		case "out_time_us":
+			report.OutTime = float64(parseInt(value)) / 1000000
+		case "out_time":
+			// out_time_us comes first and is exact, out_time is used when it is missing
+			if report.OutTime == 0 {
+				report.OutTime = parseTimestamp(value)
+			}
+		case "dup_frames":
+			report.DupFrames = parseInt(value)
+		case "drop_frames":
+			report.DropFrames = parseInt(value)
+		case "speed":
+			report.Speed = parseFloat(strings.TrimSuffix(value, "x"))
+		case "progress":
+			report.End = value == PROGRESS_END
+			fn(report)
+			report = Report{}
+		}
+	}
+	return scanner.Err()
+}
+
+// Estimate: the progress of a job against the duration expected of its output
+type Estimate struct {
+	// Percent: the share of the expected duration encoded [0, 100] (UNKNOWN without an expected duration)
+	Percent float64 `json:"percent"`
+	// ETA: the seconds left until the output is encoded (UNKNOWN without an expected duration or a speed)
+	ETA float64 `json:"eta"`
+}
+
+// NewEstimate: estimates the progress of a report given the expected duration of the output in seconds
+func NewEstimate(report Report, expected float64) Estimate {
+	if report.End {
+		return Estimate{Percent: 100, ETA: 0}
+	}
+	if expected <= 0 {
+		return Estimate{Percent: UNKNOWN, ETA: UNKNOWN}
+	}
+
+	outTime := report.OutTime
+	if outTime < 0 {
+		outTime = 0
+	} else if outTime > expected {
+		outTime = expected
+	}
+	estimate := Estimate{Percent: outTime / expected * 100, ETA: UNKNOWN}
+	if report.Speed > 0 {
+		estimate.ETA = (expected - outTime) / report.Speed
+	}
+	return estimate
+}
+
+// parseTimestamp: parses a timestamp HH:MM:SS.micro of ffmpeg to seconds, 0 if it is invalid
+func parseTimestamp(timestamp string) float64 {
+	parts := strings.Split(timestamp, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	hours, minutes, seconds := parseInt(parts[0]), parseInt(parts[1]), parseFloat(parts[2])
+	if hours < 0 || minutes < 0 || seconds < 0 {
+		return 0
+	}
+	return float64(hours*3600+minutes*60) + seconds
+}
+
+// parseFloat: parses a float of the progress output, 0 if it is missing or N/A
+func parseFloat(value string) float64 {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseInt: parses an integer of the progress output, 0 if it is missing or N/A
+func parseInt(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
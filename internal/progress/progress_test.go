@@ -0,0 +1,71 @@
+package progress
+
+import (
+	"strings"
+	"testing"
+)
+
+const mockProgressOutput = `[mp4 @ 0x7f8b] Starting second pass: moving the moov atom to the beginning of the file
+frame=120
+fps=29.97
+stream_0_0_q=28.0
+bitrate=1523.4kbits/s
+total_size=762880
+out_time_us=4004000
+out_time_ms=4004000
+out_time=00:00:04.004000
+dup_frames=0
+drop_frames=2
+speed=1.49x
+progress=continue
+frame=300
+fps=N/A
+bitrate=N/A
+total_size=N/A
+out_time_us=N/A
+out_time=00:01:10.500000
+speed=N/A
+progress=end
+frame=301
+`
+
+func TestScan(t *testing.T) {
+	reports := []Report{}
+	if err := Scan(strings.NewReader(mockProgressOutput), func(report Report) { reports = append(reports, report) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 reports, the unfinished block is dropped, got %d", len(reports))
+	}
+
+	expected := Report{Frame: 120, FPS: 29.97, Bitrate: 1523.4, TotalSize: 762880, OutTime: 4.004, DropFrames: 2, Speed: 1.49}
+	if reports[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, reports[0])
+	}
+	// the values that are N/A are left empty, out_time is used when out_time_us is N/A
+	if last := reports[1]; last != (Report{Frame: 300, OutTime: 70.5, End: true}) {
+		t.Errorf("unexpected last report %+v", last)
+	}
+}
+
+func TestNewEstimate(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   Report
+		expected float64
+		estimate Estimate
+	}{
+		{name: "halfway", report: Report{OutTime: 30, Speed: 2}, expected: 60, estimate: Estimate{Percent: 50, ETA: 15}},
+		{name: "no speed", report: Report{OutTime: 30}, expected: 60, estimate: Estimate{Percent: 50, ETA: UNKNOWN}},
+		{name: "past the expected duration", report: Report{OutTime: 61, Speed: 1}, expected: 60, estimate: Estimate{Percent: 100, ETA: 0}},
+		{name: "negative timestamp", report: Report{OutTime: -0.04, Speed: 1}, expected: 60, estimate: Estimate{Percent: 0, ETA: 60}},
+		{name: "no expected duration", report: Report{OutTime: 30, Speed: 1}, expected: 0, estimate: Estimate{Percent: UNKNOWN, ETA: UNKNOWN}},
+		{name: "end", report: Report{OutTime: 59.9, End: true}, expected: 60, estimate: Estimate{Percent: 100, ETA: 0}},
+	}
+
+	for _, tt := range tests {
+		if got := NewEstimate(tt.report, tt.expected); got != tt.estimate {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.estimate, got)
+		}
+	}
+}
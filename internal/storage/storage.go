@@ -0,0 +1,83 @@
+// storage.go: implements crash safe writes of the project files (timeline.json, metadata.json)
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// BackupPath: the path of the n-th backup of a file (1 is the most recent)
+func BackupPath(name string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", name, n)
+}
+
+/*
+WriteFile: writes data to a file atomically. The data is written to a temporary file in the same directory,
+synced to disk, and renamed over the file, so a crash leaves either the old or the new file, never a partial one.
+The previous content of the file is kept as a rolling backup of at most backups files (name.bak.1 is the newest)
+*/
+func WriteFile(name string, data []byte, perm os.FileMode, backups int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create a temporary file for %s: %s", filepath.Base(name), err.Error())
+	}
+	// the temporary file is removed if it was not renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %s", filepath.Base(name), err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %s", filepath.Base(name), err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %s", filepath.Base(name), err.Error())
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if backups > 0 {
+		if err := rotateBackups(name, backups); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("could not replace %s: %s", filepath.Base(name), err.Error())
+	}
+	syncDir(filepath.Dir(name))
+	return nil
+}
+
+// rotateBackups: shifts the backups of a file by one (the oldest is dropped) and copies the file as the newest backup
+func rotateBackups(name string, backups int) error {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not backup %s: %s", filepath.Base(name), err.Error())
+	}
+
+	for n := backups - 1; n >= 1; n-- {
+		if err := os.Rename(BackupPath(name, n), BackupPath(name, n+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not rotate the backups of %s: %s", filepath.Base(name), err.Error())
+		}
+	}
+
+	// the backup is written atomically as well, so a crash never leaves a broken backup
+	return WriteFile(BackupPath(name, 1), data, 0644, 0)
+}
+
+// syncDir: flushes a directory entry to disk so a rename survives a crash (best effort, not supported everywhere)
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
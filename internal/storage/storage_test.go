@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteFile(t *testing.T) {
+	t.Run("writes replace the file and keep rolling backups", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "timeline.json")
+
+		for _, content := range []string{"v1", "v2", "v3", "v4"} {
+			if err := WriteFile(name, []byte(content), 0644, 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := readFile(t, name); got != "v4" {
+			t.Errorf("got %s, expected v4", got)
+		}
+		if got := readFile(t, BackupPath(name, 1)); got != "v3" {
+			t.Errorf("got backup %s, expected v3", got)
+		}
+		if got := readFile(t, BackupPath(name, 2)); got != "v2" {
+			t.Errorf("got backup %s, expected v2", got)
+		}
+		if _, err := os.Stat(BackupPath(name, 3)); !os.IsNotExist(err) {
+			t.Errorf("only 2 backups should be kept")
+		}
+	})
+
+	t.Run("no temporary files are left behind", func(t *testing.T) {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "metadata.json")
+
+		if err := WriteFile(name, []byte("[]"), 0644, 0); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected only metadata.json, got %d files", len(entries))
+		}
+	})
+
+	t.Run("a failed write keeps the previous file", func(t *testing.T) {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "timeline.json")
+		if err := WriteFile(name, []byte("saved"), 0644, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := WriteFile(filepath.Join(dir, "missing", "timeline.json"), []byte("lost"), 0644, 1); err == nil {
+			t.Errorf("expected the write to a missing directory to fail")
+		}
+		if got := readFile(t, name); got != "saved" {
+			t.Errorf("got %s, expected saved", got)
+		}
+	})
+}
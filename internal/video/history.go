@@ -0,0 +1,240 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// HISTORY_LIMIT: the maximum number of commands that can be undone
+	HISTORY_LIMIT = 100
+	// OP_INSERT: inserts a video node in a track
+	OP_INSERT = "insert"
+	// OP_DELETE: deletes a video node from a track
+	OP_DELETE = "delete"
+	// OP_SPLIT: splits a video node of a track
+	OP_SPLIT = "split"
+	// OP_RENAME: renames a video node of the main track
+	OP_RENAME = "rename"
+	// OP_TOGGLE_LOSSLESS: toggles the lossless export mark of a video node
+	OP_TOGGLE_LOSSLESS = "toggle_lossless"
+	// OP_MARK_ALL_LOSSLESS: marks all the video nodes of the main track for lossless export
+	OP_MARK_ALL_LOSSLESS = "mark_all_lossless"
+	// OP_UNMARK_ALL_LOSSLESS: unmarks all the video nodes of the main track for lossless export
+	OP_UNMARK_ALL_LOSSLESS = "unmark_all_lossless"
+	// OP_DELETE_RID_REFERENCES: deletes all the video nodes derived from a root id
+	OP_DELETE_RID_REFERENCES = "delete_rid_references"
+	// OP_ADD_TRACK: adds a video or audio track
+	OP_ADD_TRACK = "add_track"
+	// OP_REMOVE_TRACK: removes a video or audio track
+	OP_REMOVE_TRACK = "remove_track"
+	// OP_MOVE_TRACK: reorders a video or audio track
+	OP_MOVE_TRACK = "move_track"
+	// OP_SET_TRANSITION: sets the transition between two video nodes
+	OP_SET_TRANSITION = "set_transition"
+	// OP_REMOVE_TRANSITION: removes the transition between two video nodes
+	OP_REMOVE_TRANSITION = "remove_transition"
+	// LIST_TRANSITIONS: the edit is applied to the transitions of the timeline
+	LIST_TRANSITIONS = "transitions"
+)
+
+// Edit: replaces the elements at Pos, Removed are taken out and Inserted are put in their place.
+// An edit is applied to the nodes of a track (Track is set), to the video/audio track list (TrackType is set),
+// or to another list of the timeline (List is set)
+type Edit struct {
+	// Track: the id of the track whose nodes are edited
+	Track string `json:"track,omitempty"`
+	// TrackType: the type of the track list edited (video, audio)
+	TrackType string `json:"track_type,omitempty"`
+	// Pos: the position at which the edit is applied
+	Pos int `json:"pos"`
+	// Removed: the video nodes removed at Pos
+	Removed []VideoNode `json:"removed,omitempty"`
+	// Inserted: the video nodes inserted at Pos
+	Inserted []VideoNode `json:"inserted,omitempty"`
+	// RemovedTracks: the tracks removed at Pos
+	RemovedTracks []Track `json:"removed_tracks,omitempty"`
+	// InsertedTracks: the tracks inserted at Pos
+	InsertedTracks []Track `json:"inserted_tracks,omitempty"`
+	// List: the list of the timeline edited (transitions, markers)
+	List string `json:"list,omitempty"`
+	// RemovedTransitions: the transitions removed at Pos
+	RemovedTransitions []Transition `json:"removed_transitions,omitempty"`
+	// InsertedTransitions: the transitions inserted at Pos
+	InsertedTransitions []Transition `json:"inserted_transitions,omitempty"`
+	// RemovedMarkers: the markers removed at Pos
+	RemovedMarkers []Marker `json:"removed_markers,omitempty"`
+	// InsertedMarkers: the markers inserted at Pos
+	InsertedMarkers []Marker `json:"inserted_markers,omitempty"`
+}
+
+// Command: an operation performed on the timeline, made of one or more edits
+type Command struct {
+	// Op: the operation performed (insert, delete, split, etc)
+	Op string `json:"op"`
+	// Edits: the edits of the operation, in the order they were applied
+	Edits []Edit `json:"edits"`
+}
+
+type History struct {
+	// Undo: the commands that can be undone (last is the most recent)
+	Undo []Command `json:"undo"`
+	// Redo: the commands that can be redone (last is the most recently undone)
+	Redo []Command `json:"redo"`
+}
+
+// inverse: returns the edit that reverts this edit
+func (e Edit) inverse() Edit {
+	e.Removed, e.Inserted = e.Inserted, e.Removed
+	e.RemovedTracks, e.InsertedTracks = e.InsertedTracks, e.RemovedTracks
+	e.RemovedTransitions, e.InsertedTransitions = e.InsertedTransitions, e.RemovedTransitions
+	e.RemovedMarkers, e.InsertedMarkers = e.InsertedMarkers, e.RemovedMarkers
+	return e
+}
+
+// execute: applies the edits of an operation and records them in the history
+func (tl *Timeline) execute(op string, edits ...Edit) error {
+	if err := tl.applyEdits(edits); err != nil {
+		return err
+	}
+
+	tl.History.Undo = append(tl.History.Undo, Command{Op: op, Edits: edits})
+	if len(tl.History.Undo) > HISTORY_LIMIT {
+		tl.History.Undo = slices.Delete(tl.History.Undo, 0, len(tl.History.Undo)-HISTORY_LIMIT)
+	}
+	tl.History.Redo = nil
+	return nil
+}
+
+// Undo: reverts the last operation performed on the timeline
+func (tl *Timeline) Undo() (Command, error) {
+	if len(tl.History.Undo) == 0 {
+		return Command{}, fmt.Errorf("there is nothing to undo")
+	}
+
+	cmd := tl.History.Undo[len(tl.History.Undo)-1]
+	inverses := make([]Edit, 0, len(cmd.Edits))
+	for i := len(cmd.Edits) - 1; i >= 0; i-- {
+		inverses = append(inverses, cmd.Edits[i].inverse())
+	}
+	if err := tl.applyEdits(inverses); err != nil {
+		return cmd, fmt.Errorf("could not undo %s: %s", cmd.Op, err.Error())
+	}
+
+	tl.History.Undo = tl.History.Undo[:len(tl.History.Undo)-1]
+	tl.History.Redo = append(tl.History.Redo, cmd)
+	return cmd, nil
+}
+
+// Redo: performs again the last operation that was undone
+func (tl *Timeline) Redo() (Command, error) {
+	if len(tl.History.Redo) == 0 {
+		return Command{}, fmt.Errorf("there is nothing to redo")
+	}
+
+	cmd := tl.History.Redo[len(tl.History.Redo)-1]
+	if err := tl.applyEdits(cmd.Edits); err != nil {
+		return cmd, fmt.Errorf("could not redo %s: %s", cmd.Op, err.Error())
+	}
+
+	tl.History.Redo = tl.History.Redo[:len(tl.History.Redo)-1]
+	tl.History.Undo = append(tl.History.Undo, cmd)
+	return cmd, nil
+}
+
+// applyEdits: applies the edits in order, if one fails the edits already applied are reverted
+func (tl *Timeline) applyEdits(edits []Edit) error {
+	for i, edit := range edits {
+		if err := tl.applyEdit(edit); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				_ = tl.applyEdit(edits[j].inverse())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEdit: removes and inserts the elements of an edit, checking that the removed elements are the expected ones
+func (tl *Timeline) applyEdit(edit Edit) error {
+	switch edit.List {
+	case LIST_TRANSITIONS:
+		return spliceList(&tl.Transitions, edit.Pos, edit.RemovedTransitions, edit.InsertedTransitions, func(t Transition) string { return t.ID })
+	case LIST_MARKERS:
+		return spliceList(&tl.Markers, edit.Pos, edit.RemovedMarkers, edit.InsertedMarkers, func(m Marker) string { return m.ID })
+	}
+
+	if edit.Track != "" {
+		nodes, err := tl.trackNodes(edit.Track)
+		if err != nil {
+			return err
+		}
+		if edit.Pos < 0 || edit.Pos+len(edit.Removed) > len(*nodes) {
+			return fmt.Errorf("edit position %d is invalid", edit.Pos)
+		}
+		for i, removed := range edit.Removed {
+			if (*nodes)[edit.Pos+i].ID != removed.ID {
+				return fmt.Errorf("timeline is out of sync with the history")
+			}
+		}
+		*nodes = slices.Replace(*nodes, edit.Pos, edit.Pos+len(edit.Removed), slices.Clone(edit.Inserted)...)
+		return nil
+	}
+
+	tracks, err := tl.trackList(edit.TrackType)
+	if err != nil {
+		return err
+	}
+	if edit.Pos < 0 || edit.Pos+len(edit.RemovedTracks) > len(*tracks) {
+		return fmt.Errorf("edit position %d is invalid", edit.Pos)
+	}
+	for i, removed := range edit.RemovedTracks {
+		if (*tracks)[edit.Pos+i].ID != removed.ID {
+			return fmt.Errorf("timeline is out of sync with the history")
+		}
+	}
+	inserted := make([]Track, len(edit.InsertedTracks))
+	for i, track := range edit.InsertedTracks {
+		track.Nodes = slices.Clone(track.Nodes)
+		inserted[i] = track
+	}
+	*tracks = slices.Replace(*tracks, edit.Pos, edit.Pos+len(edit.RemovedTracks), inserted...)
+	return nil
+}
+
+// spliceList: replaces the removed elements of a list at pos with the inserted ones, elements are matched by id
+func spliceList[T any](list *[]T, pos int, removed []T, inserted []T, id func(T) string) error {
+	if pos < 0 || pos+len(removed) > len(*list) {
+		return fmt.Errorf("edit position %d is invalid", pos)
+	}
+	for i, r := range removed {
+		if id((*list)[pos+i]) != id(r) {
+			return fmt.Errorf("timeline is out of sync with the history")
+		}
+	}
+	*list = slices.Replace(*list, pos, pos+len(removed), slices.Clone(inserted)...)
+	return nil
+}
+
+// trackNodes: retrieves the nodes of a track by its id (MAIN_TRACK_ID for the main track)
+func (tl *Timeline) trackNodes(trackID string) (*[]VideoNode, error) {
+	if trackID == MAIN_TRACK_ID {
+		return &tl.VideoNodes, nil
+	}
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return nil, err
+	}
+	return &track.Nodes, nil
+}
+
+// trackList: retrieves the track list of a track type
+func (tl *Timeline) trackList(trackType string) (*[]Track, error) {
+	switch trackType {
+	case TRACK_VIDEO:
+		return &tl.VideoTracks, nil
+	case TRACK_AUDIO:
+		return &tl.AudioTracks, nil
+	}
+	return nil, fmt.Errorf("invalid track type %s (video, audio)", trackType)
+}
@@ -0,0 +1,175 @@
+package video
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func sameNodes(t *testing.T, got []VideoNode, expected []VideoNode) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("the timeline lengths do not match: (expected: %d, got: %d)", len(expected), len(got))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("node %d differs\ngot: %+v\nexp: %+v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	t.Run("undo and redo every main track operation", func(t *testing.T) {
+		tl := mockTl()
+		initial := append([]VideoNode{}, tl.VideoNodes...)
+
+		if _, err := tl.Insert("4", "Node", 1, 10, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Split(EVT_INTERVAL_CUT, 2, 4, 6); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.RenameVideoNode(0, "Intro"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.MarkAllLossless(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.DeleteRIDReferences("1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.Delete(0); err != nil {
+			t.Fatal(err)
+		}
+		edited := append([]VideoNode{}, tl.VideoNodes...)
+
+		for i := 0; i < 6; i++ {
+			if _, err := tl.Undo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sameNodes(t, tl.VideoNodes, initial)
+		if _, err := tl.Undo(); err == nil {
+			t.Errorf("history is empty and it should have failed")
+		}
+
+		for i := 0; i < 6; i++ {
+			if _, err := tl.Redo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sameNodes(t, tl.VideoNodes, edited)
+	})
+
+	t.Run("a new operation clears the redo history", func(t *testing.T) {
+		tl := mockTl()
+		if err := tl.Delete(0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.ToggleLossless(0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Redo(); err == nil {
+			t.Errorf("redo history should be empty after a new operation")
+		}
+	})
+
+	t.Run("undo track operations", func(t *testing.T) {
+		tl := NewTimeline()
+		track, _ := tl.AddTrack(TRACK_AUDIO, "music")
+		if _, err := tl.InsertTrackNode(track.ID, "1", "Node", 0, 5, 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.RemoveTrack(track.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := tl.GetTrack(track.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(restored.Nodes) != 1 {
+			t.Errorf("the removed track was not restored with its nodes")
+		}
+
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if len(tl.AudioTracks) != 0 {
+			t.Errorf("expected no audio tracks, got %d", len(tl.AudioTracks))
+		}
+	})
+
+	t.Run("history survives a save and load", func(t *testing.T) {
+		tl := mockTl()
+		initial := append([]VideoNode{}, tl.VideoNodes...)
+		if _, err := tl.Split(EVT_SLICE_CUT, 1, 4.2, 5); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := json.Marshal(tl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded Timeline
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loaded.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		sameNodes(t, loaded.VideoNodes, initial)
+	})
+
+	t.Run("failed undo and redo leave the timeline unchanged", func(t *testing.T) {
+		tl := mockTl()
+		initial := append([]VideoNode{}, tl.VideoNodes...)
+		// the first edit is out of sync with the timeline, the second one is not
+		cmd := Command{Op: OP_INSERT, Edits: []Edit{
+			{Track: MAIN_TRACK_ID, Pos: 0, Inserted: []VideoNode{{ID: "missing"}}},
+			{Track: MAIN_TRACK_ID, Pos: 0, Inserted: []VideoNode{initial[0]}},
+		}}
+		tl.History.Undo = []Command{cmd}
+		if _, err := tl.Undo(); err == nil {
+			t.Fatal("expected the undo to fail")
+		}
+		sameNodes(t, tl.VideoNodes, initial)
+		if len(tl.History.Undo) != 1 || len(tl.History.Redo) != 0 {
+			t.Errorf("expected the command to stay in the undo history, got %+v", tl.History)
+		}
+
+		cmd = Command{Op: OP_DELETE, Edits: []Edit{
+			{Track: MAIN_TRACK_ID, Pos: 0, Removed: []VideoNode{initial[0]}},
+			{Track: MAIN_TRACK_ID, Pos: 0, Removed: []VideoNode{{ID: "missing"}}},
+		}}
+		tl.History = History{Redo: []Command{cmd}}
+		if _, err := tl.Redo(); err == nil {
+			t.Fatal("expected the redo to fail")
+		}
+		sameNodes(t, tl.VideoNodes, initial)
+		if len(tl.History.Redo) != 1 || len(tl.History.Undo) != 0 {
+			t.Errorf("expected the command to stay in the redo history, got %+v", tl.History)
+		}
+	})
+
+	t.Run("history is bounded", func(t *testing.T) {
+		tl := mockTl()
+		for i := 0; i < HISTORY_LIMIT+10; i++ {
+			if err := tl.ToggleLossless(0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(tl.History.Undo) != HISTORY_LIMIT {
+			t.Errorf("expected %d commands in history, got %d", HISTORY_LIMIT, len(tl.History.Undo))
+		}
+	})
+}
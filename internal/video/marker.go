@@ -0,0 +1,118 @@
+package video
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MARKER_DEFAULT_COLOR: the color of a marker when none is given
+	MARKER_DEFAULT_COLOR = "#facc15"
+	// OP_ADD_MARKER: adds a marker to the timeline
+	OP_ADD_MARKER = "add_marker"
+	// OP_MOVE_MARKER: moves a marker of the timeline
+	OP_MOVE_MARKER = "move_marker"
+	// OP_REMOVE_MARKER: removes a marker from the timeline
+	OP_REMOVE_MARKER = "remove_marker"
+	// LIST_MARKERS: the edit is applied to the markers of the timeline
+	LIST_MARKERS = "markers"
+)
+
+var markerColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type Marker struct {
+	// ID: the ID of the marker
+	ID string `json:"id"`
+	// Name: the note of the marker, used as the chapter title on export
+	Name string `json:"name"`
+	// Color: the color of the marker (#rrggbb)
+	Color string `json:"color"`
+	// Position: the time of the marker in the timeline, in seconds
+	Position float64 `json:"position"`
+}
+
+// AddMarker: places a named marker at a position (seconds) of the timeline
+func (tl *Timeline) AddMarker(name string, color string, position float64) (Marker, error) {
+	if position < 0 {
+		return Marker{}, fmt.Errorf("marker position %.4f is invalid", position)
+	}
+	if color == "" {
+		color = MARKER_DEFAULT_COLOR
+	}
+	if !markerColorRegex.MatchString(color) {
+		return Marker{}, fmt.Errorf("invalid marker color %s (#rrggbb)", color)
+	}
+	if name == "" {
+		name = "Marker"
+	}
+
+	marker := Marker{
+		ID:       strings.Replace(uuid.New().String(), "-", "", -1),
+		Name:     name,
+		Color:    strings.ToLower(color),
+		Position: position,
+	}
+	if err := tl.execute(OP_ADD_MARKER, Edit{List: LIST_MARKERS, Pos: tl.markerPlacement(position), InsertedMarkers: []Marker{marker}}); err != nil {
+		return Marker{}, err
+	}
+	return marker, nil
+}
+
+// MoveMarker: changes the position (seconds) of a marker, markers are kept ordered by their position
+func (tl *Timeline) MoveMarker(markerID string, position float64) (Marker, error) {
+	if position < 0 {
+		return Marker{}, fmt.Errorf("marker position %.4f is invalid", position)
+	}
+	from := tl.markerIndex(markerID)
+	if from < 0 {
+		return Marker{}, fmt.Errorf("marker %s does not exists", markerID)
+	}
+
+	marker := tl.Markers[from]
+	moved := marker
+	moved.Position = position
+
+	// the placement is computed without the marker being moved
+	rest := Timeline{Markers: slices.Delete(slices.Clone(tl.Markers), from, from+1)}
+	err := tl.execute(OP_MOVE_MARKER,
+		Edit{List: LIST_MARKERS, Pos: from, RemovedMarkers: []Marker{marker}},
+		Edit{List: LIST_MARKERS, Pos: rest.markerPlacement(position), InsertedMarkers: []Marker{moved}})
+	if err != nil {
+		return Marker{}, err
+	}
+	return moved, nil
+}
+
+// RemoveMarker: deletes a marker from the timeline
+func (tl *Timeline) RemoveMarker(markerID string) error {
+	idx := tl.markerIndex(markerID)
+	if idx < 0 {
+		return fmt.Errorf("marker %s does not exists", markerID)
+	}
+	return tl.execute(OP_REMOVE_MARKER, Edit{List: LIST_MARKERS, Pos: idx, RemovedMarkers: []Marker{tl.Markers[idx]}})
+}
+
+// ListMarkers: returns the markers of the timeline ordered by their position
+func (tl *Timeline) ListMarkers() []Marker {
+	return slices.Clone(tl.Markers)
+}
+
+// markerPlacement: the index at which a marker at position should be inserted, after the markers at the same position
+func (tl *Timeline) markerPlacement(position float64) int {
+	idx := 0
+	for i, marker := range tl.Markers {
+		if marker.Position <= position {
+			idx = i + 1
+		}
+	}
+	return idx
+}
+
+// markerIndex: the index of a marker by its id (-1 if it does not exists)
+func (tl *Timeline) markerIndex(markerID string) int {
+	return slices.IndexFunc(tl.Markers, func(m Marker) bool { return m.ID == markerID })
+}
@@ -0,0 +1,91 @@
+package video
+
+import (
+	"testing"
+)
+
+func markerNames(markers []Marker) []string {
+	names := []string{}
+	for _, marker := range markers {
+		names = append(names, marker.Name)
+	}
+	return names
+}
+
+func TestMarkers(t *testing.T) {
+	t.Run("markers are kept ordered by position", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.AddMarker("Outro", "#00FF00", 10); err != nil {
+			t.Fatal(err)
+		}
+		intro, err := tl.AddMarker("Intro", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intro.Color != MARKER_DEFAULT_COLOR {
+			t.Errorf("got color %s, expected %s", intro.Color, MARKER_DEFAULT_COLOR)
+		}
+		if _, err := tl.AddMarker("Middle", "#0000ff", 5); err != nil {
+			t.Fatal(err)
+		}
+		if got := markerNames(tl.ListMarkers()); got[0] != "Intro" || got[1] != "Middle" || got[2] != "Outro" {
+			t.Errorf("got markers %v, expected [Intro Middle Outro]", got)
+		}
+
+		if _, err := tl.MoveMarker(intro.ID, 12); err != nil {
+			t.Fatal(err)
+		}
+		if got := markerNames(tl.ListMarkers()); got[0] != "Middle" || got[1] != "Outro" || got[2] != "Intro" {
+			t.Errorf("got markers %v, expected [Middle Outro Intro]", got)
+		}
+	})
+
+	t.Run("invalid markers are rejected", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.AddMarker("Marker", "red", 1); err == nil {
+			t.Errorf("red is not a valid marker color")
+		}
+		if _, err := tl.AddMarker("Marker", "", -1); err == nil {
+			t.Errorf("a marker cannot be placed before the timeline")
+		}
+		if _, err := tl.MoveMarker("nothing", 1); err == nil {
+			t.Errorf("the marker does not exists")
+		}
+	})
+
+	t.Run("undo and redo markers", func(t *testing.T) {
+		tl := mockTl()
+
+		marker, err := tl.AddMarker("Note", "", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.AddMarker("Other", "", 4); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.MoveMarker(marker.ID, 6); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.RemoveMarker(marker.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if markers := tl.ListMarkers(); len(markers) != 2 || markers[0].ID != marker.ID || markers[0].Position != 2 {
+			t.Errorf("expected the marker to be back at 2, got %+v", markers)
+		}
+		if _, err := tl.Redo(); err != nil {
+			t.Fatal(err)
+		}
+		if markers := tl.ListMarkers(); markers[1].ID != marker.ID || markers[1].Position != 6 {
+			t.Errorf("expected the marker to be moved to 6, got %+v", markers)
+		}
+	})
+}
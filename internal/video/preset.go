@@ -0,0 +1,289 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PRESETS_VERSION: the version of the presets documents written by this build
+const PRESETS_VERSION = 1
+
+// ExportPreset: a named set of export settings, the file name and paths are given on each export
+type ExportPreset struct {
+	// ID: the unique identifier of the preset
+	ID string `json:"id"`
+	// Name: the name of the preset shown to the user
+	Name string `json:"name"`
+	// BuiltIn: the preset ships with gahara, it cannot be updated or deleted
+	BuiltIn bool `json:"builtin"`
+	// Resolution (640x480,1280x720, 1920x1080, 2560x1440, 3840x2160)
+	Resolution string `json:"resolution"`
+	// Codec: video codec (libx264, libx265)
+	Codec string `json:"codec"`
+	// CRF: Constant Rate Factor
+	CRF string `json:"crf"`
+	// Preset: Encoding speed to compression ratio
+	Preset string `json:"preset"`
+	// AudioCodec: audio codec (aac, libopus), the default codec of the video format is used if empty
+	AudioCodec string `json:"audio_codec,omitempty"`
+	// AudioBitrate: the bitrate of the audio (128k, 192k, 320k), the encoder default is used if empty
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+	// VideoFormat: the video format (.mov, .mp4)
+	VideoFormat string `json:"video_format"`
+	// RateControl: how the video bitrate is chosen (crf, bitrate, target_size), crf if empty
+	RateControl string `json:"rate_control,omitempty"`
+	// VideoBitrate: the target video bitrate of the bitrate rate control (2500k, 8M)
+	VideoBitrate string `json:"video_bitrate,omitempty"`
+	// MaxRate: the maximum video bitrate, set together with BufSize
+	MaxRate string `json:"maxrate,omitempty"`
+	// BufSize: the size of the rate control buffer, set together with MaxRate
+	BufSize string `json:"bufsize,omitempty"`
+	// TargetSize: the size of the output in MB of the target_size rate control
+	TargetSize float64 `json:"target_size,omitempty"`
+	// TwoPass: encodes the video in two passes
+	TwoPass bool `json:"two_pass,omitempty"`
+}
+
+// getBuiltInPresets: the presets that ship with gahara
+func getBuiltInPresets() []ExportPreset {
+	return []ExportPreset{
+		{ID: "web-1080p-h264", Name: "Web 1080p (H.264)", BuiltIn: true, Resolution: SCALE_1920X1080, Codec: CODEC_H264, CRF: CRF_23, Preset: PRESET_MEDIUM, AudioCodec: AUDIO_CODEC_AAC, AudioBitrate: AUDIO_BITRATE_192K, VideoFormat: ".mp4"},
+		{ID: "web-720p-h264", Name: "Web 720p (H.264)", BuiltIn: true, Resolution: SCALE_1280X720, Codec: CODEC_H264, CRF: CRF_23, Preset: PRESET_FAST, AudioCodec: AUDIO_CODEC_AAC, AudioBitrate: AUDIO_BITRATE_128K, VideoFormat: ".mp4"},
+		{ID: "archival-2160p-h265", Name: "Archival 4K (H.265)", BuiltIn: true, Resolution: SCALE_3840X2160, Codec: CODEC_H265, CRF: CRF_18, Preset: PRESET_SLOW, AudioCodec: AUDIO_CODEC_AAC, AudioBitrate: AUDIO_BITRATE_320K, VideoFormat: ".mkv"},
+		{ID: "archival-1080p-h265", Name: "Archival 1080p (H.265)", BuiltIn: true, Resolution: SCALE_1920X1080, Codec: CODEC_H265, CRF: CRF_18, Preset: PRESET_SLOW, AudioCodec: AUDIO_CODEC_AAC, AudioBitrate: AUDIO_BITRATE_320K, VideoFormat: ".mkv"},
+		{ID: "delivery-1080p-h264", Name: "Delivery 1080p 8 Mbit/s (H.264, two-pass)", BuiltIn: true, Resolution: SCALE_1920X1080, Codec: CODEC_H264, Preset: PRESET_SLOW, AudioCodec: AUDIO_CODEC_AAC, AudioBitrate: AUDIO_BITRATE_192K, VideoFormat: ".mp4", RateControl: RATE_CONTROL_BITRATE, VideoBitrate: "8M", MaxRate: "10M", BufSize: "16M", TwoPass: true},
+		{ID: "webm-1080p-vp9", Name: "WebM 1080p (VP9)", BuiltIn: true, Resolution: SCALE_1920X1080, Codec: CODEC_VP9, CRF: CRF_23, Preset: PRESET_MEDIUM, AudioCodec: AUDIO_CODEC_OPUS, AudioBitrate: AUDIO_BITRATE_128K, VideoFormat: ".webm"},
+	}
+}
+
+// ProcessingOpts: the processing options of the preset for an export to a file
+func (p ExportPreset) ProcessingOpts(filename string, outputPath string) ProcessingOpts {
+	return ProcessingOpts{
+		Resolution:   p.Resolution,
+		Codec:        p.Codec,
+		CRF:          p.CRF,
+		Preset:       p.Preset,
+		AudioCodec:   p.AudioCodec,
+		AudioBitrate: p.AudioBitrate,
+		OutputPath:   outputPath,
+		Filename:     filename,
+		VideoFormat:  p.VideoFormat,
+		RateControl:  p.RateControl,
+		VideoBitrate: p.VideoBitrate,
+		MaxRate:      p.MaxRate,
+		BufSize:      p.BufSize,
+		TargetSize:   p.TargetSize,
+		TwoPass:      p.TwoPass,
+	}
+}
+
+// Validate: checks that the preset has a name and that its settings are a valid filtergraph export
+func (p ExportPreset) Validate() error {
+	verr := &ValidationError{}
+	if strings.TrimSpace(p.Name) == "" {
+		verr.Add("name", VALIDATION_REQUIRED, "preset name was not provided")
+	}
+	if p.Resolution == "" {
+		verr.Add("resolution", VALIDATION_REQUIRED, "resolution was not provided")
+	}
+	if p.CRF == "" && (p.RateControl == "" || p.RateControl == RATE_CONTROL_CRF) {
+		verr.Add("crf", VALIDATION_REQUIRED, "constant rate factor was not provided")
+	}
+	if p.Preset == "" {
+		verr.Add("preset", VALIDATION_REQUIRED, "encoding preset was not provided")
+	}
+	// the file name and output path are given on export, placeholders are validated in their place
+	opts := p.ProcessingOpts("preset", ".")
+	verr.Merge("", opts.ValidateRequiredFields(QUERY_FILTERGRAPH))
+	return verr.Err()
+}
+
+// PresetRegistry: the export presets, the built-in presets followed by the presets saved by the user
+type PresetRegistry struct {
+	// userPresets: the presets saved by the user
+	userPresets []ExportPreset
+	// rejected: the saved presets that could not be loaded, they are saved again as they were read
+	rejected []RejectedPreset
+}
+
+// RejectedPreset: a saved preset that could not be loaded (invalid, or with the name or id of another preset)
+type RejectedPreset struct {
+	// Name: the name of the preset, empty if it could not be decoded
+	Name string
+	// Reason: the reason the preset was rejected
+	Reason error
+	// data: the preset as it was read
+	data json.RawMessage
+}
+
+// presetsDocument: the presets of the user as saved in presets.json
+type presetsDocument struct {
+	// Version: the version of the presets schema
+	Version int `json:"version"`
+	// Presets: the presets saved by the user, decoded one by one so an invalid preset does not reject the others
+	Presets []json.RawMessage `json:"presets"`
+}
+
+func NewPresetRegistry() *PresetRegistry {
+	return &PresetRegistry{userPresets: []ExportPreset{}}
+}
+
+/*
+UnmarshalPresets: decodes the presets of the user. The invalid presets and the presets with the name or id of another
+preset are not loaded, they are reported by Rejected and kept as they are when the presets are marshalled again
+*/
+func UnmarshalPresets(data []byte) (*PresetRegistry, error) {
+	var doc presetsDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid presets document: %s", err.Error())
+	}
+	if doc.Version > PRESETS_VERSION {
+		return nil, fmt.Errorf("the presets were saved by a newer version of gahara (presets version %d, supported up to %d)", doc.Version, PRESETS_VERSION)
+	}
+
+	registry := NewPresetRegistry()
+	for _, data := range doc.Presets {
+		var preset ExportPreset
+		if err := json.Unmarshal(data, &preset); err != nil {
+			registry.rejected = append(registry.rejected, RejectedPreset{Reason: fmt.Errorf("invalid preset: %s", err.Error()), data: data})
+			continue
+		}
+		preset.BuiltIn = false
+		if err := registry.loadable(preset); err != nil {
+			registry.rejected = append(registry.rejected, RejectedPreset{Name: preset.Name, Reason: err, data: data})
+			continue
+		}
+		registry.userPresets = append(registry.userPresets, preset)
+	}
+	return registry, nil
+}
+
+// loadable: checks if a saved preset can be added to the registry
+func (r *PresetRegistry) loadable(preset ExportPreset) error {
+	if preset.ID == "" {
+		return fmt.Errorf("the preset has no id")
+	}
+	if err := preset.Validate(); err != nil {
+		return err
+	}
+	if r.nameTaken(preset.Name, preset.ID) {
+		return fmt.Errorf("a preset named %s already exists", preset.Name)
+	}
+	if _, ok := r.Get(preset.ID); ok {
+		return fmt.Errorf("a preset with id %s already exists", preset.ID)
+	}
+	return nil
+}
+
+// Marshal: encodes the presets of the user, followed by the rejected presets as they were read
+func (r *PresetRegistry) Marshal() ([]byte, error) {
+	doc := presetsDocument{Version: PRESETS_VERSION, Presets: []json.RawMessage{}}
+	for _, preset := range r.userPresets {
+		data, err := json.Marshal(preset)
+		if err != nil {
+			return nil, err
+		}
+		doc.Presets = append(doc.Presets, data)
+	}
+	for _, rejected := range r.rejected {
+		doc.Presets = append(doc.Presets, rejected.data)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Rejected: returns the saved presets that could not be loaded
+func (r *PresetRegistry) Rejected() []RejectedPreset {
+	return append([]RejectedPreset{}, r.rejected...)
+}
+
+// List: returns the built-in presets followed by the presets of the user
+func (r *PresetRegistry) List() []ExportPreset {
+	return append(getBuiltInPresets(), r.userPresets...)
+}
+
+// Get: returns the preset with the given id
+func (r *PresetRegistry) Get(id string) (ExportPreset, bool) {
+	for _, preset := range r.List() {
+		if preset.ID == id {
+			return preset, true
+		}
+	}
+	return ExportPreset{}, false
+}
+
+// Create: validates and adds a preset of the user, a new id is assigned to it
+func (r *PresetRegistry) Create(preset ExportPreset) (ExportPreset, error) {
+	preset.ID = strings.Replace(uuid.New().String(), "-", "", -1)
+	preset.BuiltIn = false
+	preset.Name = strings.TrimSpace(preset.Name)
+	if err := r.validate(preset); err != nil {
+		return ExportPreset{}, err
+	}
+
+	r.userPresets = append(r.userPresets, preset)
+	return preset, nil
+}
+
+// Update: validates and replaces the preset of the user with the same id, built-in presets cannot be updated
+func (r *PresetRegistry) Update(preset ExportPreset) (ExportPreset, error) {
+	idx, err := r.userPresetIndex(preset.ID)
+	if err != nil {
+		return ExportPreset{}, err
+	}
+	preset.BuiltIn = false
+	preset.Name = strings.TrimSpace(preset.Name)
+	if err := r.validate(preset); err != nil {
+		return ExportPreset{}, err
+	}
+
+	r.userPresets[idx] = preset
+	return preset, nil
+}
+
+// Delete: removes the preset of the user with the given id, built-in presets cannot be deleted
+func (r *PresetRegistry) Delete(id string) error {
+	idx, err := r.userPresetIndex(id)
+	if err != nil {
+		return err
+	}
+	r.userPresets = append(r.userPresets[:idx], r.userPresets[idx+1:]...)
+	return nil
+}
+
+// validate: validates a preset, and checks that no other preset has its name
+func (r *PresetRegistry) validate(preset ExportPreset) error {
+	verr := &ValidationError{}
+	verr.Merge("", preset.Validate())
+	if !verr.HasField("name") && r.nameTaken(preset.Name, preset.ID) {
+		verr.Add("name", VALIDATION_DUPLICATE, "a preset named %s already exists", preset.Name)
+	}
+	return verr.Err()
+}
+
+// userPresetIndex: returns the index of a preset of the user
+func (r *PresetRegistry) userPresetIndex(id string) (int, error) {
+	for i, preset := range r.userPresets {
+		if preset.ID == id {
+			return i, nil
+		}
+	}
+	for _, preset := range getBuiltInPresets() {
+		if preset.ID == id {
+			return -1, fmt.Errorf("built-in preset %s cannot be modified", preset.Name)
+		}
+	}
+	return -1, fmt.Errorf("preset with id %s was not found", id)
+}
+
+// nameTaken: checks if a preset other than the one with the given id has the name (case insensitive)
+func (r *PresetRegistry) nameTaken(name string, id string) bool {
+	for _, preset := range r.List() {
+		if preset.ID != id && strings.EqualFold(preset.Name, strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package video
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mockPreset(name string) ExportPreset {
+	return ExportPreset{Name: name, Resolution: SCALE_1280X720, Codec: CODEC_H264, CRF: CRF_20, Preset: PRESET_FAST, VideoFormat: ".mp4"}
+}
+
+func TestBuiltInPresets(t *testing.T) {
+	for _, preset := range getBuiltInPresets() {
+		if err := preset.Validate(); err != nil {
+			t.Errorf("built-in preset %s is invalid: %s", preset.Name, err.Error())
+		}
+	}
+}
+
+func TestPresetRegistry(t *testing.T) {
+	t.Run("create, update, and delete", func(t *testing.T) {
+		registry := NewPresetRegistry()
+		created, err := registry.Create(mockPreset("  Draft 720p "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.ID == "" || created.BuiltIn || created.Name != "Draft 720p" {
+			t.Errorf("unexpected created preset %+v", created)
+		}
+		if got := registry.List(); len(got) != len(getBuiltInPresets())+1 || got[len(got)-1].ID != created.ID {
+			t.Errorf("expected the preset to be listed after the built-in presets, got %+v", got)
+		}
+
+		created.CRF = CRF_18
+		if _, err := registry.Update(created); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := registry.Get(created.ID); got.CRF != CRF_18 {
+			t.Errorf("expected the crf to be updated, got %s", got.CRF)
+		}
+
+		if err := registry.Delete(created.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := registry.Get(created.ID); ok {
+			t.Errorf("expected the preset to be deleted")
+		}
+	})
+
+	t.Run("invalid presets are rejected", func(t *testing.T) {
+		registry := NewPresetRegistry()
+		tests := []struct {
+			name   string
+			preset ExportPreset
+			err    string
+		}{
+			{name: "no name", preset: mockPreset(" "), err: "name"},
+			{name: "duplicated name", preset: mockPreset("web 1080p (h.264)"), err: "already exists"},
+			{name: "incompatible codec", preset: func() ExportPreset { p := mockPreset("vp9 mp4"); p.Codec = CODEC_VP9; return p }(), err: "codec"},
+			{name: "no format", preset: func() ExportPreset { p := mockPreset("no format"); p.VideoFormat = ""; return p }(), err: "video format"},
+			{name: "no crf", preset: func() ExportPreset { p := mockPreset("no crf"); p.CRF = ""; return p }(), err: "constant rate factor"},
+		}
+		for _, tt := range tests {
+			if _, err := registry.Create(tt.preset); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("built-in presets cannot be modified", func(t *testing.T) {
+		registry := NewPresetRegistry()
+		builtIn := getBuiltInPresets()[0]
+		builtIn.CRF = CRF_18
+		if _, err := registry.Update(builtIn); err == nil {
+			t.Errorf("expected the update of a built-in preset to fail")
+		}
+		if err := registry.Delete(builtIn.ID); err == nil {
+			t.Errorf("expected the deletion of a built-in preset to fail")
+		}
+	})
+
+	t.Run("marshal and unmarshal", func(t *testing.T) {
+		registry := NewPresetRegistry()
+		created, err := registry.Create(mockPreset("Draft 720p"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := registry.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := UnmarshalPresets(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := loaded.Get(created.ID); !ok || got != created {
+			t.Errorf("expected %+v to be loaded, got %+v", created, got)
+		}
+
+		if _, err := UnmarshalPresets([]byte(`{"version": 99, "presets": []}`)); err == nil {
+			t.Errorf("expected presets of a newer version to be rejected")
+		}
+	})
+
+	t.Run("rejected presets are reported and kept", func(t *testing.T) {
+		data := []byte(`{"version": 1, "presets": [
+			{"id": "a", "name": "Draft", "resolution": "1280x720", "codec": "libx264", "crf": "20", "preset": "fast", "video_format": ".mp4"},
+			{"id": "b", "name": "draft", "resolution": "1280x720", "codec": "libx264", "crf": "20", "preset": "fast", "video_format": ".mp4"},
+			{"id": "c", "name": "Broken", "codec": "libx264"},
+			{"id": 4}
+		]}`)
+		loaded, err := UnmarshalPresets(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := loaded.Get("a"); !ok {
+			t.Errorf("expected the valid preset to be loaded")
+		}
+		names := []string{}
+		for _, rejected := range loaded.Rejected() {
+			names = append(names, rejected.Name)
+		}
+		if !slices.Equal(names, []string{"draft", "Broken", ""}) {
+			t.Errorf("expected the duplicate, invalid and undecodable presets to be rejected, got %v", names)
+		}
+
+		// the rejected presets are saved again as they were read
+		if _, err := loaded.Create(mockPreset("Web")); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := loaded.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloaded, err := UnmarshalPresets(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reloaded.List()) != len(loaded.List()) || len(reloaded.Rejected()) != 3 {
+			t.Errorf("expected the rejected presets to be kept, got %s", saved)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RATE_CONTROL_CRF: the quality is constant (crf), the size of the output varies
+	RATE_CONTROL_CRF = "crf"
+	// RATE_CONTROL_BITRATE: the video is encoded at a target bitrate
+	RATE_CONTROL_BITRATE = "bitrate"
+	// RATE_CONTROL_TARGET_SIZE: the bitrate is computed from the duration of the timeline to hit a file size
+	RATE_CONTROL_TARGET_SIZE = "target_size"
+	// DEFAULT_AUDIO_BITRATE_KBPS: the audio bitrate assumed for the target size when none is set
+	DEFAULT_AUDIO_BITRATE_KBPS = 128
+	// CONTAINER_OVERHEAD: the share of a target size left to the container
+	CONTAINER_OVERHEAD = 0.02
+)
+
+// getTwoPassCodecs: the video codecs that support two-pass encoding
+func getTwoPassCodecs() []string {
+	return []string{CODEC_H264, CODEC_H265, CODEC_VP9}
+}
+
+// GetRateControl: returns the rate control mode of the options (crf if unset)
+func (p ProcessingOpts) GetRateControl() string {
+	if p.RateControl == "" {
+		return RATE_CONTROL_CRF
+	}
+	return p.RateControl
+}
+
+// validateRateControl: checks the rate control options of an export, the violations are added to verr
+func (p ProcessingOpts) validateRateControl(verr *ValidationError) {
+	switch p.GetRateControl() {
+	case RATE_CONTROL_CRF:
+		if p.TwoPass {
+			verr.Add("two_pass", VALIDATION_INCOMPATIBLE, "two-pass encoding requires a target bitrate or size")
+		}
+	case RATE_CONTROL_BITRATE:
+		if !isValidBitrate(p.VideoBitrate) {
+			verr.Add("video_bitrate", VALIDATION_INVALID, "invalid video bitrate %s", p.VideoBitrate)
+		}
+	case RATE_CONTROL_TARGET_SIZE:
+		if p.TargetSize <= 0 {
+			verr.Add("target_size", VALIDATION_INVALID, "the target size must be positive")
+		}
+	default:
+		verr.Add("rate_control", VALIDATION_INVALID, "invalid rate control %s (crf, bitrate, target_size)", p.RateControl)
+	}
+
+	if p.MaxRate == "" && p.BufSize != "" {
+		verr.Add("maxrate", VALIDATION_REQUIRED, "maxrate and bufsize must be set together")
+	}
+	if p.BufSize == "" && p.MaxRate != "" {
+		verr.Add("bufsize", VALIDATION_REQUIRED, "maxrate and bufsize must be set together")
+	}
+	if p.MaxRate != "" && !isValidBitrate(p.MaxRate) {
+		verr.Add("maxrate", VALIDATION_INVALID, "invalid maxrate %s", p.MaxRate)
+	}
+	if p.BufSize != "" && !isValidBitrate(p.BufSize) {
+		verr.Add("bufsize", VALIDATION_INVALID, "invalid bufsize %s", p.BufSize)
+	}
+	if p.TwoPass && p.GetRateControl() != RATE_CONTROL_CRF && !slices.Contains(getTwoPassCodecs(), p.Codec) {
+		verr.Add("two_pass", VALIDATION_UNSUPPORTED, "two-pass encoding is not supported by %s", p.Codec)
+	}
+}
+
+// TargetVideoBitrate: returns the video bitrate (in kbit/s) that fits an export of the given duration in the
+// target size (MB) of the options, the audio bitrate and the container overhead are left out of the budget
+func (p ProcessingOpts) TargetVideoBitrate(duration float64) (string, error) {
+	if p.TargetSize <= 0 {
+		return "", fmt.Errorf("the target size must be positive")
+	}
+	if duration <= 0 {
+		return "", fmt.Errorf("the duration of the export must be positive")
+	}
+
+	audioKbps := DEFAULT_AUDIO_BITRATE_KBPS
+	if p.AudioBitrate != "" {
+		kbps, err := bitrateKbps(p.AudioBitrate)
+		if err != nil {
+			return "", err
+		}
+		audioKbps = kbps
+	}
+
+	totalKbps := p.TargetSize * 1000 * 1000 * 8 * (1 - CONTAINER_OVERHEAD) / duration / 1000
+	videoKbps := int(totalKbps) - audioKbps
+	if videoKbps <= 0 {
+		return "", fmt.Errorf("%.2fMB is too small for %.2fs of video", p.TargetSize, duration)
+	}
+	return fmt.Sprintf("%dk", videoKbps), nil
+}
+
+// bitrateKbps: converts a bitrate (128k, 5M, 64000) to kbit/s
+func bitrateKbps(bitrate string) (int, error) {
+	if !isValidBitrate(bitrate) {
+		return 0, fmt.Errorf("invalid bitrate %s", bitrate)
+	}
+	value := strings.TrimRight(bitrate, "kM")
+	n, _ := strconv.Atoi(value)
+	switch {
+	case strings.HasSuffix(bitrate, "M"):
+		return n * 1000, nil
+	case strings.HasSuffix(bitrate, "k"):
+		return n, nil
+	}
+	return n / 1000, nil
+}
@@ -0,0 +1,65 @@
+package video
+
+import (
+	"strings"
+	"testing"
+)
+
+func mockRateControlOpts() ProcessingOpts {
+	return ProcessingOpts{Filename: "export", OutputPath: ".", VideoFormat: ".mp4", Codec: CODEC_H264, Resolution: SCALE_1920X1080}
+}
+
+func TestValidateRateControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *ProcessingOpts)
+		err    string
+	}{
+		{name: "crf", modify: func(p *ProcessingOpts) { p.CRF = CRF_23 }},
+		{name: "bitrate", modify: func(p *ProcessingOpts) {
+			p.RateControl, p.VideoBitrate, p.MaxRate, p.BufSize, p.TwoPass = RATE_CONTROL_BITRATE, "5M", "6M", "10M", true
+		}},
+		{name: "target size", modify: func(p *ProcessingOpts) { p.RateControl, p.TargetSize = RATE_CONTROL_TARGET_SIZE, 25 }},
+		{name: "invalid bitrate", modify: func(p *ProcessingOpts) { p.RateControl, p.VideoBitrate = RATE_CONTROL_BITRATE, "fast" }, err: "invalid video bitrate"},
+		{name: "no target size", modify: func(p *ProcessingOpts) { p.RateControl = RATE_CONTROL_TARGET_SIZE }, err: "target size"},
+		{name: "maxrate without bufsize", modify: func(p *ProcessingOpts) { p.MaxRate = "6M" }, err: "together"},
+		{name: "two-pass crf", modify: func(p *ProcessingOpts) { p.TwoPass = true }, err: "two-pass"},
+		{name: "two-pass copy", modify: func(p *ProcessingOpts) {
+			p.RateControl, p.VideoBitrate, p.TwoPass, p.Codec = RATE_CONTROL_BITRATE, "5M", true, CODEC_H264_RGB
+		}, err: "not supported"},
+		{name: "unknown rate control", modify: func(p *ProcessingOpts) { p.RateControl = "vbr" }, err: "invalid rate control"},
+	}
+
+	for _, tt := range tests {
+		opts := mockRateControlOpts()
+		tt.modify(&opts)
+		err := opts.ValidateRequiredFields(QUERY_FILTERGRAPH)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err.Error())
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestTargetVideoBitrate(t *testing.T) {
+	opts := mockRateControlOpts()
+	opts.RateControl, opts.TargetSize, opts.AudioBitrate = RATE_CONTROL_TARGET_SIZE, 25, AUDIO_BITRATE_128K
+
+	// 25MB over 100s is 2000 kbit/s, 1960 kbit/s without the container overhead, 1832 kbit/s without the audio
+	bitrate, err := opts.TargetVideoBitrate(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bitrate != "1832k" {
+		t.Errorf("expected 1832k, got %s", bitrate)
+	}
+
+	if _, err := opts.TargetVideoBitrate(100000); err == nil {
+		t.Errorf("expected the target size to be too small for the duration")
+	}
+	if _, err := opts.TargetVideoBitrate(0); err == nil {
+		t.Errorf("expected an error for an empty timeline")
+	}
+}
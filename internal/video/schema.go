@@ -0,0 +1,98 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration: upgrades a saved timeline document to the next version
+type Migration func(doc map[string]any) error
+
+/*
+timelineMigrations: the registry of timeline migrations, the migration at index i upgrades a document from version i
+to version i+1. Documents saved before the version field existed are version 0.
+To change the timeline model, append a migration and the current version moves with it.
+*/
+var timelineMigrations = []Migration{
+	migrateUnversioned,
+}
+
+// TimelineVersion: the version of the timeline documents written by this build
+func TimelineVersion() int {
+	return len(timelineMigrations)
+}
+
+// timelineDocument: the timeline as saved in timeline.json
+type timelineDocument struct {
+	// Version: the version of the timeline schema
+	Version int `json:"version"`
+	Timeline
+}
+
+// MarshalTimeline: encodes a timeline as a versioned document
+func MarshalTimeline(tl Timeline) ([]byte, error) {
+	return json.MarshalIndent(timelineDocument{Version: TimelineVersion(), Timeline: tl}, "", "  ")
+}
+
+// UnmarshalTimeline: decodes a versioned timeline document, older documents are migrated to the current version.
+// Documents saved by a newer version are rejected
+func UnmarshalTimeline(data []byte) (Timeline, error) {
+	var tl Timeline
+	doc := map[string]any{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return tl, fmt.Errorf("invalid timeline document: %s", err.Error())
+	}
+
+	version, err := documentVersion(doc)
+	if err != nil {
+		return tl, err
+	}
+	if version > TimelineVersion() {
+		return tl, fmt.Errorf("the timeline was saved by a newer version of gahara (timeline version %d, supported up to %d), update gahara to open this project", version, TimelineVersion())
+	}
+
+	for v := version; v < TimelineVersion(); v++ {
+		if err := timelineMigrations[v](doc); err != nil {
+			return tl, fmt.Errorf("could not migrate the timeline from version %d to %d: %s", v, v+1, err.Error())
+		}
+		doc["version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return tl, err
+	}
+	if err := json.Unmarshal(migrated, &tl); err != nil {
+		return tl, fmt.Errorf("invalid timeline document: %s", err.Error())
+	}
+	return tl, nil
+}
+
+// documentVersion: reads the version of a timeline document (0 if it has none)
+func documentVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+	version, ok := raw.(float64)
+	if !ok || version < 0 || version != float64(int(version)) {
+		return 0, fmt.Errorf("invalid timeline version %v", raw)
+	}
+	return int(version), nil
+}
+
+// migrateUnversioned: version 0 -> 1, the lists and maps added to the timeline are created when missing.
+// The intervals in seconds are conformed to frames once the frame rate of their media is known
+func migrateUnversioned(doc map[string]any) error {
+	for _, key := range []string{"video_nodes", "video_tracks", "audio_tracks", "transitions", "markers"} {
+		if _, ok := doc[key].([]any); !ok {
+			doc[key] = []any{}
+		}
+	}
+	for _, key := range []string{"frame_rates", "source_durations"} {
+		if _, ok := doc[key].(map[string]any); !ok {
+			doc[key] = map[string]any{}
+		}
+	}
+	return nil
+}
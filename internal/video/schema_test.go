@@ -0,0 +1,59 @@
+package video
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTimelineSchema(t *testing.T) {
+	t.Run("saved timelines are versioned", func(t *testing.T) {
+		tl := mockTl()
+		if _, err := tl.AddMarker("Note", "", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := MarshalTimeline(*tl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), fmt.Sprintf("\"version\": %d", TimelineVersion())) {
+			t.Errorf("expected the document to have version %d, got: %s", TimelineVersion(), data)
+		}
+
+		loaded, err := UnmarshalTimeline(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sameNodes(t, loaded.VideoNodes, tl.VideoNodes)
+		if len(loaded.Markers) != 1 || len(loaded.History.Undo) != 1 {
+			t.Errorf("expected the markers and history to be loaded, got %+v", loaded)
+		}
+	})
+
+	t.Run("unversioned timelines are migrated", func(t *testing.T) {
+		data := []byte(`{"video_nodes":[{"start":4.2,"end":6.9,"rid":"1","id":"a","name":"Node","losslessexport":false}]}`)
+
+		loaded, err := UnmarshalTimeline(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded.VideoNodes) != 1 || loaded.VideoNodes[0].End != 6.9 || !loaded.VideoNodes[0].isLegacy() {
+			t.Errorf("expected the legacy node to be kept, got %+v", loaded.VideoNodes)
+		}
+		if loaded.VideoTracks == nil || loaded.AudioTracks == nil || loaded.Transitions == nil || loaded.Markers == nil || loaded.FrameRates == nil || loaded.SourceDurations == nil {
+			t.Errorf("expected the missing lists to be created, got %+v", loaded)
+		}
+	})
+
+	t.Run("timelines from a newer version are rejected", func(t *testing.T) {
+		data := []byte(fmt.Sprintf(`{"version":%d,"video_nodes":[]}`, TimelineVersion()+1))
+		if _, err := UnmarshalTimeline(data); err == nil || !strings.Contains(err.Error(), "newer version") {
+			t.Errorf("expected a newer version error, got: %v", err)
+		}
+
+		if _, err := UnmarshalTimeline([]byte(`{"version":"one"}`)); err == nil {
+			t.Errorf("expected an invalid version to be rejected")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// MIN_SPEED: the slowest playback speed of a video node
+	MIN_SPEED = 0.1
+	// MAX_SPEED: the fastest playback speed of a video node
+	MAX_SPEED = 16.0
+	// OP_SET_SPEED: changes the playback speed of a video node
+	OP_SET_SPEED = "set_speed"
+)
+
+// SetSpeed: changes the playback speed of the video node at pos of a track (MAIN_TRACK_ID for the main track).
+// The node keeps its interval, its length in the timeline is scaled by the speed
+func (tl *Timeline) SetSpeed(trackID string, pos int, speed float64) (VideoNode, error) {
+	if speed < MIN_SPEED || speed > MAX_SPEED {
+		return VideoNode{}, fmt.Errorf("invalid speed %.2f (%.1fx - %.1fx)", speed, MIN_SPEED, MAX_SPEED)
+	}
+	nodes, err := tl.trackNodes(trackID)
+	if err != nil {
+		return VideoNode{}, err
+	}
+	if pos < 0 || pos >= len(*nodes) {
+		return VideoNode{}, fmt.Errorf("speed position %d is invalid", pos)
+	}
+
+	videoNode := (*nodes)[pos]
+	videoNode.Speed = speed
+	if speed == 1 {
+		videoNode.Speed = 0
+	}
+
+	if trackID == MAIN_TRACK_ID {
+		// the transitions must still fit in the clips at their new length
+		next := *tl
+		next.VideoNodes = slices.Clone(tl.VideoNodes)
+		next.VideoNodes[pos] = videoNode
+		if err := next.ValidateTransitions(); err != nil {
+			return VideoNode{}, err
+		}
+	} else {
+		track, _ := tl.GetTrack(trackID)
+		rest := Track{Name: track.Name, Nodes: slices.Delete(slices.Clone(track.Nodes), pos, pos+1)}
+		if _, err := rest.placement(videoNode); err != nil {
+			return VideoNode{}, err
+		}
+	}
+
+	if err := tl.execute(OP_SET_SPEED, Edit{Track: trackID, Pos: pos, Removed: []VideoNode{(*nodes)[pos]}, Inserted: []VideoNode{videoNode}}); err != nil {
+		return VideoNode{}, err
+	}
+	return videoNode, nil
+}
@@ -0,0 +1,90 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSetSpeed(t *testing.T) {
+	t.Run("speed scales the length of the clip in the timeline", func(t *testing.T) {
+		tl := mockTl()
+		duration := tl.Duration()
+		clip := tl.VideoNodes[1].Duration()
+
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if got := tl.Duration(); math.Abs(got-(duration-clip/2)) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration-clip/2)
+		}
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 1, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if got := tl.Duration(); math.Abs(got-(duration+clip)) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration+clip)
+		}
+
+		nodes, err := tl.Split(EVT_SLICE_CUT, 1, 4.2, 5.2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nodes[0].Speed != 0.5 || nodes[1].Speed != 0.5 {
+			t.Errorf("the split clips should keep their speed, got %.2f and %.2f", nodes[0].Speed, nodes[1].Speed)
+		}
+
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := tl.Duration(); math.Abs(got-duration) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration)
+		}
+	})
+
+	t.Run("invalid speeds are rejected", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 0, 0); err == nil {
+			t.Errorf("a clip cannot be stopped")
+		}
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 0, MAX_SPEED+1); err == nil {
+			t.Errorf("the speed is over the maximum speed")
+		}
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, len(tl.VideoNodes), 2); err == nil {
+			t.Errorf("there is no clip at that position")
+		}
+
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 1, 2); err == nil {
+			t.Errorf("the transition no longer fits in the faster clip")
+		}
+	})
+
+	t.Run("slowed track nodes cannot overlap", func(t *testing.T) {
+		tl := mockTl()
+		track, err := tl.AddTrack(TRACK_VIDEO, "Overlay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "1", "First", 0, 2, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "1", "Second", 0, 2, 3); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tl.SetSpeed(track.ID, 0, 0.5); err == nil {
+			t.Errorf("the slowed node overlaps with the next node")
+		}
+		if _, err := tl.SetSpeed(track.ID, 0, 0.8); err != nil {
+			t.Fatal(err)
+		}
+		if got := tl.VideoTracks[0].Duration(); math.Abs(got-5) > Epsilon {
+			t.Errorf("got track duration %.4f, expected 5", got)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package video
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rational: a rational number, used for the frame rate of the media (30000/1001 for 29.97 fps)
+type Rational struct {
+	// Num: the numerator
+	Num int64 `json:"num"`
+	// Den: the denominator
+	Den int64 `json:"den"`
+}
+
+// DefaultFrameRate: the frame rate used when the frame rate of the media is unknown
+func DefaultFrameRate() Rational {
+	return Rational{Num: 30, Den: 1}
+}
+
+func getNTSCFrameRates() []int64 {
+	return []int64{24, 30, 48, 60, 120}
+}
+
+// NewRational: creates a rational number in its reduced form
+func NewRational(num, den int64) (Rational, error) {
+	if num <= 0 || den <= 0 {
+		return Rational{}, fmt.Errorf("invalid rational %d/%d", num, den)
+	}
+	g := gcd(num, den)
+	return Rational{Num: num / g, Den: den / g}, nil
+}
+
+/*
+ParseFrameRate: parses a frame rate given as a rational or as a decimal number.
+Ex: 30000/1001 -> 30000/1001, 29.97 -> 30000/1001, 25 -> 25/1
+*/
+func ParseFrameRate(frameRate string) (Rational, error) {
+	frameRate = strings.TrimSpace(frameRate)
+	if num, den, ok := strings.Cut(frameRate, "/"); ok {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return Rational{}, fmt.Errorf("invalid frame rate %s", frameRate)
+		}
+		d, err := strconv.ParseInt(den, 10, 64)
+		if err != nil {
+			return Rational{}, fmt.Errorf("invalid frame rate %s", frameRate)
+		}
+		return NewRational(n, d)
+	}
+
+	fps, err := strconv.ParseFloat(frameRate, 64)
+	if err != nil || fps <= 0 {
+		return Rational{}, fmt.Errorf("invalid frame rate %s", frameRate)
+	}
+	// decimal frame rates are rounded, the NTSC rates are recovered from them
+	for _, rate := range getNTSCFrameRates() {
+		if math.Abs(fps-float64(rate*1000)/1001) < 0.01 {
+			return NewRational(rate*1000, 1001)
+		}
+	}
+	if math.Abs(fps-math.Round(fps)) < 0.001 {
+		return NewRational(int64(math.Round(fps)), 1)
+	}
+	return NewRational(int64(math.Round(fps*1000)), 1000)
+}
+
+// IsValid: checks that the rational can be used as a frame rate
+func (r Rational) IsValid() bool {
+	return r.Num > 0 && r.Den > 0
+}
+
+// Float: the decimal value of the rational
+func (r Rational) Float() float64 {
+	return float64(r.Num) / float64(r.Den)
+}
+
+// Frames: converts a time in seconds to the nearest frame boundary
+func (r Rational) Frames(seconds float64) int64 {
+	return int64(math.Round(seconds * float64(r.Num) / float64(r.Den)))
+}
+
+// Seconds: converts a number of frames to seconds
+func (r Rational) Seconds(frames int64) float64 {
+	return float64(frames*r.Den) / float64(r.Num)
+}
+
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
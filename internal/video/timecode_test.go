@@ -0,0 +1,101 @@
+package video
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		frameRate string
+		expected  Rational
+	}{
+		{frameRate: "30000/1001", expected: Rational{Num: 30000, Den: 1001}},
+		{frameRate: "29.97", expected: Rational{Num: 30000, Den: 1001}},
+		{frameRate: "23.98", expected: Rational{Num: 24000, Den: 1001}},
+		{frameRate: "25", expected: Rational{Num: 25, Den: 1}},
+		{frameRate: "50/2", expected: Rational{Num: 25, Den: 1}},
+		{frameRate: "12.5", expected: Rational{Num: 25, Den: 2}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFrameRate(tt.frameRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Errorf("frame rate %s: got %s, expected %s", tt.frameRate, got.String(), tt.expected.String())
+		}
+	}
+
+	for _, frameRate := range []string{"", "0/1", "30/0", "-25", "fps"} {
+		if _, err := ParseFrameRate(frameRate); err == nil {
+			t.Errorf("frame rate %q is invalid and it should have failed", frameRate)
+		}
+	}
+}
+
+func TestFrameAccurateSplit(t *testing.T) {
+	t.Run("cuts snap to frames without gaps", func(t *testing.T) {
+		tl := NewTimeline()
+		ntsc := Rational{Num: 30000, Den: 1001}
+		if err := tl.SetFrameRate("1", ntsc); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Insert("1", "Node", 0, 60, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		nodes, err := tl.Split(EVT_INTERVAL_CUT, 0, 10.01, 20.02)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 3 {
+			t.Fatalf("expected 3 nodes, got %d", len(nodes))
+		}
+		for i := 1; i < len(nodes); i++ {
+			if nodes[i].StartFrame != nodes[i-1].EndFrame {
+				t.Errorf("gap between node %d (end frame %d) and node %d (start frame %d)", i-1, nodes[i-1].EndFrame, i, nodes[i].StartFrame)
+			}
+		}
+		if nodes[1].StartFrame != 300 || nodes[1].EndFrame != 600 {
+			t.Errorf("got frames [%d, %d), expected [300, 600)", nodes[1].StartFrame, nodes[1].EndFrame)
+		}
+		if nodes[0].FrameRate != ntsc {
+			t.Errorf("got frame rate %s, expected %s", nodes[0].FrameRate.String(), ntsc.String())
+		}
+	})
+
+	t.Run("cut on the first frame is invalid", func(t *testing.T) {
+		tl := mockTl()
+		if _, err := tl.Split(EVT_INTERVAL_CUT, 0, 4.2, 5); err == nil {
+			t.Errorf("interval cut at the start of the clip should have failed")
+		}
+	})
+}
+
+func TestConformLegacyNodes(t *testing.T) {
+	legacy := []byte(`{"video_nodes":[{"start":1.5,"end":3.25,"rid":"1","id":"a","name":"Node","losslessexport":false}]}`)
+
+	var tl Timeline
+	if err := json.Unmarshal(legacy, &tl); err != nil {
+		t.Fatal(err)
+	}
+
+	rids := tl.LegacyRIDs()
+	if len(rids) != 1 || rids[0] != "1" {
+		t.Fatalf("expected legacy rid 1, got %v", rids)
+	}
+	if err := tl.SetFrameRate("1", Rational{Num: 24, Den: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tl.ConformLegacyNodes()
+
+	videoNode := tl.VideoNodes[0]
+	if videoNode.StartFrame != 36 || videoNode.EndFrame != 78 {
+		t.Errorf("got frames [%d, %d), expected [36, 78)", videoNode.StartFrame, videoNode.EndFrame)
+	}
+	if len(tl.LegacyRIDs()) != 0 {
+		t.Errorf("all the nodes should have been conformed")
+	}
+}
@@ -0,0 +1,206 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TRACK_VIDEO: a video track, its nodes are composited on top of the main track
+	TRACK_VIDEO = "video"
+	// TRACK_AUDIO: an audio track, its nodes are mixed with the audio of the timeline
+	TRACK_AUDIO = "audio"
+	// MAIN_TRACK_ID: the id of the main video track (Timeline.VideoNodes)
+	MAIN_TRACK_ID = "main"
+)
+
+type Track struct {
+	// ID: the ID of the track
+	ID string `json:"id"`
+	// Name: the name given by the user to the track
+	Name string `json:"name"`
+	// Type: the type of track (video, audio)
+	Type string `json:"type"`
+	// Nodes: the video nodes of the track, ordered by their timeline position
+	Nodes []VideoNode `json:"nodes"`
+}
+
+func createTrack(trackType string, name string) Track {
+	if name == "" {
+		name = "Track"
+	}
+	return Track{
+		ID:    strings.Replace(uuid.New().String(), "-", "", -1),
+		Name:  name,
+		Type:  trackType,
+		Nodes: []VideoNode{},
+	}
+}
+
+// Duration: the time in the timeline at which the last node of the track ends
+func (t *Track) Duration() float64 {
+	duration := 0.0
+	for _, videoNode := range t.Nodes {
+		if end := videoNode.Position + videoNode.Duration(); end > duration {
+			duration = end
+		}
+	}
+	return duration
+}
+
+// placement: finds the index at which a video node should be inserted, rejecting overlaps
+func (t *Track) placement(videoNode VideoNode) (int, error) {
+	end := videoNode.Position + videoNode.Duration()
+	idx := 0
+	for i, node := range t.Nodes {
+		nodeEnd := node.Position + node.Duration()
+		if videoNode.Position < nodeEnd-Epsilon && node.Position < end-Epsilon {
+			return 0, fmt.Errorf("clip overlaps with %s in track %s", node.Name, t.Name)
+		}
+		if node.Position < videoNode.Position {
+			idx = i + 1
+		}
+	}
+	return idx, nil
+}
+
+// AddTrack: appends a new track of the given type, tracks added later are placed on top
+func (tl *Timeline) AddTrack(trackType string, name string) (Track, error) {
+	tracks, err := tl.trackList(trackType)
+	if err != nil {
+		return Track{}, err
+	}
+
+	track := createTrack(trackType, name)
+	if err := tl.execute(OP_ADD_TRACK, Edit{TrackType: trackType, Pos: len(*tracks), InsertedTracks: []Track{track}}); err != nil {
+		return Track{}, err
+	}
+	return track, nil
+}
+
+// RemoveTrack: deletes a track and all of its nodes
+func (tl *Timeline) RemoveTrack(trackID string) error {
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	tracks, _ := tl.trackList(track.Type)
+	idx := slices.IndexFunc(*tracks, func(t Track) bool { return t.ID == trackID })
+	return tl.execute(OP_REMOVE_TRACK, Edit{TrackType: track.Type, Pos: idx, RemovedTracks: []Track{*track}})
+}
+
+// MoveTrack: changes the order of a track among the tracks of its type
+func (tl *Timeline) MoveTrack(trackID string, idx int) error {
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	tracks, _ := tl.trackList(track.Type)
+	if idx < 0 || idx >= len(*tracks) {
+		return fmt.Errorf("track position %d is invalid", idx)
+	}
+	from := slices.IndexFunc(*tracks, func(t Track) bool { return t.ID == trackID })
+	if from == idx {
+		return nil
+	}
+
+	return tl.execute(OP_MOVE_TRACK,
+		Edit{TrackType: track.Type, Pos: from, RemovedTracks: []Track{*track}},
+		Edit{TrackType: track.Type, Pos: idx, InsertedTracks: []Track{*track}})
+}
+
+// GetTrack: retrieves a video or audio track by its id
+func (tl *Timeline) GetTrack(trackID string) (*Track, error) {
+	for i := range tl.VideoTracks {
+		if tl.VideoTracks[i].ID == trackID {
+			return &tl.VideoTracks[i], nil
+		}
+	}
+	for i := range tl.AudioTracks {
+		if tl.AudioTracks[i].ID == trackID {
+			return &tl.AudioTracks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("track %s does not exists", trackID)
+}
+
+// InsertTrackNode: places a video node with some interval [a,b] at a position (seconds) of a track.
+// A node cannot overlap with the other nodes of the track
+func (tl *Timeline) InsertTrackNode(trackID string, rid string, name string, start, end, position float64) (VideoNode, error) {
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return VideoNode{}, err
+	}
+	if position < 0 {
+		return VideoNode{}, fmt.Errorf("track position %.4f is invalid", position)
+	}
+	videoNode := tl.newVideoNode(rid, name, start, end)
+	if videoNode.EndFrame <= videoNode.StartFrame {
+		return VideoNode{}, fmt.Errorf("invalid interval [%.4f, %.4f]", start, end)
+	}
+	videoNode.Position = position
+
+	idx, err := track.placement(videoNode)
+	if err != nil {
+		return VideoNode{}, err
+	}
+	if err := tl.execute(OP_INSERT, Edit{Track: trackID, Pos: idx, Inserted: []VideoNode{videoNode}}); err != nil {
+		return VideoNode{}, err
+	}
+	return videoNode, nil
+}
+
+// DeleteTrackNode: removes the video node at pos of a track
+func (tl *Timeline) DeleteTrackNode(trackID string, pos int) error {
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return err
+	}
+	if pos < 0 || pos >= len(track.Nodes) {
+		return fmt.Errorf("delete position is invalid")
+	}
+	return tl.execute(OP_DELETE, Edit{Track: trackID, Pos: pos, Removed: []VideoNode{track.Nodes[pos]}})
+}
+
+// SplitTrackNode: splits the video node at pos of a track, the resulting nodes keep their place in the track
+func (tl *Timeline) SplitTrackNode(trackID string, eventType string, pos int, start, end float64) ([]VideoNode, error) {
+	track, err := tl.GetTrack(trackID)
+	if err != nil {
+		return []VideoNode{}, err
+	}
+	if pos < 0 || pos >= len(track.Nodes) {
+		return []VideoNode{}, fmt.Errorf("split position is invalid")
+	}
+
+	splitNode := track.Nodes[pos]
+	nodes := splitVideoNode(splitNode, eventType, start, end)
+	if len(nodes) <= 0 {
+		return nodes, fmt.Errorf("invalid cut range")
+	}
+	for i := range nodes {
+		nodes[i].Position = splitNode.Position + (nodes[i].Start-splitNode.Start)/splitNode.SpeedFactor()
+	}
+
+	if err := tl.execute(OP_SPLIT, Edit{Track: trackID, Pos: pos, Removed: []VideoNode{splitNode}, Inserted: nodes}); err != nil {
+		return []VideoNode{}, err
+	}
+	return nodes, nil
+}
+
+// Duration: the duration of the timeline (the main track defines the length of the export),
+// clips overlap during their transitions
+func (tl *Timeline) Duration() float64 {
+	duration := 0.0
+	for i, videoNode := range tl.VideoNodes {
+		duration += videoNode.Duration()
+		if transition, ok := tl.TransitionAfter(i); ok {
+			duration -= transition.Duration
+		}
+	}
+	return duration
+}
@@ -0,0 +1,136 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TRANSITION_CROSSFADE: the first clip fades into the second clip
+	TRANSITION_CROSSFADE = "crossfade"
+	// TRANSITION_DIP_TO_BLACK: the first clip fades to black, then the second clip fades in
+	TRANSITION_DIP_TO_BLACK = "dip_to_black"
+	// TRANSITION_WIPE: the second clip is revealed from right to left
+	TRANSITION_WIPE = "wipe"
+	// TRANSITION_SLIDE: the second clip slides in from the right, pushing the first clip
+	TRANSITION_SLIDE = "slide"
+)
+
+func getValidTransitions() []string {
+	return []string{TRANSITION_CROSSFADE, TRANSITION_DIP_TO_BLACK, TRANSITION_WIPE, TRANSITION_SLIDE}
+}
+
+type Transition struct {
+	// ID: the ID of the transition
+	ID string `json:"id"`
+	// From: the ID of the outgoing video node
+	From string `json:"from"`
+	// To: the ID of the incoming video node (follows From in the main track)
+	To string `json:"to"`
+	// Type: the type of the transition (crossfade, dip_to_black, wipe, slide)
+	Type string `json:"type"`
+	// Duration: the duration of the transition in seconds, both clips overlap during the transition
+	Duration float64 `json:"duration"`
+}
+
+// IsValidTransition: checks if a given transition type is supported (crossfade, dip_to_black, wipe, slide)
+func IsValidTransition(transitionType string) bool {
+	return slices.Contains(getValidTransitions(), transitionType)
+}
+
+// SetTransition: sets the transition between the video node at pos and the next one of the main track,
+// it replaces the previous transition between these nodes, if any
+func (tl *Timeline) SetTransition(pos int, transitionType string, duration float64) (Transition, error) {
+	if pos < 0 || pos+1 >= len(tl.VideoNodes) {
+		return Transition{}, fmt.Errorf("there is no clip after position %d to transition to", pos)
+	}
+	if !IsValidTransition(transitionType) {
+		return Transition{}, fmt.Errorf("invalid transition type %s (crossfade, dip_to_black, wipe, slide)", transitionType)
+	}
+
+	transition := Transition{
+		ID:       strings.Replace(uuid.New().String(), "-", "", -1),
+		From:     tl.VideoNodes[pos].ID,
+		To:       tl.VideoNodes[pos+1].ID,
+		Type:     transitionType,
+		Duration: duration,
+	}
+
+	edits := []Edit{}
+	if idx := tl.transitionIndex(pos); idx >= 0 {
+		edits = append(edits, Edit{List: LIST_TRANSITIONS, Pos: idx, RemovedTransitions: []Transition{tl.Transitions[idx]}})
+	}
+	edits = append(edits, Edit{List: LIST_TRANSITIONS, Pos: len(tl.Transitions) - len(edits), InsertedTransitions: []Transition{transition}})
+
+	// validate the timeline as it would be after the edit
+	next := *tl
+	next.Transitions = slices.Clone(tl.Transitions)
+	if len(edits) > 1 {
+		next.Transitions = slices.Delete(next.Transitions, edits[0].Pos, edits[0].Pos+1)
+	}
+	next.Transitions = append(next.Transitions, transition)
+	if err := next.ValidateTransitions(); err != nil {
+		return Transition{}, err
+	}
+
+	if err := tl.execute(OP_SET_TRANSITION, edits...); err != nil {
+		return Transition{}, err
+	}
+	return transition, nil
+}
+
+// RemoveTransition: removes the transition between the video node at pos and the next one of the main track
+func (tl *Timeline) RemoveTransition(pos int) error {
+	idx := tl.transitionIndex(pos)
+	if idx < 0 {
+		return fmt.Errorf("there is no transition after clip %d", pos)
+	}
+	return tl.execute(OP_REMOVE_TRANSITION, Edit{List: LIST_TRANSITIONS, Pos: idx, RemovedTransitions: []Transition{tl.Transitions[idx]}})
+}
+
+// TransitionAfter: returns the transition between the video node at pos and the next one of the main track
+func (tl *Timeline) TransitionAfter(pos int) (Transition, bool) {
+	idx := tl.transitionIndex(pos)
+	if idx < 0 {
+		return Transition{}, false
+	}
+	return tl.Transitions[idx], true
+}
+
+// ValidateTransitions: checks that the transitions fit within their clips. A transition cannot be longer than
+// either of its clips, and the transitions at both ends of a clip cannot overlap
+func (tl *Timeline) ValidateTransitions() error {
+	incoming := 0.0
+	for i, videoNode := range tl.VideoNodes {
+		outgoing := 0.0
+		if transition, ok := tl.TransitionAfter(i); ok {
+			outgoing = transition.Duration
+			if transition.Duration <= 0 {
+				return fmt.Errorf("the %s transition after %s must have a positive duration", transition.Type, videoNode.Name)
+			}
+			if transition.Duration > videoNode.Duration()+Epsilon || transition.Duration > tl.VideoNodes[i+1].Duration()+Epsilon {
+				return fmt.Errorf("the %s transition (%.2fs) is longer than %s or %s", transition.Type, transition.Duration, videoNode.Name, tl.VideoNodes[i+1].Name)
+			}
+		}
+		if incoming+outgoing > videoNode.Duration()+Epsilon {
+			return fmt.Errorf("the transitions of %s overlap, %s is too short", videoNode.Name, videoNode.Name)
+		}
+		incoming = outgoing
+	}
+	return nil
+}
+
+// transitionIndex: returns the index of the transition between the video node at pos and the next one (-1 if none).
+// Transitions whose clips are no longer adjacent are ignored
+func (tl *Timeline) transitionIndex(pos int) int {
+	if pos < 0 || pos+1 >= len(tl.VideoNodes) {
+		return -1
+	}
+	from, to := tl.VideoNodes[pos].ID, tl.VideoNodes[pos+1].ID
+	return slices.IndexFunc(tl.Transitions, func(t Transition) bool {
+		return t.From == from && t.To == to
+	})
+}
@@ -0,0 +1,112 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	t.Run("transitions overlap the clips of the timeline", func(t *testing.T) {
+		tl := mockTl()
+		duration := tl.Duration()
+
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.SetTransition(1, TRANSITION_WIPE, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if got := tl.Duration(); math.Abs(got-(duration-1.5)) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration-1.5)
+		}
+
+		// setting a transition again replaces the previous one
+		if _, err := tl.SetTransition(0, TRANSITION_SLIDE, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		transition, ok := tl.TransitionAfter(0)
+		if !ok || transition.Type != TRANSITION_SLIDE || len(tl.Transitions) != 2 {
+			t.Errorf("expected the transition to be replaced, got %+v", tl.Transitions)
+		}
+	})
+
+	t.Run("invalid transitions are rejected", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.SetTransition(len(tl.VideoNodes)-1, TRANSITION_CROSSFADE, 1); err == nil {
+			t.Errorf("the last clip has no clip to transition to")
+		}
+		if _, err := tl.SetTransition(0, "spin", 1); err == nil {
+			t.Errorf("spin is not a valid transition type")
+		}
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 0); err == nil {
+			t.Errorf("a transition must have a positive duration")
+		}
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 3); err == nil {
+			t.Errorf("a transition cannot be longer than its clips")
+		}
+
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 1.5); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.SetTransition(1, TRANSITION_CROSSFADE, 1.5); err == nil {
+			t.Errorf("the transitions of the second clip overlap")
+		}
+		if len(tl.History.Undo) != 1 {
+			t.Errorf("rejected transitions should not be recorded, got %d commands", len(tl.History.Undo))
+		}
+	})
+
+	t.Run("undo and redo transitions", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.SetTransition(2, TRANSITION_DIP_TO_BLACK, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.SetTransition(2, TRANSITION_CROSSFADE, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.RemoveTransition(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.RemoveTransition(2); err == nil {
+			t.Errorf("there is no transition left to remove")
+		}
+
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if transition, ok := tl.TransitionAfter(2); !ok || transition.Type != TRANSITION_CROSSFADE {
+			t.Errorf("expected the crossfade to be restored, got %+v", tl.Transitions)
+		}
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if transition, ok := tl.TransitionAfter(2); !ok || transition.Type != TRANSITION_DIP_TO_BLACK {
+			t.Errorf("expected the dip to black to be restored, got %+v", tl.Transitions)
+		}
+		if _, err := tl.Redo(); err != nil {
+			t.Fatal(err)
+		}
+		if transition, ok := tl.TransitionAfter(2); !ok || transition.Type != TRANSITION_CROSSFADE || len(tl.Transitions) != 1 {
+			t.Errorf("expected the crossfade to be redone, got %+v", tl.Transitions)
+		}
+	})
+
+	t.Run("transitions of clips no longer adjacent are ignored", func(t *testing.T) {
+		tl := mockTl()
+
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.Delete(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tl.TransitionAfter(0); ok {
+			t.Errorf("the clips of the transition are no longer adjacent")
+		}
+		if err := tl.ValidateTransitions(); err != nil {
+			t.Error(err)
+		}
+	})
+}
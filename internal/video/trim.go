@@ -0,0 +1,183 @@
+package video
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// TRIM_IN: the in point (start) of a video node
+	TRIM_IN = "in"
+	// TRIM_OUT: the out point (end) of a video node
+	TRIM_OUT = "out"
+	// OP_RIPPLE_TRIM: moves the in or out point of a video node, the following nodes shift with it
+	OP_RIPPLE_TRIM = "ripple_trim"
+	// OP_ROLL_TRIM: moves the edit point between two video nodes
+	OP_ROLL_TRIM = "roll_trim"
+	// OP_SLIP_TRIM: moves the source window of a video node, keeping its length
+	OP_SLIP_TRIM = "slip_trim"
+	// OP_SLIDE_TRIM: moves a video node between its neighbours, keeping its source window
+	OP_SLIDE_TRIM = "slide_trim"
+)
+
+// SetSourceDuration: registers the duration in seconds of the source media of a root id
+func (tl *Timeline) SetSourceDuration(rid string, duration float64) error {
+	if duration <= 0 {
+		return fmt.Errorf("invalid duration %.4f for %s", duration, GetFilename(rid))
+	}
+	if tl.SourceDurations == nil {
+		tl.SourceDurations = map[string]float64{}
+	}
+	tl.SourceDurations[rid] = duration
+	return nil
+}
+
+// RippleTrim: moves the in or out point of the video node at pos by delta seconds of the timeline. The length of the
+// node changes, and the nodes that follow it in the main track shift accordingly
+func (tl *Timeline) RippleTrim(pos int, edge string, delta float64) (VideoNode, error) {
+	if pos < 0 || pos >= len(tl.VideoNodes) {
+		return VideoNode{}, fmt.Errorf("trim position %d is invalid", pos)
+	}
+
+	videoNode := tl.VideoNodes[pos]
+	frames := videoNode.sourceFrames(delta)
+	var trimmed VideoNode
+	var err error
+	switch edge {
+	case TRIM_IN:
+		trimmed, err = tl.trimmedNode(videoNode, videoNode.StartFrame+frames, videoNode.EndFrame)
+	case TRIM_OUT:
+		trimmed, err = tl.trimmedNode(videoNode, videoNode.StartFrame, videoNode.EndFrame+frames)
+	default:
+		return VideoNode{}, fmt.Errorf("invalid trim edge %s (in, out)", edge)
+	}
+	if err != nil {
+		return VideoNode{}, err
+	}
+
+	if err := tl.executeTrim(OP_RIPPLE_TRIM, pos, trimmed); err != nil {
+		return VideoNode{}, err
+	}
+	return trimmed, nil
+}
+
+// RollTrim: moves the edit point between the video node at pos and the next one by delta seconds of the timeline.
+// The out point of the first node and the in point of the second node move together, the timeline length is kept
+func (tl *Timeline) RollTrim(pos int, delta float64) ([]VideoNode, error) {
+	if pos < 0 || pos+1 >= len(tl.VideoNodes) {
+		return []VideoNode{}, fmt.Errorf("there is no edit point after position %d", pos)
+	}
+
+	outgoing, incoming := tl.VideoNodes[pos], tl.VideoNodes[pos+1]
+	frames := outgoing.sourceFrames(delta)
+	// both sides of the edit point must move by the same amount of time
+	if outgoing.FrameRate != incoming.FrameRate || outgoing.SpeedFactor() != incoming.SpeedFactor() {
+		delta = outgoing.timelineSeconds(frames)
+	}
+
+	trimmedOut, err := tl.trimmedNode(outgoing, outgoing.StartFrame, outgoing.EndFrame+frames)
+	if err != nil {
+		return []VideoNode{}, err
+	}
+	trimmedIn, err := tl.trimmedNode(incoming, incoming.StartFrame+incoming.sourceFrames(delta), incoming.EndFrame)
+	if err != nil {
+		return []VideoNode{}, err
+	}
+
+	if err := tl.executeTrim(OP_ROLL_TRIM, pos, trimmedOut, trimmedIn); err != nil {
+		return []VideoNode{}, err
+	}
+	return []VideoNode{trimmedOut, trimmedIn}, nil
+}
+
+// SlipTrim: moves the source window of the video node at pos by delta seconds of the timeline, its length and place
+// are kept
+func (tl *Timeline) SlipTrim(pos int, delta float64) (VideoNode, error) {
+	if pos < 0 || pos >= len(tl.VideoNodes) {
+		return VideoNode{}, fmt.Errorf("trim position %d is invalid", pos)
+	}
+
+	videoNode := tl.VideoNodes[pos]
+	frames := videoNode.sourceFrames(delta)
+	trimmed, err := tl.trimmedNode(videoNode, videoNode.StartFrame+frames, videoNode.EndFrame+frames)
+	if err != nil {
+		return VideoNode{}, err
+	}
+
+	if err := tl.executeTrim(OP_SLIP_TRIM, pos, trimmed); err != nil {
+		return VideoNode{}, err
+	}
+	return trimmed, nil
+}
+
+// SlideTrim: moves the video node at pos by delta seconds of the timeline between its neighbours, its source window is
+// kept. The previous node is extended (or shortened) at its out point and the next node at its in point
+func (tl *Timeline) SlideTrim(pos int, delta float64) ([]VideoNode, error) {
+	if pos <= 0 || pos+1 >= len(tl.VideoNodes) {
+		return []VideoNode{}, fmt.Errorf("the clip at position %d needs a clip on both sides to slide", pos)
+	}
+
+	prev, next := tl.VideoNodes[pos-1], tl.VideoNodes[pos+1]
+	frames := prev.sourceFrames(delta)
+	if prev.FrameRate != next.FrameRate || prev.SpeedFactor() != next.SpeedFactor() {
+		delta = prev.timelineSeconds(frames)
+	}
+
+	trimmedPrev, err := tl.trimmedNode(prev, prev.StartFrame, prev.EndFrame+frames)
+	if err != nil {
+		return []VideoNode{}, err
+	}
+	trimmedNext, err := tl.trimmedNode(next, next.StartFrame+next.sourceFrames(delta), next.EndFrame)
+	if err != nil {
+		return []VideoNode{}, err
+	}
+
+	if err := tl.executeTrim(OP_SLIDE_TRIM, pos-1, trimmedPrev, tl.VideoNodes[pos], trimmedNext); err != nil {
+		return []VideoNode{}, err
+	}
+	return []VideoNode{trimmedPrev, tl.VideoNodes[pos], trimmedNext}, nil
+}
+
+// sourceFrames: the frames of the source media of the video node played during delta seconds of the timeline at its speed
+func (v VideoNode) sourceFrames(delta float64) int64 {
+	return v.FrameRate.Frames(delta * v.SpeedFactor())
+}
+
+// timelineSeconds: the seconds of the timeline during which frames of the source media of the video node are played
+func (v VideoNode) timelineSeconds(frames int64) float64 {
+	return v.FrameRate.Seconds(frames) / v.SpeedFactor()
+}
+
+// trimmedNode: returns the video node with a new frame interval, checking that it is within its source media.
+// The upper bound is only checked when the duration of the source media is known
+func (tl *Timeline) trimmedNode(videoNode VideoNode, startFrame, endFrame int64) (VideoNode, error) {
+	rate := videoNode.FrameRate
+	if startFrame < 0 {
+		return VideoNode{}, fmt.Errorf("%s cannot start before the beginning of its source", videoNode.Name)
+	}
+	if endFrame <= startFrame {
+		return VideoNode{}, fmt.Errorf("%s must be at least one frame long", videoNode.Name)
+	}
+	if duration, ok := tl.SourceDurations[videoNode.RID]; ok && endFrame > rate.Frames(duration) {
+		return VideoNode{}, fmt.Errorf("%s cannot end after the end of its source (%s)", videoNode.Name, FormatTime(duration))
+	}
+
+	videoNode.StartFrame = startFrame
+	videoNode.EndFrame = endFrame
+	videoNode.Start = rate.Seconds(startFrame)
+	videoNode.End = rate.Seconds(endFrame)
+	return videoNode, nil
+}
+
+// executeTrim: replaces the video nodes of the main track starting at pos with their trimmed version,
+// the trim is rejected if the transitions no longer fit in their clips
+func (tl *Timeline) executeTrim(op string, pos int, trimmed ...VideoNode) error {
+	next := *tl
+	next.VideoNodes = slices.Replace(slices.Clone(tl.VideoNodes), pos, pos+len(trimmed), trimmed...)
+	if err := next.ValidateTransitions(); err != nil {
+		return err
+	}
+
+	removed := slices.Clone(tl.VideoNodes[pos : pos+len(trimmed)])
+	return tl.execute(op, Edit{Track: MAIN_TRACK_ID, Pos: pos, Removed: removed, Inserted: trimmed})
+}
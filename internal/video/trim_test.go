@@ -0,0 +1,178 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+func mockTrimTl(t *testing.T) *Timeline {
+	t.Helper()
+	tl := mockTl()
+	for _, rid := range []string{"1", "2", "3"} {
+		if err := tl.SetSourceDuration(rid, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tl
+}
+
+func sameInterval(t *testing.T, got VideoNode, start, end float64) {
+	t.Helper()
+	if math.Abs(got.Start-start) > Epsilon || math.Abs(got.End-end) > Epsilon {
+		t.Errorf("got interval [%.4f, %.4f], expected [%.4f, %.4f]", got.Start, got.End, start, end)
+	}
+}
+
+func TestTrims(t *testing.T) {
+	t.Run("ripple trim changes the length of the timeline", func(t *testing.T) {
+		tl := mockTrimTl(t)
+		duration := tl.Duration()
+
+		if _, err := tl.RippleTrim(1, TRIM_IN, -1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.RippleTrim(1, TRIM_OUT, 2); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[1], 3.2, 8.9)
+		if got := tl.Duration(); math.Abs(got-(duration+3)) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration+3)
+		}
+
+		if _, err := tl.RippleTrim(1, TRIM_IN, -4); err == nil {
+			t.Errorf("a clip cannot start before its source")
+		}
+		if _, err := tl.RippleTrim(1, TRIM_OUT, 2); err == nil {
+			t.Errorf("a clip cannot end after its source")
+		}
+		if _, err := tl.RippleTrim(1, TRIM_IN, 6); err == nil {
+			t.Errorf("a clip cannot be trimmed to nothing")
+		}
+		if _, err := tl.RippleTrim(1, "middle", 1); err == nil {
+			t.Errorf("middle is not a valid trim edge")
+		}
+	})
+
+	t.Run("roll trim keeps the length of the timeline", func(t *testing.T) {
+		tl := mockTrimTl(t)
+		duration := tl.Duration()
+
+		if _, err := tl.RollTrim(0, 1.5); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[0], 4.2, 8.4)
+		sameInterval(t, tl.VideoNodes[1], 5.7, 6.9)
+		if got := tl.Duration(); math.Abs(got-duration) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration)
+		}
+
+		if _, err := tl.RollTrim(0, 1.5); err == nil {
+			t.Errorf("the incoming clip cannot be trimmed to nothing")
+		}
+		if _, err := tl.RollTrim(len(tl.VideoNodes)-1, 1); err == nil {
+			t.Errorf("there is no edit point after the last clip")
+		}
+	})
+
+	t.Run("slip trim keeps the length of the clip", func(t *testing.T) {
+		tl := mockTrimTl(t)
+
+		if _, err := tl.SlipTrim(2, 3.1); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[2], 7.3, 10)
+		if _, err := tl.SlipTrim(2, 0.1); err == nil {
+			t.Errorf("a clip cannot be slipped past the end of its source")
+		}
+		if _, err := tl.SlipTrim(2, -7.4); err == nil {
+			t.Errorf("a clip cannot be slipped before the beginning of its source")
+		}
+	})
+
+	t.Run("slide trim moves the clip between its neighbours", func(t *testing.T) {
+		tl := mockTrimTl(t)
+		duration := tl.Duration()
+		slid := tl.VideoNodes[2]
+
+		if _, err := tl.SlideTrim(2, -1); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[1], 4.2, 5.9)
+		sameInterval(t, tl.VideoNodes[2], slid.Start, slid.End)
+		sameInterval(t, tl.VideoNodes[3], 3.2, 6.9)
+		if got := tl.Duration(); math.Abs(got-duration) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration)
+		}
+
+		if _, err := tl.SlideTrim(0, 1); err == nil {
+			t.Errorf("the first clip has no clip before it to slide into")
+		}
+	})
+
+	t.Run("trims move the source of clips by the timeline delta at their speed", func(t *testing.T) {
+		tl := mockTrimTl(t)
+		if _, err := tl.SetSpeed(MAIN_TRACK_ID, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		duration := tl.Duration()
+
+		// a second of the timeline plays two seconds of the source of the clip at 2x
+		if _, err := tl.RippleTrim(1, TRIM_OUT, 1); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[1], 4.2, 8.9)
+		if got := tl.Duration(); math.Abs(got-(duration+1)) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration+1)
+		}
+
+		if _, err := tl.SlipTrim(1, -1); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[1], 2.2, 6.9)
+
+		// both sides of the edit point move by the same time in the timeline
+		duration = tl.Duration()
+		if _, err := tl.RollTrim(0, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[0], 4.2, 7.4)
+		sameInterval(t, tl.VideoNodes[1], 3.2, 6.9)
+		if got := tl.Duration(); math.Abs(got-duration) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration)
+		}
+
+		if _, err := tl.SlideTrim(2, -0.5); err != nil {
+			t.Fatal(err)
+		}
+		sameInterval(t, tl.VideoNodes[1], 3.2, 5.9)
+		sameInterval(t, tl.VideoNodes[3], 3.7, 6.9)
+		if got := tl.Duration(); math.Abs(got-duration) > Epsilon {
+			t.Errorf("got duration %.4f, expected %.4f", got, duration)
+		}
+	})
+
+	t.Run("trims can be undone and keep transitions in their clips", func(t *testing.T) {
+		tl := mockTrimTl(t)
+		initial := append([]VideoNode{}, tl.VideoNodes...)
+
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.RollTrim(0, 1); err == nil {
+			t.Errorf("the transition no longer fits in the incoming clip")
+		}
+		if _, err := tl.SlipTrim(0, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tl.TransitionAfter(0); !ok {
+			t.Errorf("the transition should follow the trimmed clip")
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := tl.Undo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sameNodes(t, tl.VideoNodes, initial)
+	})
+}
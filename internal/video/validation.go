@@ -0,0 +1,85 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// VALIDATION_REQUIRED: the field was not provided
+	VALIDATION_REQUIRED = "required"
+	// VALIDATION_INVALID: the value of the field is malformed or out of range
+	VALIDATION_INVALID = "invalid"
+	// VALIDATION_INCOMPATIBLE: the value of the field cannot be used with the value of another field
+	VALIDATION_INCOMPATIBLE = "incompatible"
+	// VALIDATION_UNSUPPORTED: the value of the field is not supported by the operation
+	VALIDATION_UNSUPPORTED = "unsupported"
+	// VALIDATION_DUPLICATE: the value of the field must be unique and is already taken
+	VALIDATION_DUPLICATE = "duplicate"
+)
+
+// FieldViolation: a problem with a single field, the field is named as in the json of the options (video_bitrate)
+type FieldViolation struct {
+	// Field: the json name of the field
+	Field string `json:"field"`
+	// Code: the kind of the violation (required, invalid, incompatible, unsupported, duplicate)
+	Code string `json:"code"`
+	// Message: describes the violation to the user
+	Message string `json:"message"`
+}
+
+/*
+ValidationError: every violation found while validating a set of options, so all of them can be reported at once.
+Callers get the violations with errors.As
+Ex: var verr *ValidationError; if errors.As(err, &verr) { highlight(verr.Violations) }
+*/
+type ValidationError struct {
+	// Violations: the violations in the order they were found
+	Violations []FieldViolation `json:"violations"`
+}
+
+// Error: joins the messages of the violations
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add: records a violation of a field, the message is formatted as in fmt.Sprintf
+func (e *ValidationError) Add(field string, code string, format string, args ...any) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Merge: records the violations of another validation error (even wrapped), other errors are recorded on the given field
+func (e *ValidationError) Merge(field string, err error) {
+	if err == nil {
+		return
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		e.Violations = append(e.Violations, verr.Violations...)
+		return
+	}
+	e.Add(field, VALIDATION_INVALID, "%s", err.Error())
+}
+
+// HasField: checks if a field has a violation
+func (e *ValidationError) HasField(field string) bool {
+	for _, violation := range e.Violations {
+		if violation.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err: returns the validation error, or nil if no violation was recorded
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,76 @@
+package video
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	t.Run("every violation is reported", func(t *testing.T) {
+		opts := ProcessingOpts{Filename: "export.mp4", VideoFormat: ".webm", Codec: CODEC_H264, AudioBitrate: "loud", RateControl: RATE_CONTROL_BITRATE}
+		err := opts.ValidateRequiredFields(QUERY_FILTERGRAPH)
+
+		var verr *ValidationError
+		if !errors.As(fmt.Errorf("export failed: %w", err), &verr) {
+			t.Fatalf("expected a *ValidationError, got %v", err)
+		}
+		expected := []FieldViolation{
+			{Field: "filename", Code: VALIDATION_INVALID},
+			{Field: "output_path", Code: VALIDATION_REQUIRED},
+			{Field: "codec", Code: VALIDATION_INCOMPATIBLE},
+			{Field: "audio_bitrate", Code: VALIDATION_INVALID},
+			{Field: "video_bitrate", Code: VALIDATION_INVALID},
+		}
+		if len(verr.Violations) != len(expected) {
+			t.Fatalf("expected %d violations, got %+v", len(expected), verr.Violations)
+		}
+		for i, violation := range verr.Violations {
+			if violation.Field != expected[i].Field || violation.Code != expected[i].Code || violation.Message == "" {
+				t.Errorf("expected violation %s (%s), got %+v", expected[i].Field, expected[i].Code, violation)
+			}
+		}
+	})
+
+	t.Run("no violations", func(t *testing.T) {
+		opts := ProcessingOpts{Filename: "export", OutputPath: ".", VideoFormat: ".mp4", Codec: CODEC_H264, CRF: CRF_23}
+		if err := opts.ValidateRequiredFields(QUERY_FILTERGRAPH); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("json of the violations", func(t *testing.T) {
+		verr := &ValidationError{}
+		verr.Add("maxrate", VALIDATION_REQUIRED, "maxrate and bufsize must be set together")
+		data, err := json.Marshal(verr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"violations":[{"field":"maxrate","code":"required","message":"maxrate and bufsize must be set together"}]}`
+		if string(data) != expected {
+			t.Errorf("expected %s, got %s", expected, string(data))
+		}
+	})
+
+	t.Run("merged violations", func(t *testing.T) {
+		inner := &ValidationError{}
+		inner.Add("crf", VALIDATION_INVALID, "crf must be between 0 and 51")
+
+		verr := &ValidationError{}
+		verr.Merge("preset", fmt.Errorf("could not load the preset: %w", inner))
+		verr.Merge("preset", errors.New("unknown preset"))
+		if len(verr.Violations) != 2 || !verr.HasField("crf") || verr.Violations[1].Field != "preset" {
+			t.Errorf("expected the wrapped violations to be kept, got %+v", verr.Violations)
+		}
+	})
+
+	t.Run("duplicated preset name", func(t *testing.T) {
+		registry := NewPresetRegistry()
+		_, err := registry.Create(mockPreset("Web 1080p (H.264)"))
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !verr.HasField("name") || verr.Violations[0].Code != VALIDATION_DUPLICATE {
+			t.Errorf("expected a duplicate name violation, got %v", err)
+		}
+	})
+}
@@ -2,8 +2,10 @@ package video
 
 import (
 	"fmt"
+	"maps"
 	"os/exec"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,12 +27,32 @@ func getCompatibleRest() []string {
 	return []string{CODEC_H264, CODEC_H264_RGB, CODEC_H265, CODEC_COPY}
 }
 
+func getChapterFormats() []string {
+	return []string{".mp4", ".mkv"}
+}
+
+func getCompatibleAudioOGV() []string {
+	return []string{AUDIO_CODEC_VORBIS}
+}
+
+func getCompatibleAudioWebm() []string {
+	return []string{AUDIO_CODEC_OPUS, AUDIO_CODEC_VORBIS}
+}
+
+func getCompatibleAudioRest() []string {
+	return []string{AUDIO_CODEC_AAC, AUDIO_CODEC_MP3}
+}
+
 const (
 	// high order query types
 	QUERY_FILTERGRAPH       = "q_filtergraph"
 	QUERY_LOSSLESS_CUT      = "q_lossless_cut"
+	QUERY_LOSSLESS_MERGE    = "q_lossless_merge"
+	QUERY_SMART_RENDER      = "q_smart_render"
 	QUERY_CREATE_PROXY_FILE = "q_create_proxy_file"
 	QUERY_CREATE_THUMBNAIL  = "q_create_thumbnail"
+	// QUERY_PREVIEW: the render of the preview of the timeline, it runs as a job outside of FFmpegQuery
+	QUERY_PREVIEW = "q_preview"
 	// Epsilon: margin for floating point checks
 	Epsilon          = 1e-6
 	EVT_CHANGE_ROUTE = "evt_change_route"
@@ -38,6 +60,12 @@ const (
 	EVT_FFMPEG_RESULT = "evt_ffmpeg_result"
 	// EVT_FFMPEG_EXEC_ENDED: signals that the ffmpeg query has ended (does not indicate success of the query)
 	EVT_FFMPEG_EXEC_ENDED = "evt_ffmpeg_exec_ended"
+	// EVT_BATCH_SUMMARY: a batch export has ended, carries the BatchSummary of its results
+	EVT_BATCH_SUMMARY = "evt_batch_summary"
+	// EVT_JOB_STARTED: a FFmpeg query started running as a job, carries the Job (its id is given to CancelJob)
+	EVT_JOB_STARTED = "evt_job_started"
+	// EVT_VALIDATION_FAILED: the options of a FFmpeg query are invalid, carries the list of FieldViolation
+	EVT_VALIDATION_FAILED = "evt_validation_failed"
 	// EVT_ENABLE_VIM_MODE
 	EVT_TOGGLE_VIM_MODE = "evt_toggle_vim_mode"
 	// EVT_CHANGE_VIM_MODE: sets the vim mode in timeline (select, remove, timeline)
@@ -70,6 +98,8 @@ const (
 	EVT_YANK_CLIP = "evt_yank_clip"
 	// EVT_OPEN_RENAME_CLIP_MODAL: opens the rename clip modal
 	EVT_OPEN_RENAME_CLIP_MODAL = "evt_open_rename_clip_modal"
+	// EVT_TIMELINE_CHANGED: the timeline was changed by the backend (undo, redo), carries the new timeline
+	EVT_TIMELINE_CHANGED = "evt_timeline_changed"
 	// EVT_INTERVAL_CUT: interval cut event
 	EVT_INTERVAL_CUT = "intervalCut"
 	// EVT_SLICE_CUT: slice cut event
@@ -112,6 +142,20 @@ const (
 	CODEC_THEORA = "libtheora"
 	// CODEC_COPY: codec copy for bitstream copy (skips re-encoding the video)
 	CODEC_COPY = "copy"
+	// AUDIO_CODEC_AAC: audio codec AAC
+	AUDIO_CODEC_AAC = "aac"
+	// AUDIO_CODEC_MP3: audio codec MP3
+	AUDIO_CODEC_MP3 = "libmp3lame"
+	// AUDIO_CODEC_OPUS: audio codec Opus (.webm)
+	AUDIO_CODEC_OPUS = "libopus"
+	// AUDIO_CODEC_VORBIS: audio codec Vorbis (.webm, .ogv)
+	AUDIO_CODEC_VORBIS = "libvorbis"
+	// AUDIO_BITRATE_128K: audio bitrate of 128 kbit/s
+	AUDIO_BITRATE_128K = "128k"
+	// AUDIO_BITRATE_192K: audio bitrate of 192 kbit/s
+	AUDIO_BITRATE_192K = "192k"
+	// AUDIO_BITRATE_320K: audio bitrate of 320 kbit/s
+	AUDIO_BITRATE_320K = "320k"
 	// CRF_23: constant rate factor 23, lower number usually means better quality
 	CRF_23 = "23"
 	// CRF_22: constant rate factor 22, lower number usually means better quality
@@ -139,10 +183,16 @@ const (
 )
 
 type VideoNode struct {
-	// Start: the start of the interval
+	// Start: the start of the interval in seconds (derived from StartFrame)
 	Start float64 `json:"start"`
-	// End: the end of the interval
+	// End: the end of the interval in seconds (derived from EndFrame)
 	End float64 `json:"end"`
+	// StartFrame: the first frame of the interval
+	StartFrame int64 `json:"start_frame"`
+	// EndFrame: the frame after the last frame of the interval (exclusive)
+	EndFrame int64 `json:"end_frame"`
+	// FrameRate: the frame rate of the source media
+	FrameRate Rational `json:"frame_rate"`
 	// RID: the root ID of the node, that is, the original video from which this nodes derives
 	RID string `json:"rid"`
 	// ID: the ID of the video node
@@ -151,11 +201,29 @@ type VideoNode struct {
 	Name string `json:"name"`
 	// Lossless
 	LosslessExport bool `json:"losslessexport"`
+	// Position: the start of the node in the timeline (seconds), only used by video and audio tracks
+	Position float64 `json:"position"`
+	// Speed: the playback speed factor of the node (0.5 slow motion, 2 time-lapse), normal speed if unset
+	Speed float64 `json:"speed,omitempty"`
 }
 
 type Timeline struct {
-	// VideoNodes: all the video nodes of the timeline
+	// VideoNodes: the video nodes of the main track, played one after the other
 	VideoNodes []VideoNode `json:"video_nodes"`
+	// VideoTracks: the video tracks composited on top of the main track (last track is on top)
+	VideoTracks []Track `json:"video_tracks"`
+	// AudioTracks: the audio tracks mixed into the timeline
+	AudioTracks []Track `json:"audio_tracks"`
+	// History: the operations performed on the timeline that can be undone/redone
+	History History `json:"history"`
+	// FrameRates: the frame rate of the source media of the timeline, by root id
+	FrameRates map[string]Rational `json:"frame_rates"`
+	// Transitions: the transitions between adjacent video nodes of the main track
+	Transitions []Transition `json:"transitions"`
+	// Markers: the notes placed on the timeline, ordered by their position
+	Markers []Marker `json:"markers"`
+	// SourceDurations: the duration in seconds of the source media of the timeline, by root id
+	SourceDurations map[string]float64 `json:"source_durations"`
 }
 
 type ThumbnailOpts struct {
@@ -174,6 +242,10 @@ type ProcessingOpts struct {
 	CRF string `json:"crf"`
 	// Preset: Encoding speed to compression ratio
 	Preset string `json:"preset"`
+	// AudioCodec: audio codec (aac, libopus), the default codec of the video format is used if empty
+	AudioCodec string `json:"audio_codec,omitempty"`
+	// AudioBitrate: the bitrate of the audio (128k, 192k, 320k), the encoder default is used if empty
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
 	// InputPath: The file path of the input video
 	InputPath string `json:"input_path,omitempty"`
 	// OutputPath: The file path of the output video
@@ -182,22 +254,170 @@ type ProcessingOpts struct {
 	Filename string `json:"filename"`
 	// VideoFormat: the video format (.mov, .mp4)
 	VideoFormat string `json:"video_format"`
+	// Chapters: exports the markers of the timeline as chapters (.mp4, .mkv)
+	Chapters bool `json:"chapters,omitempty"`
+	// RateControl: how the video bitrate is chosen (crf, bitrate, target_size), crf if empty
+	RateControl string `json:"rate_control,omitempty"`
+	// VideoBitrate: the target video bitrate of the bitrate rate control (2500k, 8M)
+	VideoBitrate string `json:"video_bitrate,omitempty"`
+	// MaxRate: the maximum video bitrate (-maxrate), set together with BufSize
+	MaxRate string `json:"maxrate,omitempty"`
+	// BufSize: the size of the rate control buffer (-bufsize), set together with MaxRate
+	BufSize string `json:"bufsize,omitempty"`
+	// TargetSize: the size of the output in MB of the target_size rate control
+	TargetSize float64 `json:"target_size,omitempty"`
+	// TwoPass: encodes the video in two passes, the first one analyzes it to distribute the bitrate
+	TwoPass bool `json:"two_pass,omitempty"`
 }
 
 func NewTimeline() Timeline {
-	return Timeline{VideoNodes: []VideoNode{}}
+	return Timeline{VideoNodes: []VideoNode{}, VideoTracks: []Track{}, AudioTracks: []Track{}, FrameRates: map[string]Rational{}, Transitions: []Transition{}, Markers: []Marker{}, SourceDurations: map[string]float64{}}
+}
+
+// Clone: returns a deep copy of the timeline, the edits of the timeline do not change the copy
+func (tl Timeline) Clone() Timeline {
+	clone := tl
+	clone.VideoNodes = slices.Clone(tl.VideoNodes)
+	clone.VideoTracks = cloneTracks(tl.VideoTracks)
+	clone.AudioTracks = cloneTracks(tl.AudioTracks)
+	clone.History = History{Undo: slices.Clone(tl.History.Undo), Redo: slices.Clone(tl.History.Redo)}
+	clone.FrameRates = maps.Clone(tl.FrameRates)
+	clone.Transitions = slices.Clone(tl.Transitions)
+	clone.Markers = slices.Clone(tl.Markers)
+	clone.SourceDurations = maps.Clone(tl.SourceDurations)
+	return clone
+}
+
+// cloneTracks: returns a copy of the tracks and their nodes
+func cloneTracks(tracks []Track) []Track {
+	if tracks == nil {
+		return nil
+	}
+	clones := make([]Track, len(tracks))
+	for i, track := range tracks {
+		track.Nodes = slices.Clone(track.Nodes)
+		clones[i] = track
+	}
+	return clones
 }
 
 func createVideoNode(rid string, name string, start, end float64) VideoNode {
+	rate := DefaultFrameRate()
+	return createFrameNode(rid, name, rate.Frames(start), rate.Frames(end), rate)
+}
+
+func createFrameNode(rid string, name string, startFrame, endFrame int64, rate Rational) VideoNode {
 	if name == "" {
 		name = "Node"
 	}
 	return VideoNode{
-		RID:   rid,
-		ID:    strings.Replace(uuid.New().String(), "-", "", -1),
-		Name:  name,
-		Start: start,
-		End:   end,
+		RID:        rid,
+		ID:         strings.Replace(uuid.New().String(), "-", "", -1),
+		Name:       name,
+		Start:      rate.Seconds(startFrame),
+		End:        rate.Seconds(endFrame),
+		StartFrame: startFrame,
+		EndFrame:   endFrame,
+		FrameRate:  rate,
+	}
+}
+
+// newVideoNode: creates a video node with some interval [a,b] snapped to the frames of its source media
+func (tl *Timeline) newVideoNode(rid string, name string, start, end float64) VideoNode {
+	rate := tl.FrameRate(rid)
+	return createFrameNode(rid, name, rate.Frames(start), rate.Frames(end), rate)
+}
+
+// Duration: the duration of the video node in the timeline in seconds, that is, its interval played at its speed
+func (v VideoNode) Duration() float64 {
+	return v.SourceDuration() / v.SpeedFactor()
+}
+
+// SourceDuration: the duration of the interval of the video node in its source media in seconds
+func (v VideoNode) SourceDuration() float64 {
+	if v.isLegacy() {
+		return v.End - v.Start
+	}
+	return v.FrameRate.Seconds(v.EndFrame - v.StartFrame)
+}
+
+// SpeedFactor: the playback speed factor of the video node (1 if unset)
+func (v VideoNode) SpeedFactor() float64 {
+	if v.Speed == 0 {
+		return 1
+	}
+	return v.Speed
+}
+
+// isLegacy: checks if the video node was stored in seconds only (before frame accurate intervals)
+func (v VideoNode) isLegacy() bool {
+	return !v.FrameRate.IsValid()
+}
+
+// conform: converts the interval in seconds of a legacy video node to frames of the given rate
+func (v VideoNode) conform(rate Rational) VideoNode {
+	v.FrameRate = rate
+	v.StartFrame = rate.Frames(v.Start)
+	v.EndFrame = rate.Frames(v.End)
+	v.Start = rate.Seconds(v.StartFrame)
+	v.End = rate.Seconds(v.EndFrame)
+	return v
+}
+
+// SetFrameRate: registers the frame rate of the source media of a root id
+func (tl *Timeline) SetFrameRate(rid string, rate Rational) error {
+	if !rate.IsValid() {
+		return fmt.Errorf("invalid frame rate %s for %s", rate.String(), GetFilename(rid))
+	}
+	if tl.FrameRates == nil {
+		tl.FrameRates = map[string]Rational{}
+	}
+	tl.FrameRates[rid] = rate
+	return nil
+}
+
+// FrameRate: returns the frame rate of the source media of a root id (default frame rate if unknown)
+func (tl *Timeline) FrameRate(rid string) Rational {
+	if rate, ok := tl.FrameRates[rid]; ok && rate.IsValid() {
+		return rate
+	}
+	return DefaultFrameRate()
+}
+
+// LegacyRIDs: returns the root ids of the video nodes stored in seconds only
+func (tl *Timeline) LegacyRIDs() []string {
+	rids := []string{}
+	tl.forEachNode(func(videoNode *VideoNode) {
+		if videoNode.isLegacy() && !slices.Contains(rids, videoNode.RID) {
+			rids = append(rids, videoNode.RID)
+		}
+	})
+	return rids
+}
+
+// ConformLegacyNodes: converts the video nodes stored in seconds only to frames of their source media
+func (tl *Timeline) ConformLegacyNodes() {
+	tl.forEachNode(func(videoNode *VideoNode) {
+		if videoNode.isLegacy() {
+			*videoNode = videoNode.conform(tl.FrameRate(videoNode.RID))
+		}
+	})
+}
+
+// forEachNode: calls fn with every video node of the timeline (main, video, and audio tracks)
+func (tl *Timeline) forEachNode(fn func(videoNode *VideoNode)) {
+	for i := range tl.VideoNodes {
+		fn(&tl.VideoNodes[i])
+	}
+	for t := range tl.VideoTracks {
+		for i := range tl.VideoTracks[t].Nodes {
+			fn(&tl.VideoTracks[t].Nodes[i])
+		}
+	}
+	for t := range tl.AudioTracks {
+		for i := range tl.AudioTracks[t].Nodes {
+			fn(&tl.AudioTracks[t].Nodes[i])
+		}
 	}
 }
 
@@ -207,8 +427,10 @@ func (tl *Timeline) Insert(rid string, name string, start, end float64, pos int)
 		return videoNode, fmt.Errorf("insertion position %d is invalid", pos)
 	}
 
-	videoNode = createVideoNode(rid, name, start, end)
-	tl.VideoNodes = slices.Insert(tl.VideoNodes, pos, videoNode)
+	videoNode = tl.newVideoNode(rid, name, start, end)
+	if err := tl.execute(OP_INSERT, Edit{Track: MAIN_TRACK_ID, Pos: pos, Inserted: []VideoNode{videoNode}}); err != nil {
+		return VideoNode{}, err
+	}
 
 	return videoNode, nil
 }
@@ -220,8 +442,7 @@ func (tl *Timeline) Delete(pos int) error {
 	if len(tl.VideoNodes) == 0 {
 		return fmt.Errorf("there are no video clips to delete in track")
 	}
-	tl.VideoNodes = slices.Delete(tl.VideoNodes, pos, pos+1)
-	return nil
+	return tl.execute(OP_DELETE, Edit{Track: MAIN_TRACK_ID, Pos: pos, Removed: []VideoNode{tl.VideoNodes[pos]}})
 }
 
 func (tl *Timeline) RenameVideoNode(pos int, name string) error {
@@ -231,8 +452,9 @@ func (tl *Timeline) RenameVideoNode(pos int, name string) error {
 	if len(tl.VideoNodes) == 0 {
 		return fmt.Errorf("there are no video clips to rename in track")
 	}
-	tl.VideoNodes[pos].Name = name
-	return nil
+	renamed := tl.VideoNodes[pos]
+	renamed.Name = name
+	return tl.execute(OP_RENAME, Edit{Track: MAIN_TRACK_ID, Pos: pos, Removed: []VideoNode{tl.VideoNodes[pos]}, Inserted: []VideoNode{renamed}})
 }
 
 func (tl *Timeline) ToggleLossless(pos int) error {
@@ -242,32 +464,32 @@ func (tl *Timeline) ToggleLossless(pos int) error {
 	if len(tl.VideoNodes) == 0 {
 		return fmt.Errorf("there are no video clips to mark")
 	}
-	tl.VideoNodes[pos].LosslessExport = !tl.VideoNodes[pos].LosslessExport
-	return nil
+	toggled := tl.VideoNodes[pos]
+	toggled.LosslessExport = !toggled.LosslessExport
+	return tl.execute(OP_TOGGLE_LOSSLESS, Edit{Track: MAIN_TRACK_ID, Pos: pos, Removed: []VideoNode{tl.VideoNodes[pos]}, Inserted: []VideoNode{toggled}})
 }
 
 func (tl *Timeline) MarkAllLossless() error {
 	if len(tl.VideoNodes) == 0 {
 		return fmt.Errorf("there are no video clips to mark")
 	}
-
-	for i := range tl.VideoNodes {
-		tl.VideoNodes[i].LosslessExport = true
-	}
-
-	return nil
+	return tl.execute(OP_MARK_ALL_LOSSLESS, tl.setAllLossless(true))
 }
 
 func (tl *Timeline) UnmarkAllLossless() error {
 	if len(tl.VideoNodes) == 0 {
 		return fmt.Errorf("there are no video clips to mark")
 	}
+	return tl.execute(OP_UNMARK_ALL_LOSSLESS, tl.setAllLossless(false))
+}
 
-	for i := range tl.VideoNodes {
-		tl.VideoNodes[i].LosslessExport = false
+// setAllLossless: returns the edit that sets the lossless export mark of all the video nodes of the main track
+func (tl *Timeline) setAllLossless(lossless bool) Edit {
+	marked := slices.Clone(tl.VideoNodes)
+	for i := range marked {
+		marked[i].LosslessExport = lossless
 	}
-
-	return nil
+	return Edit{Track: MAIN_TRACK_ID, Pos: 0, Removed: slices.Clone(tl.VideoNodes), Inserted: marked}
 }
 
 func (tl *Timeline) Split(eventType string, pos int, start, end float64) ([]VideoNode, error) {
@@ -279,35 +501,72 @@ func (tl *Timeline) Split(eventType string, pos int, start, end float64) ([]Vide
 		return nodes, fmt.Errorf("there are no video clips to split in track")
 	}
 
-	splitNode := tl.VideoNodes[pos]
+	nodes = splitVideoNode(tl.VideoNodes[pos], eventType, start, end)
+	if len(nodes) <= 0 {
+		return nodes, fmt.Errorf("invalid cut range")
+	}
+	if err := tl.execute(OP_SPLIT, Edit{Track: MAIN_TRACK_ID, Pos: pos, Removed: []VideoNode{tl.VideoNodes[pos]}, Inserted: nodes}); err != nil {
+		return []VideoNode{}, err
+	}
+	return nodes, nil
+}
+
+// splitVideoNode: returns the nodes resulting from cutting a video node (empty if the cut is invalid).
+// The cuts are snapped to the frames of the node, the resulting nodes do not overlap nor leave gaps
+func splitVideoNode(splitNode VideoNode, eventType string, start, end float64) []VideoNode {
+	nodes := []VideoNode{}
+	if splitNode.isLegacy() {
+		splitNode = splitNode.conform(DefaultFrameRate())
+	}
 
+	rate := splitNode.FrameRate
+	startFrame, endFrame := rate.Frames(start), rate.Frames(end)
 	switch eventType {
 	case EVT_SLICE_CUT:
-		if end > splitNode.Start && end+0.1 < splitNode.End {
-			nodes = append(nodes, createVideoNode(splitNode.RID, splitNode.Name, start, end), createVideoNode(splitNode.RID, splitNode.Name, end+0.1, splitNode.End))
+		if startFrame >= splitNode.StartFrame && startFrame < endFrame && endFrame < splitNode.EndFrame {
+			nodes = append(nodes, createFrameNode(splitNode.RID, splitNode.Name, startFrame, endFrame, rate),
+				createFrameNode(splitNode.RID, splitNode.Name, endFrame, splitNode.EndFrame, rate))
 		}
 	case EVT_INTERVAL_CUT:
-		if start-0.1 > splitNode.Start && end+0.1 < splitNode.End {
-			nodes = append(nodes, createVideoNode(splitNode.RID, splitNode.Name, splitNode.Start, start-0.1), createVideoNode(splitNode.RID, splitNode.Name, start, end),
-				createVideoNode(splitNode.RID, splitNode.Name, end+0.1, splitNode.End))
+		if startFrame > splitNode.StartFrame && startFrame < endFrame && endFrame < splitNode.EndFrame {
+			nodes = append(nodes, createFrameNode(splitNode.RID, splitNode.Name, splitNode.StartFrame, startFrame, rate),
+				createFrameNode(splitNode.RID, splitNode.Name, startFrame, endFrame, rate),
+				createFrameNode(splitNode.RID, splitNode.Name, endFrame, splitNode.EndFrame, rate))
 		}
 	}
-
-	if len(nodes) <= 0 {
-		return nodes, fmt.Errorf("invalid cut range")
+	for i := range nodes {
+		nodes[i].Speed = splitNode.Speed
 	}
-	tl.VideoNodes = append(tl.VideoNodes[:pos], append(nodes, tl.VideoNodes[pos+1:]...)...)
-	return nodes, nil
+	return nodes
 }
 
 func (tl *Timeline) DeleteRIDReferences(rid string) error {
 	if tl.VideoNodes == nil {
 		return fmt.Errorf("no timeline exists")
 	}
-	tl.VideoNodes = slices.DeleteFunc(tl.VideoNodes, func(vn VideoNode) bool {
-		return vn.RID == rid
-	})
-	return nil
+
+	edits := ridReferenceEdits(MAIN_TRACK_ID, tl.VideoNodes, rid)
+	for _, track := range tl.VideoTracks {
+		edits = append(edits, ridReferenceEdits(track.ID, track.Nodes, rid)...)
+	}
+	for _, track := range tl.AudioTracks {
+		edits = append(edits, ridReferenceEdits(track.ID, track.Nodes, rid)...)
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	return tl.execute(OP_DELETE_RID_REFERENCES, edits...)
+}
+
+// ridReferenceEdits: returns the edits that delete the nodes of a track derived from a root id (last to first)
+func ridReferenceEdits(trackID string, nodes []VideoNode, rid string) []Edit {
+	edits := []Edit{}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].RID == rid {
+			edits = append(edits, Edit{Track: trackID, Pos: i, Removed: []VideoNode{nodes[i]}})
+		}
+	}
+	return edits
 }
 
 // GenerateEditThumbnail: generate a thumbnail from a video
@@ -367,41 +626,54 @@ func FormatTime(seconds float64) string {
 	return formattedTime
 }
 
+// ValidateRequiredFields: checks the options of a query type, every violation is reported in a *ValidationError
 func (p *ProcessingOpts) ValidateRequiredFields(queryType string) error {
+	verr := &ValidationError{}
 	if p.Filename == "" {
-		return fmt.Errorf("filename was not provided")
+		verr.Add("filename", VALIDATION_REQUIRED, "filename was not provided")
 	}
 	if p.VideoFormat == "" {
-		return fmt.Errorf("video format was not provided")
+		verr.Add("video_format", VALIDATION_REQUIRED, "video format was not provided")
 	}
 	for _, extension := range getValidVideoExtensions() {
 		if strings.Contains(p.Filename, extension) {
-			return fmt.Errorf(fmt.Sprintf("invalid filename %s", p.Filename))
+			verr.Add("filename", VALIDATION_INVALID, "invalid filename %s", p.Filename)
+			break
 		}
 	}
 
 	switch queryType {
 	case QUERY_FILTERGRAPH:
 		if p.OutputPath == "" {
-			return fmt.Errorf("output path was not provided")
+			verr.Add("output_path", VALIDATION_REQUIRED, "output path was not provided")
+		}
+		if p.VideoFormat != "" && !p.isCodecCompatible() {
+			verr.Add("codec", VALIDATION_INCOMPATIBLE, "codec is not compatible with %s format", p.VideoFormat)
 		}
-		if !p.isCodecCompatible() {
-			return fmt.Errorf("codec is not compatible with %s format", p.VideoFormat)
+		if p.AudioCodec != "" && p.VideoFormat != "" && !p.isAudioCodecCompatible() {
+			verr.Add("audio_codec", VALIDATION_INCOMPATIBLE, "audio codec is not compatible with %s format", p.VideoFormat)
 		}
-	case QUERY_LOSSLESS_CUT:
+		if p.AudioBitrate != "" && !isValidBitrate(p.AudioBitrate) {
+			verr.Add("audio_bitrate", VALIDATION_INVALID, "invalid audio bitrate %s", p.AudioBitrate)
+		}
+		if p.Chapters && !slices.Contains(getChapterFormats(), p.VideoFormat) {
+			verr.Add("chapters", VALIDATION_UNSUPPORTED, "chapters are not supported by %s format (.mp4, .mkv)", p.VideoFormat)
+		}
+		p.validateRateControl(verr)
+	case QUERY_LOSSLESS_CUT, QUERY_LOSSLESS_MERGE, QUERY_SMART_RENDER:
 		if p.OutputPath == "" {
-			return fmt.Errorf("output path was not provided")
+			verr.Add("output_path", VALIDATION_REQUIRED, "output path was not provided")
 		}
 
 	case QUERY_CREATE_PROXY_FILE, QUERY_CREATE_THUMBNAIL:
 		if p.OutputPath == "" {
-			return fmt.Errorf("output path was not provided")
+			verr.Add("output_path", VALIDATION_REQUIRED, "output path was not provided")
 		}
 		if p.InputPath == "" {
-			return fmt.Errorf("input path was not provided")
+			verr.Add("input_path", VALIDATION_REQUIRED, "input path was not provided")
 		}
 	}
-	return nil
+	return verr.Err()
 }
 
 func (p ProcessingOpts) isCodecCompatible() bool {
@@ -414,3 +686,39 @@ func (p ProcessingOpts) isCodecCompatible() bool {
 		return slices.Contains(getCompatibleRest(), p.Codec)
 	}
 }
+
+func (p ProcessingOpts) isAudioCodecCompatible() bool {
+	switch p.VideoFormat {
+	case ".webm":
+		return slices.Contains(getCompatibleAudioWebm(), p.AudioCodec)
+	case ".ogv":
+		return slices.Contains(getCompatibleAudioOGV(), p.AudioCodec)
+	default:
+		return slices.Contains(getCompatibleAudioRest(), p.AudioCodec)
+	}
+}
+
+// GetAudioCodec: returns the audio codec of the options, or the default audio codec of the video format
+func (p ProcessingOpts) GetAudioCodec() string {
+	if p.AudioCodec != "" {
+		return p.AudioCodec
+	}
+	switch p.VideoFormat {
+	case ".webm":
+		return AUDIO_CODEC_OPUS
+	case ".ogv":
+		return AUDIO_CODEC_VORBIS
+	default:
+		return AUDIO_CODEC_AAC
+	}
+}
+
+// isValidBitrate: checks that a bitrate is a positive number, optionally followed by k or M (128k, 2M)
+func isValidBitrate(bitrate string) bool {
+	value := strings.TrimRight(bitrate, "kM")
+	if len(bitrate)-len(value) > 1 {
+		return false
+	}
+	n, err := strconv.Atoi(value)
+	return err == nil && n > 0
+}
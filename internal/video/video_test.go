@@ -315,3 +315,182 @@ func TestMarkLossless(t *testing.T) {
 		}
 	})
 }
+
+func TestTimelineClone(t *testing.T) {
+	tl := NewTimeline()
+	if _, err := tl.Insert("1", "Node1", 0, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	track, err := tl.AddTrack(TRACK_AUDIO, "music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.InsertTrackNode(track.ID, "2", "Node2", 0, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	clone := tl.Clone()
+
+	// the edits of the timeline are not seen by the clone
+	if err := tl.RenameVideoNode(0, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.SplitTrackNode(track.ID, EVT_INTERVAL_CUT, 0, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.SetFrameRate("3", Rational{Num: 25, Den: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := tl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tl.RenameVideoNode(0, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.VideoNodes[0].Name != "Node1" || len(clone.VideoNodes) != 1 {
+		t.Errorf("expected the nodes of the clone to be unchanged, got %+v", clone.VideoNodes)
+	}
+	if len(clone.AudioTracks[0].Nodes) != 1 {
+		t.Errorf("expected the track nodes of the clone to be unchanged, got %+v", clone.AudioTracks[0].Nodes)
+	}
+	if _, ok := clone.FrameRates["3"]; ok {
+		t.Errorf("expected the frame rates of the clone to be unchanged")
+	}
+	if len(clone.History.Undo) != 3 || clone.History.Undo[2].Op != OP_INSERT {
+		t.Errorf("expected the history of the clone to be unchanged, got %+v", clone.History.Undo)
+	}
+}
+
+func TestTrackInsert(t *testing.T) {
+	t.Run("nodes are ordered by their timeline position", func(t *testing.T) {
+		tl := NewTimeline()
+		track, err := tl.AddTrack(TRACK_AUDIO, "music")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tl.InsertTrackNode(track.ID, "1", "Node1", 0, 5, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "2", "Node2", 0, 5, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := tl.GetTrack(track.ID)
+		if len(got.Nodes) != 2 || got.Nodes[0].RID != "2" || got.Nodes[1].RID != "1" {
+			t.Errorf("the track nodes are not ordered by position: %+v", got.Nodes)
+		}
+	})
+
+	t.Run("overlapping nodes are rejected", func(t *testing.T) {
+		tl := NewTimeline()
+		track, _ := tl.AddTrack(TRACK_VIDEO, "b-roll")
+		if _, err := tl.InsertTrackNode(track.ID, "1", "Node1", 0, 5, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "2", "Node2", 0, 5, 12); err == nil {
+			t.Errorf("node overlaps [10, 15] and it should have failed")
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "2", "Node2", 0, 5, 15); err != nil {
+			t.Errorf("adjacent node should have been inserted: %s", err.Error())
+		}
+	})
+
+	t.Run("invalid track type", func(t *testing.T) {
+		tl := NewTimeline()
+		if _, err := tl.AddTrack("subtitles", ""); err == nil {
+			t.Errorf("track type subtitles is invalid and it should have failed")
+		}
+	})
+}
+
+func TestTrackSplit(t *testing.T) {
+	t.Run("split nodes keep their timeline position", func(t *testing.T) {
+		tl := NewTimeline()
+		track, _ := tl.AddTrack(TRACK_VIDEO, "")
+		if _, err := tl.InsertTrackNode(track.ID, "1", "Node", 10, 20, 5); err != nil {
+			t.Fatal(err)
+		}
+
+		nodes, err := tl.SplitTrackNode(track.ID, EVT_INTERVAL_CUT, 0, 12, 15)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 3 {
+			t.Fatalf("expected 3 nodes, got %d", len(nodes))
+		}
+		for _, node := range nodes {
+			if math.Abs(node.Position-(5+node.Start-10)) > Epsilon {
+				t.Errorf("node [%.2f, %.2f] has position %.2f", node.Start, node.End, node.Position)
+			}
+		}
+	})
+}
+
+func TestDeleteTrackNodeAndRemoveTrack(t *testing.T) {
+	tl := NewTimeline()
+	video1, _ := tl.AddTrack(TRACK_VIDEO, "video1")
+	video2, _ := tl.AddTrack(TRACK_VIDEO, "video2")
+	if _, err := tl.InsertTrackNode(video1.ID, "1", "Node", 0, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tl.DeleteTrackNode(video1.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.DeleteTrackNode(video1.ID, 0); err == nil {
+		t.Errorf("track is empty and it should have failed")
+	}
+
+	if err := tl.MoveTrack(video2.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tl.VideoTracks[0].ID != video2.ID {
+		t.Errorf("track %s was not moved to the bottom", video2.Name)
+	}
+
+	if err := tl.RemoveTrack(video1.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.VideoTracks) != 1 {
+		t.Errorf("expected 1 video track, got %d", len(tl.VideoTracks))
+	}
+}
+
+func TestValidateAudioOpts(t *testing.T) {
+	opts := ProcessingOpts{
+		Filename:    "myvideo",
+		VideoFormat: ".webm",
+		OutputPath:  "outputpath",
+		Codec:       CODEC_VP9,
+	}
+
+	t.Run("default audio codec of the video format", func(t *testing.T) {
+		if err := opts.ValidateRequiredFields(QUERY_FILTERGRAPH); err != nil {
+			t.Fatal(err)
+		}
+		if opts.GetAudioCodec() != AUDIO_CODEC_OPUS {
+			t.Errorf("got %s, expected %s", opts.GetAudioCodec(), AUDIO_CODEC_OPUS)
+		}
+	})
+
+	t.Run("audio codec is not compatible with the video format", func(t *testing.T) {
+		aacOpts := opts
+		aacOpts.AudioCodec = AUDIO_CODEC_AAC
+		if err := aacOpts.ValidateRequiredFields(QUERY_FILTERGRAPH); err == nil {
+			t.Errorf("aac in .webm should have failed")
+		}
+	})
+
+	t.Run("invalid audio bitrate", func(t *testing.T) {
+		for _, bitrate := range []string{"fast", "-128k", "128kk", "0"} {
+			badOpts := opts
+			badOpts.AudioBitrate = bitrate
+			if err := badOpts.ValidateRequiredFields(QUERY_FILTERGRAPH); err == nil {
+				t.Errorf("bitrate %s should have failed", bitrate)
+			}
+		}
+	})
+}
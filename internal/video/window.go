@@ -0,0 +1,98 @@
+package video
+
+import (
+	"fmt"
+	"math"
+)
+
+// Window: a part of the timeline as a timeline of its own, it is rendered the same way as the whole timeline
+type Window struct {
+	// Start: the position of the window in the timeline (seconds)
+	Start float64
+	// End: the position in the timeline where the window ends (seconds)
+	End float64
+	// Timeline: the video nodes played during the window, cut to it and placed from its start
+	Timeline Timeline
+}
+
+/*
+Windows: splits the timeline in a window per video node of the main track, from the start of its transition with
+the previous node to the start of its transition with the next one. The window of a node holds the end of the
+previous node blended in by their transition, the node up to its next transition, and the parts of the nodes of
+the video and audio tracks played meanwhile. The nodes of a window are identified by their position in it, so the
+windows of an unchanged part of the timeline are equal
+*/
+func (tl *Timeline) Windows() []Window {
+	windows := []Window{}
+	position := 0.0
+	for i, videoNode := range tl.VideoNodes {
+		incoming, hasIncoming := tl.TransitionAfter(i - 1)
+		outgoing, _ := tl.TransitionAfter(i)
+		start, end := position, position+videoNode.Duration()-outgoing.Duration
+		position = end
+		if end-start < Epsilon {
+			continue
+		}
+
+		window := Window{Start: start, End: end, Timeline: Timeline{VideoNodes: []VideoNode{}, Transitions: []Transition{}}}
+		body := videoNode.cut(0, videoNode.Duration()-outgoing.Duration)
+		if hasIncoming {
+			prev := tl.VideoNodes[i-1]
+			tail := prev.cut(prev.Duration()-incoming.Duration, prev.Duration())
+			window.Timeline.VideoNodes = append(window.Timeline.VideoNodes, tail)
+			window.Timeline.Transitions = append(window.Timeline.Transitions, Transition{ID: "0", From: "0", To: "1",
+				Type: incoming.Type, Duration: math.Min(incoming.Duration, math.Min(tail.Duration(), body.Duration()))})
+		}
+		window.Timeline.VideoNodes = append(window.Timeline.VideoNodes, body)
+		for n := range window.Timeline.VideoNodes {
+			window.Timeline.VideoNodes[n].ID = fmt.Sprintf("%d", n)
+		}
+		window.Timeline.VideoTracks = windowTracks(tl.VideoTracks, start, end)
+		window.Timeline.AudioTracks = windowTracks(tl.AudioTracks, start, end)
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// windowTracks: the parts of the nodes of the tracks played during [start, end), placed from start
+func windowTracks(tracks []Track, start, end float64) []Track {
+	windowed := []Track{}
+	for _, track := range tracks {
+		nodes := []VideoNode{}
+		for _, videoNode := range track.Nodes {
+			from, to := math.Max(start, videoNode.Position), math.Min(end, videoNode.Position+videoNode.Duration())
+			if to-from < Epsilon {
+				continue
+			}
+			cut := videoNode.cut(from-videoNode.Position, to-videoNode.Position)
+			if cut.SourceDuration() <= 0 {
+				continue
+			}
+			cut.ID = fmt.Sprintf("%d", len(nodes))
+			cut.Position = from - start
+			nodes = append(nodes, cut)
+		}
+		windowed = append(windowed, Track{ID: track.ID, Name: track.Name, Type: track.Type, Nodes: nodes})
+	}
+	return windowed
+}
+
+// cut: the part of the video node played between from and to, in seconds of the timeline after its start
+func (v VideoNode) cut(from, to float64) VideoNode {
+	if v.isLegacy() {
+		speed := v.SpeedFactor()
+		v.Start, v.End = v.Start+from*speed, math.Min(v.End, v.Start+to*speed)
+		return v
+	}
+
+	startFrame, endFrame := v.StartFrame+v.sourceFrames(from), v.StartFrame+v.sourceFrames(to)
+	if endFrame > v.EndFrame {
+		endFrame = v.EndFrame
+	}
+	if startFrame > endFrame {
+		startFrame = endFrame
+	}
+	v.StartFrame, v.EndFrame = startFrame, endFrame
+	v.Start, v.End = v.FrameRate.Seconds(startFrame), v.FrameRate.Seconds(endFrame)
+	return v
+}
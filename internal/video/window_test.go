@@ -0,0 +1,74 @@
+package video
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWindows(t *testing.T) {
+	t.Run("windows split the timeline at the start of the transitions", func(t *testing.T) {
+		tl := mockTl()
+		if _, err := tl.SetTransition(0, TRANSITION_CROSSFADE, 1); err != nil {
+			t.Fatal(err)
+		}
+		track, err := tl.AddTrack(TRACK_VIDEO, "overlay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.InsertTrackNode(track.ID, "overlay", "overlay", 0, 2, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		windows := tl.Windows()
+		if len(windows) != len(tl.VideoNodes) {
+			t.Fatalf("expected a window per node, got %d", len(windows))
+		}
+		total := 0.0
+		for _, window := range windows {
+			total += window.End - window.Start
+			if math.Abs(window.Timeline.Duration()-(window.End-window.Start)) > Epsilon {
+				t.Errorf("the window [%.4f, %.4f) plays %.4f seconds", window.Start, window.End, window.Timeline.Duration())
+			}
+		}
+		if math.Abs(total-tl.Duration()) > Epsilon {
+			t.Errorf("the windows play %.4f seconds of a %.4f seconds timeline", total, tl.Duration())
+		}
+
+		// the first window stops where the transition starts, the second one holds the transition
+		first, second := windows[0], windows[1]
+		if math.Abs(first.End-1.7) > Epsilon || len(first.Timeline.Transitions) != 0 {
+			t.Errorf("expected the first window to end at the transition, got %+v", first)
+		}
+		if len(second.Timeline.VideoNodes) != 2 || len(second.Timeline.Transitions) != 1 ||
+			math.Abs(second.Timeline.VideoNodes[0].Start-5.9) > Epsilon || second.Timeline.VideoNodes[0].ID != "0" {
+			t.Errorf("expected the second window to blend the end of the first node, got %+v", second.Timeline)
+		}
+
+		// the overlay is cut by the windows and placed from their start
+		firstOverlay, secondOverlay := first.Timeline.VideoTracks[0].Nodes, second.Timeline.VideoTracks[0].Nodes
+		if len(firstOverlay) != 1 || math.Abs(firstOverlay[0].Position-1) > Epsilon || math.Abs(firstOverlay[0].Duration()-0.7) > Epsilon {
+			t.Errorf("expected the start of the overlay in the first window, got %+v", firstOverlay)
+		}
+		if len(secondOverlay) != 1 || secondOverlay[0].Position != 0 || math.Abs(secondOverlay[0].Start-0.7) > Epsilon {
+			t.Errorf("expected the rest of the overlay in the second window, got %+v", secondOverlay)
+		}
+		if len(windows[2].Timeline.VideoTracks[0].Nodes) != 0 {
+			t.Errorf("expected no overlay in the third window, got %+v", windows[2].Timeline.VideoTracks)
+		}
+	})
+
+	t.Run("unchanged parts of the timeline have equal windows", func(t *testing.T) {
+		tl := mockTl()
+		before := tl.Windows()
+		if _, err := tl.SetTransition(2, TRANSITION_CROSSFADE, 1); err != nil {
+			t.Fatal(err)
+		}
+		after := tl.Windows()
+		if before[0].Timeline.VideoNodes[0] != after[0].Timeline.VideoNodes[0] || before[1].Start != after[1].Start {
+			t.Errorf("expected the windows before the transition to be unchanged")
+		}
+		if before[3].Start == after[3].Start {
+			t.Errorf("expected the window after the transition to start with it")
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobCancelled: the job of a query was cancelled before it finished
+var ErrJobCancelled = errors.New("the job was cancelled")
+
+// Job: a FFmpeg query running in the background, it is cancelled with CancelJob
+type Job struct {
+	// ID: the unique identifier of the job
+	ID string `json:"id"`
+	// QueryType: the query executed by the job (q_filtergraph, q_lossless_cut, ...)
+	QueryType string `json:"query_type"`
+	// Name: the name of the file produced by the job
+	Name string `json:"name"`
+	// StartedAt: the time at which the job started
+	StartedAt time.Time `json:"started_at"`
+	// ctx: the context of the commands of the job, it is done once the job is cancelled or ended
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// stop: stops the cancellation of the job with the context of the registry
+	stop func() bool
+	// lock: guards the record of the commands, the commands of a batch run at the same time
+	lock sync.Mutex
+	// outputs: the files written by the commands of the job
+	outputs []string
+	// stderr: the stderr tail of the last command that failed, or of the last command if none failed
+	stderr string
+	// failures: the number of commands of the job that failed
+	failures int
+}
+
+// Cancelled: checks if the job was cancelled, a job that ended is not cancelled
+func (j *Job) Cancelled() bool {
+	return errors.Is(context.Cause(j.ctx), ErrJobCancelled)
+}
+
+// record: records the outputs and the stderr tail of a command of the job, pipes and the null output are skipped
+func (j *Job) record(outputs []string, stderr string, failed bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, output := range outputs {
+		if output == "-" || strings.HasPrefix(output, "pipe:") {
+			continue
+		}
+		j.outputs = append(j.outputs, output)
+	}
+	if failed {
+		j.failures++
+		j.stderr = stderr
+	} else if j.failures == 0 {
+		j.stderr = stderr
+	}
+}
+
+// JobRegistry: the jobs that are running
+type JobRegistry struct {
+	// ctx: the jobs are cancelled once it is done, including the jobs started after it is done
+	ctx  context.Context
+	lock sync.Mutex
+	jobs map[string]*Job
+	// running: the jobs started that have not ended, they are waited for before the app exits
+	running sync.WaitGroup
+}
+
+func NewJobRegistry(ctx context.Context) *JobRegistry {
+	return &JobRegistry{ctx: ctx, jobs: map[string]*Job{}}
+}
+
+// Start: registers a new job of a query
+func (r *JobRegistry) Start(queryType string, name string) *Job {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	job := &Job{
+		ID:        strings.Replace(uuid.New().String(), "-", "", -1),
+		QueryType: queryType,
+		Name:      name,
+		StartedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if r.ctx.Err() != nil {
+		cancel(ErrJobCancelled)
+	}
+	job.stop = context.AfterFunc(r.ctx, func() { cancel(ErrJobCancelled) })
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.jobs[job.ID] = job
+	r.running.Add(1)
+	return job
+}
+
+// End: removes a finished job, its context is released
+func (r *JobRegistry) End(job *Job) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.jobs, job.ID)
+	job.stop()
+	job.cancel(nil)
+	r.running.Done()
+}
+
+// Cancel: cancels the running job with the given id
+func (r *JobRegistry) Cancel(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return fmt.Errorf("job with id %s is not running", id)
+	}
+	job.cancel(ErrJobCancelled)
+	return nil
+}
+
+// CancelAll: cancels every running job
+func (r *JobRegistry) CancelAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, job := range r.jobs {
+		job.cancel(ErrJobCancelled)
+	}
+}
+
+// Wait: waits for the running jobs to end, or for the context to be done
+func (r *JobRegistry) Wait(ctx context.Context) error {
+	ended := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(ended)
+	}()
+
+	select {
+	case <-ended:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// List: returns the running jobs, oldest first
+func (r *JobRegistry) List() []Job {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	running := make([]*Job, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		running = append(running, job)
+	}
+	slices.SortFunc(running, func(a, b *Job) int { return a.StartedAt.Compare(b.StartedAt) })
+
+	jobs := make([]Job, 0, len(running))
+	for _, job := range running {
+		jobs = append(jobs, Job{ID: job.ID, QueryType: job.QueryType, Name: job.Name, StartedAt: job.StartedAt})
+	}
+	return jobs
+}
+
+// CancelJob: cancels a running FFmpeg query, ffmpeg is stopped and its partial outputs are removed
+func (a *App) CancelJob(id string) error {
+	if err := a.jobs.Cancel(id); err != nil {
+		return err
+	}
+	a.notifier.LogInfo(fmt.Sprintf("job %s was cancelled", id))
+	return nil
+}
+
+// ListJobs: returns the FFmpeg queries that are running
+func (a *App) ListJobs() []Job {
+	return a.jobs.List()
+}
+
+// removePartialOutputs: removes the files written by a cancelled command, pipes and the null output are skipped
+func removePartialOutputs(outputs []string) {
+	for _, output := range outputs {
+		if output == "-" || strings.HasPrefix(output, "pipe:") {
+			continue
+		}
+		_ = os.Remove(output)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k1nho/gahara/ffmpegbuilder"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// cancelRunningJob: cancels the only running job once the script is running, and returns the error of the query
+func cancelRunningJob(t *testing.T, app *App, script *fakeScript, query func() error) error {
+	t.Helper()
+	done := make(chan error)
+	go func() { done <- query() }()
+
+	<-script.running
+	jobs := app.ListJobs()
+	if len(jobs) != 1 {
+		t.Fatalf("expected a running job, got %v", jobs)
+	}
+	if err := app.CancelJob(jobs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	return <-done
+}
+
+func TestCancelExport(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	script := fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=2500000").untilCancelled()
+
+	opts := mockExportOpts(app)
+	err := cancelRunningJob(t, app, script, func() error { return app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts) })
+	if !errors.Is(err, ErrJobCancelled) {
+		t.Fatalf("expected the job to be cancelled, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(app.config.ProjectDir, "export.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial output to be removed")
+	}
+	started := notifier.eventsOf(video.EVT_JOB_STARTED)
+	results := notifier.eventsOf(video.EVT_FFMPEG_RESULT)
+	if len(started) != 1 || len(results) != 1 {
+		t.Fatalf("expected a started job and its result, got %v", notifier.events)
+	}
+	result := results[0][0].(*VideoProcessingResult)
+	if result.Status != Cancelled || result.ID != started[0][0].(*Job).ID {
+		t.Errorf("expected the job to be reported as cancelled, got %+v", result)
+	}
+	if len(app.ListJobs()) != 0 {
+		t.Errorf("expected no running job, got %v", app.ListJobs())
+	}
+}
+
+func TestCancelEndedExport(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	// the job is cancelled as ffmpeg exits after writing the whole export
+	fake.on("ffmpeg", "-filter_complex").onExit(app.jobs.CancelAll)
+
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)); err != nil {
+		t.Fatalf("expected the ended export to succeed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(app.config.ProjectDir, "export.mp4")); err != nil {
+		t.Errorf("expected the export to be kept: %s", err.Error())
+	}
+	results := notifier.eventsOf(video.EVT_FFMPEG_RESULT)
+	if len(results) != 1 || results[0][0].(*VideoProcessingResult).Status != Success {
+		t.Errorf("expected the export to be reported as a success, got %v", results)
+	}
+}
+
+func TestCancelTwoPassExport(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	script := fake.on("ffmpeg", "-filter_complex", "null").untilCancelled()
+
+	opts := mockExportOpts(app)
+	opts.CRF, opts.RateControl, opts.VideoBitrate, opts.TwoPass = "", video.RATE_CONTROL_BITRATE, "4M", true
+	err := cancelRunningJob(t, app, script, func() error { return app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts) })
+	if !errors.Is(err, ErrJobCancelled) {
+		t.Fatalf("expected the job to be cancelled, got %v", err)
+	}
+	if commands := fake.commands("ffmpeg"); len(commands) != 1 {
+		t.Errorf("expected the second pass not to run, got %d passes", len(commands))
+	}
+}
+
+func TestCancelLosslessCut(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	if err := app.ToggleLossless(1); err != nil {
+		t.Fatal(err)
+	}
+	script := fake.on("ffmpeg", sources[1]).untilCancelled()
+
+	opts := video.ProcessingOpts{VideoFormat: ".mov", OutputPath: t.TempDir(), Filename: "cut"}
+	err := cancelRunningJob(t, app, script, func() error { return app.FFmpegQuery(video.QUERY_LOSSLESS_CUT, opts) })
+	if !errors.Is(err, ErrJobCancelled) {
+		t.Fatalf("expected the job to be cancelled, got %v", err)
+	}
+
+	// the cancellation is reported once for the job, not as a failure of the node
+	results := notifier.eventsOf(video.EVT_FFMPEG_RESULT)
+	if len(results) != 1 || results[0][0].(*VideoProcessingResult).Status != Cancelled {
+		t.Errorf("expected a single cancelled result, got %v", results)
+	}
+	if _, err := os.Stat(filepath.Join(opts.OutputPath, "talk.mov")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial cut to be removed")
+	}
+}
+
+func TestWaitCancelledJobs(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	script := fake.on("ffmpeg", "-filter_complex").untilCancelled()
+
+	done := make(chan error)
+	go func() { done <- app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)) }()
+	<-script.running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := app.jobs.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the running export to be waited for, got %v", err)
+	}
+
+	// the app cancels the jobs on shutdown, and waits for them to remove their partial outputs
+	app.jobs.CancelAll()
+	if err := app.jobs.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(app.config.ProjectDir, "export.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial output to be removed once the job ended")
+	}
+	if err := <-done; !errors.Is(err, ErrJobCancelled) {
+		t.Errorf("expected the job to be cancelled, got %v", err)
+	}
+}
+
+func TestCancelUnknownJob(t *testing.T) {
+	app, _, _ := newTestApp(t)
+	if err := app.CancelJob("missing"); err == nil {
+		t.Errorf("expected an error for a job that is not running")
+	}
+}
+
+func TestExecExecutorCancel(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not available")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := (&execExecutor{}).Run(ctx, ffmpegbuilder.Command{Path: sleep, Args: []string{"10"}}, io.Discard); err == nil {
+		t.Errorf("expected the interrupted command to fail")
+	}
+	if time.Since(start) > CANCEL_GRACE_PERIOD {
+		t.Errorf("expected the command to be interrupted, it ran for %s", time.Since(start))
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -30,6 +34,14 @@ func main() {
 	// Create an instance of the app structure
 	app := NewApp()
 
+	// gahara export runs without the window (build boxes without a display)
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := runExportCommand(ctx, app, os.Args[2:], os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
+
 	// Create application with options
 	err := wails.Run(&options.App{
 		Title:  "Gahara",
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/k1nho/gahara/internal/video"
+	wruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Notifier: sends the events and the logs of the app to the frontend
+type Notifier interface {
+	// EventsEmit: emits an event with optional data to the frontend
+	EventsEmit(eventName string, optionalData ...interface{})
+	LogDebug(message string)
+	LogInfo(message string)
+	LogError(message string)
+}
+
+// wailsNotifier: the Notifier of the wails runtime, it requires the context given on startup
+type wailsNotifier struct {
+	ctx context.Context
+}
+
+func (n *wailsNotifier) EventsEmit(eventName string, optionalData ...interface{}) {
+	wruntime.EventsEmit(n.ctx, eventName, optionalData...)
+}
+
+func (n *wailsNotifier) LogDebug(message string) {
+	wruntime.LogDebug(n.ctx, message)
+}
+
+func (n *wailsNotifier) LogInfo(message string) {
+	wruntime.LogInfo(n.ctx, message)
+}
+
+func (n *wailsNotifier) LogError(message string) {
+	wruntime.LogError(n.ctx, message)
+}
+
+/*
+consoleNotifier: the Notifier of the command line, the progress and the results of the queries are written to out
+and the logs to errOut. The info and debug logs are only written when verbose
+*/
+type consoleNotifier struct {
+	lock    sync.Mutex
+	out     io.Writer
+	errOut  io.Writer
+	verbose bool
+}
+
+func newConsoleNotifier(out io.Writer, errOut io.Writer, verbose bool) *consoleNotifier {
+	return &consoleNotifier{out: out, errOut: errOut, verbose: verbose}
+}
+
+func (n *consoleNotifier) EventsEmit(eventName string, optionalData ...interface{}) {
+	if len(optionalData) == 0 {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	switch data := optionalData[0].(type) {
+	case EncodingProgress:
+		fmt.Fprintln(n.out, formatProgress(data))
+	case *VideoProcessingResult:
+		fmt.Fprintf(n.out, "%s: %s %s\n", data.Name, data.Status, data.Message)
+	case VideoProcessingResult:
+		fmt.Fprintf(n.out, "%s: %s %s\n", data.Name, data.Status, data.Message)
+	case BatchSummary:
+		fmt.Fprintf(n.out, "%d of %d exports succeeded\n", data.Succeeded, data.Total)
+	case string:
+		if eventName == video.EVT_EXPORT_MSG {
+			fmt.Fprintln(n.out, data)
+		}
+	}
+}
+
+func (n *consoleNotifier) LogDebug(message string) {
+	if n.verbose {
+		n.log("debug", message)
+	}
+}
+
+func (n *consoleNotifier) LogInfo(message string) {
+	if n.verbose {
+		n.log("info", message)
+	}
+}
+
+func (n *consoleNotifier) LogError(message string) {
+	n.log("error", message)
+}
+
+func (n *consoleNotifier) log(level string, message string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	fmt.Fprintf(n.errOut, "%s: %s\n", level, message)
+}
+
+// formatProgress: formats the progress of a job as a line (pass 1/2  42.5%  eta 1m12s  speed 1.50x)
+func formatProgress(p EncodingProgress) string {
+	line := ""
+	if p.Passes > 1 {
+		line = fmt.Sprintf("pass %d/%d  ", p.Pass, p.Passes)
+	}
+	if p.Percent < 0 {
+		line += fmt.Sprintf("%s encoded", time.Duration(p.Report.OutTime*float64(time.Second)).Round(time.Second))
+	} else {
+		line += fmt.Sprintf("%5.1f%%", p.Percent)
+	}
+	if p.ETA >= 0 {
+		line += fmt.Sprintf("  eta %s", time.Duration(p.ETA*float64(time.Second)).Round(time.Second))
+	}
+	if p.Report.Speed > 0 {
+		line += fmt.Sprintf("  speed %.2fx", p.Report.Speed)
+	}
+	return line
+}
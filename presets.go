@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/k1nho/gahara/internal/storage"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// PRESETS_FILE: the file of the gahara workspace where the export presets of the user are saved
+	PRESETS_FILE = "presets.json"
+	// REJECTED_PRESETS_FILE: the copy of a presets file that could not be loaded, it is kept before the presets are saved again
+	REJECTED_PRESETS_FILE = "presets.rejected.json"
+)
+
+/*
+loadPresets: loads the export presets of the user from the gahara workspace, none if the file does not exist. The
+presets that cannot be loaded are logged, a file that cannot be loaded at all is copied aside before it is replaced
+*/
+func (a *App) loadPresets() {
+	a.presetsLock.Lock()
+	defer a.presetsLock.Unlock()
+
+	a.presets = video.NewPresetRegistry()
+	data, err := os.ReadFile(path.Join(a.config.GaharaDir, PRESETS_FILE))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		a.notifier.LogError(fmt.Sprintf("could not read the export presets: %s", err.Error()))
+		return
+	}
+
+	presets, err := video.UnmarshalPresets(data)
+	if err != nil {
+		rejectedPath := path.Join(a.config.GaharaDir, REJECTED_PRESETS_FILE)
+		if werr := storage.WriteFile(rejectedPath, data, 0644, 1); werr != nil {
+			a.notifier.LogError(fmt.Sprintf("could not keep the export presets in %s: %s", rejectedPath, werr.Error()))
+		}
+		a.notifier.LogError(fmt.Sprintf("could not load the export presets, they were copied to %s: %s", rejectedPath, err.Error()))
+		return
+	}
+	for _, rejected := range presets.Rejected() {
+		name := rejected.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		a.notifier.LogError(fmt.Sprintf("could not load the export preset %s, it is kept in %s: %s", name, PRESETS_FILE, rejected.Reason.Error()))
+	}
+	a.presets = presets
+}
+
+// savePresets: writes the export presets of the user to the gahara workspace, the presets lock is held by the caller
+func (a *App) savePresets() error {
+	data, err := a.presets.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(path.Join(a.config.GaharaDir, PRESETS_FILE), data, 0644, 1)
+}
+
+// ListExportPresets: returns the built-in export presets followed by the presets of the user
+func (a *App) ListExportPresets() []video.ExportPreset {
+	a.presetsLock.Lock()
+	defer a.presetsLock.Unlock()
+	return a.presets.List()
+}
+
+// CreateExportPreset: validates and saves a new export preset
+func (a *App) CreateExportPreset(preset video.ExportPreset) (video.ExportPreset, error) {
+	a.presetsLock.Lock()
+	defer a.presetsLock.Unlock()
+	created, err := a.presets.Create(preset)
+	if err != nil {
+		return video.ExportPreset{}, err
+	}
+	if err := a.savePresets(); err != nil {
+		_ = a.presets.Delete(created.ID)
+		return video.ExportPreset{}, err
+	}
+	return created, nil
+}
+
+// UpdateExportPreset: validates and saves the changes of an export preset of the user
+func (a *App) UpdateExportPreset(preset video.ExportPreset) (video.ExportPreset, error) {
+	a.presetsLock.Lock()
+	defer a.presetsLock.Unlock()
+	previous, ok := a.presets.Get(preset.ID)
+	if !ok {
+		return video.ExportPreset{}, fmt.Errorf("preset with id %s was not found", preset.ID)
+	}
+	updated, err := a.presets.Update(preset)
+	if err != nil {
+		return video.ExportPreset{}, err
+	}
+	if err := a.savePresets(); err != nil {
+		_, _ = a.presets.Update(previous)
+		return video.ExportPreset{}, err
+	}
+	return updated, nil
+}
+
+// DeleteExportPreset: deletes an export preset of the user
+func (a *App) DeleteExportPreset(id string) error {
+	a.presetsLock.Lock()
+	defer a.presetsLock.Unlock()
+	if err := a.presets.Delete(id); err != nil {
+		return err
+	}
+	return a.savePresets()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// TestExportPresetsConcurrent: the presets are created, updated and deleted concurrently, run with -race
+func TestExportPresetsConcurrent(t *testing.T) {
+	app, _, _ := newTestApp(t)
+	app.loadPresets()
+	builtIn := app.ListExportPresets()[0]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			preset := builtIn
+			preset.Name = fmt.Sprintf("Draft %d", i)
+			created, err := app.CreateExportPreset(preset)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			created.Name += " (edited)"
+			if _, err := app.UpdateExportPreset(created); err != nil {
+				t.Error(err)
+			}
+			if i%2 == 0 {
+				if err := app.DeleteExportPreset(created.ID); err != nil {
+					t.Error(err)
+				}
+			}
+			_ = app.ListExportPresets()
+		}(i)
+	}
+	wg.Wait()
+
+	// the presets left in the registry are saved
+	expected := len(video.NewPresetRegistry().List()) + 4
+	app.loadPresets()
+	if loaded := len(app.ListExportPresets()); loaded != expected {
+		t.Errorf("expected %d presets to be saved, got %d", expected, loaded)
+	}
+}
+
+func TestLoadRejectedPresets(t *testing.T) {
+	app, _, notifier := newTestApp(t)
+	presetsPath := filepath.Join(app.config.GaharaDir, PRESETS_FILE)
+	saved := []byte(`{"version": 1, "presets": [{"id": "c", "name": "Broken", "codec": "libx264"}]}`)
+	if err := os.WriteFile(presetsPath, saved, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the invalid preset is reported, and saved again with the new preset
+	app.loadPresets()
+	if len(notifier.errors) != 1 || !strings.Contains(notifier.errors[0], "Broken") {
+		t.Errorf("expected the rejected preset to be logged, got %v", notifier.errors)
+	}
+	preset := app.ListExportPresets()[0]
+	preset.Name = "Draft"
+	if _, err := app.CreateExportPreset(preset); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(presetsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Broken") || !strings.Contains(string(data), "Draft") {
+		t.Errorf("expected the rejected preset to be kept, got %s", data)
+	}
+
+	// a document that cannot be loaded is copied aside before it is replaced
+	newer := []byte(`{"version": 99, "presets": []}`)
+	if err := os.WriteFile(presetsPath, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	app.loadPresets()
+	if _, err := app.CreateExportPreset(preset); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(app.config.GaharaDir, REJECTED_PRESETS_FILE)); err != nil || !bytes.Equal(data, newer) {
+		t.Errorf("expected the presets to be copied aside, got %s (%v)", data, err)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/k1nho/gahara/ffmpegbuilder"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+const (
+	// PREVIEW_DIR: the directory of the project directory where the previews and their segments are cached
+	PREVIEW_DIR = ".preview"
+	// PREVIEW_CACHE_SEGMENTS: the number of segments kept in the cache, the least recently used are removed
+	PREVIEW_CACHE_SEGMENTS = 100
+	// PREVIEW_VERSION: part of the key of the segments, a change of the preview parameters invalidates the cache
+	PREVIEW_VERSION = 2
+)
+
+// PreviewResult: a preview of the timeline rendered to the cache of the project
+type PreviewResult struct {
+	// JobID: the id of the job of the render
+	JobID string `json:"job_id"`
+	// Path: the absolute path of the preview, it is served by the FileLoader of the app
+	Path string `json:"path"`
+	// Start: the position in the timeline of the first frame of the preview (seconds)
+	Start float64 `json:"start"`
+	// Duration: the duration of the preview (seconds)
+	Duration float64 `json:"duration"`
+	// Rendered: the number of segments rendered, the windows that changed since the last previews
+	Rendered int `json:"rendered"`
+	// Cached: the number of segments reused from the cache
+	Cached int `json:"cached"`
+}
+
+/*
+RenderPreview: renders the timeline between start and end (seconds of the timeline, up to the end of the timeline if
+end <= start) to a low resolution preview. The timeline is rendered by windows (a video node of the main track with
+its transitions, and the video and audio tracks played meanwhile) with the filtergraph of the export. Every window
+is rendered to a segment cached by its content, so only the windows that changed are rendered again, and the
+segments are joined without re-encoding. The preview leaves out what only changes the encoding of an export:
+its resolution (the preview is 640x360 at 30 fps), rate control, two-pass encoding and chapters.
+A new render cancels the render of the previous preview
+*/
+func (a *App) RenderPreview(start, end float64) (PreviewResult, error) {
+	if a.config.ProjectDir == "" {
+		return PreviewResult{}, fmt.Errorf("no project is open")
+	}
+	timeline := a.snapshotTimeline()
+	windows, offset := previewWindows(timeline.Windows(), start, end)
+	if len(windows) == 0 {
+		return PreviewResult{}, fmt.Errorf("no video nodes to preview")
+	}
+
+	running := a.jobs.List()
+	for i := range running {
+		if running[i].QueryType == video.QUERY_PREVIEW {
+			_ = a.jobs.Cancel(running[i].ID)
+		}
+	}
+	a.previewLock.Lock()
+	defer a.previewLock.Unlock()
+
+	job := a.jobs.Start(video.QUERY_PREVIEW, "preview.mp4")
+	defer a.jobs.End(job)
+	a.notifier.EventsEmit(video.EVT_JOB_STARTED, job)
+
+	result, err := a.renderPreview(job, windows)
+	if err != nil && job.Cancelled() {
+		return PreviewResult{}, ErrJobCancelled
+	} else if err != nil {
+		a.notifier.LogError(fmt.Sprintf("could not render the preview: %s", err.Error()))
+		return PreviewResult{}, err
+	}
+	result.Start = offset
+	return result, nil
+}
+
+// renderPreview: renders the segments of the windows missing from the cache, and joins them in a preview
+func (a *App) renderPreview(job *Job, windows []video.Window) (PreviewResult, error) {
+	cacheDir := path.Join(a.config.ProjectDir, PREVIEW_DIR)
+	segmentsDir := path.Join(cacheDir, "segments")
+	if err := os.MkdirAll(segmentsDir, 0755); err != nil {
+		return PreviewResult{}, fmt.Errorf("could not create the preview cache: %s", err.Error())
+	}
+
+	// the sources of the windows are probed once
+	previewed := video.Timeline{}
+	for _, window := range windows {
+		previewed.VideoNodes = append(previewed.VideoNodes, window.Timeline.VideoNodes...)
+		previewed.VideoTracks = append(previewed.VideoTracks, window.Timeline.VideoTracks...)
+		previewed.AudioTracks = append(previewed.AudioTracks, window.Timeline.AudioTracks...)
+	}
+	infos, err := a.probeTimelineInputs(previewed)
+	if err != nil {
+		return PreviewResult{}, err
+	}
+	silentInputs := getSilentInputs(infos)
+
+	result := PreviewResult{JobID: job.ID}
+	keys, segments := []string{}, []string{}
+	for _, window := range windows {
+		name := window.Timeline.VideoNodes[len(window.Timeline.VideoNodes)-1].Name
+		key, err := previewSegmentKey(window.Timeline, silentInputs)
+		if err != nil {
+			return PreviewResult{}, fmt.Errorf("could not read the sources of %s: %s", name, err.Error())
+		}
+		segment := path.Join(segmentsDir, key+".mp4")
+		keys, segments = append(keys, key), append(segments, segment)
+		result.Duration += window.End - window.Start
+
+		if _, err := os.Stat(segment); err == nil {
+			// the segment was used recently, it is kept in the cache
+			now := time.Now()
+			_ = os.Chtimes(segment, now, now)
+			result.Cached++
+			continue
+		}
+
+		// the segment is rendered to a temporary file, a failed render is never cached
+		partial := path.Join(segmentsDir, key+".part.mp4")
+		query, err := ffmpegbuilder.PreviewSegmentQuery(a.FFmpegPath, window.Timeline, partial, silentInputs...)
+		if err != nil {
+			return PreviewResult{}, err
+		}
+		if err := a.executeFFmpegQuery(job, query, nil); err != nil {
+			_ = os.Remove(partial)
+			return PreviewResult{}, fmt.Errorf("could not render %s: %s", name, err.Error())
+		}
+		if err := os.Rename(partial, segment); err != nil {
+			return PreviewResult{}, fmt.Errorf("could not cache the segment of %s: %s", name, err.Error())
+		}
+		result.Rendered++
+	}
+
+	// the previews are named by their segments, an unchanged range is not joined again
+	name := "preview-" + previewKey(strings.Join(keys, ""))
+	result.Path = filepath.Join(cacheDir, name+".mp4")
+	if _, err := os.Stat(result.Path); err != nil {
+		if err := a.joinPreview(job, cacheDir, name, segments); err != nil {
+			return PreviewResult{}, err
+		}
+	}
+
+	prunePreviews(cacheDir, result.Path)
+	prunePreviewSegments(segmentsDir, PREVIEW_CACHE_SEGMENTS)
+	return result, nil
+}
+
+// joinPreview: joins the segments of a preview without re-encoding to the file name of the cache directory
+func (a *App) joinPreview(job *Job, cacheDir string, name string, segments []string) error {
+	listPath := path.Join(cacheDir, name+".txt")
+	if err := os.WriteFile(listPath, []byte(ffmpegbuilder.ConcatList(segments)), 0644); err != nil {
+		return fmt.Errorf("could not write the segments list: %s", err.Error())
+	}
+	defer os.Remove(listPath)
+
+	partialOpts := video.ProcessingOpts{OutputPath: cacheDir, Filename: name + ".part", VideoFormat: ".mp4"}
+	query, err := ffmpegbuilder.LosslessMergeQuery(a.FFmpegPath, listPath, partialOpts)
+	if err != nil {
+		return err
+	}
+	partial := ffmpegbuilder.GetFullOutputPath(partialOpts)
+	if err := a.executeFFmpegQuery(job, query, nil); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path.Join(cacheDir, name+".mp4"))
+}
+
+// previewWindows: the windows of the timeline that overlap [start, end), and the position of the first one
+func previewWindows(windows []video.Window, start, end float64) ([]video.Window, float64) {
+	selected, offset := []video.Window{}, 0.0
+	for _, window := range windows {
+		if window.End > start+video.Epsilon && (end <= start || window.Start < end-video.Epsilon) {
+			if len(selected) == 0 {
+				offset = window.Start
+			}
+			selected = append(selected, window)
+		}
+	}
+	return selected, offset
+}
+
+/*
+previewSegmentKey: the key of the segment of a window, it changes with what the window plays (intervals, speeds,
+positions, transitions, tracks) or with its sources. The names of the nodes and tracks are left out, renaming a clip
+does not render it again
+*/
+func previewSegmentKey(window video.Timeline, silentInputs []string) (string, error) {
+	keyed := window.Clone()
+	for i := range keyed.VideoNodes {
+		keyed.VideoNodes[i].Name, keyed.VideoNodes[i].LosslessExport = "", false
+	}
+	for _, tracks := range [][]video.Track{keyed.VideoTracks, keyed.AudioTracks} {
+		for t := range tracks {
+			tracks[t].Name = ""
+			for n := range tracks[t].Nodes {
+				tracks[t].Nodes[n].Name, tracks[t].Nodes[n].LosslessExport = "", false
+			}
+		}
+	}
+	content, err := json.Marshal(keyed)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%d|%s", PREVIEW_VERSION, content)
+	for _, rid := range ffmpegbuilder.ExtractTimelineInputs(window) {
+		source, err := os.Stat(rid)
+		if err != nil {
+			return "", err
+		}
+		key += fmt.Sprintf("|%s|%t|%d|%d", rid, slices.Contains(silentInputs, rid), source.Size(), source.ModTime().UnixNano())
+	}
+	return previewKey(key), nil
+}
+
+// previewKey: a short hash of the content of a preview
+func previewKey(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:16])
+}
+
+// prunePreviews: removes the previews of the cache directory other than the current one
+func prunePreviews(cacheDir string, current string) {
+	previews, err := filepath.Glob(filepath.Join(cacheDir, "preview-*.mp4"))
+	if err != nil {
+		return
+	}
+	for _, preview := range previews {
+		if preview != current {
+			_ = os.Remove(preview)
+		}
+	}
+}
+
+// prunePreviewSegments: keeps the limit segments used last, the others are removed
+func prunePreviewSegments(segmentsDir string, limit int) {
+	entries, err := os.ReadDir(segmentsDir)
+	if err != nil {
+		return
+	}
+	segments := []os.FileInfo{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || strings.HasSuffix(entry.Name(), ".part.mp4") {
+			continue
+		}
+		segments = append(segments, info)
+	}
+	if len(segments) <= limit {
+		return
+	}
+
+	slices.SortFunc(segments, func(a, b os.FileInfo) int { return b.ModTime().Compare(a.ModTime()) })
+	for _, segment := range segments[limit:] {
+		_ = os.Remove(filepath.Join(segmentsDir, segment.Name()))
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k1nho/gahara/internal/video"
+)
+
+// mockPreviewSources: writes the sources of the edited timeline, the segments of the preview are keyed by them
+func mockPreviewSources(t *testing.T, sources []string) {
+	t.Helper()
+	for _, source := range sources {
+		if err := os.WriteFile(source, []byte("source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderPreview(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	mockPreviewSources(t, sources)
+
+	preview, err := app.RenderPreview(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Rendered != 2 || preview.Cached != 0 || preview.Start != 0 || preview.Duration != 10 {
+		t.Errorf("expected both nodes to be rendered, got %+v", preview)
+	}
+	if _, err := os.Stat(preview.Path); err != nil {
+		t.Fatalf("expected the preview in the cache: %s", err.Error())
+	}
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 3 || !strings.Contains(commands[0].String(), "-preset ultrafast") || !strings.Contains(commands[2].String(), "concat") {
+		t.Fatalf("expected the segments to be rendered and joined, got %v", commands)
+	}
+
+	// an unchanged timeline is served from the cache
+	cached, err := app.RenderPreview(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Rendered != 0 || cached.Cached != 2 || cached.Path != preview.Path || len(fake.commands("ffmpeg")) != 3 {
+		t.Errorf("expected the cached preview, got %+v", cached)
+	}
+
+	// only the node that changed is rendered again
+	if _, err := app.RippleTrim(1, video.TRIM_OUT, -1); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := app.RenderPreview(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Rendered != 1 || edited.Cached != 1 || edited.Path == preview.Path {
+		t.Errorf("expected the trimmed node to be rendered again, got %+v", edited)
+	}
+	if _, err := os.Stat(preview.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the previous preview to be removed")
+	}
+}
+
+func TestRenderPreviewRange(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	mockPreviewSources(t, sources)
+
+	// talk is the second node, it starts at 4s in the timeline
+	preview, err := app.RenderPreview(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Rendered != 1 || preview.Start != 4 || preview.Duration != 6 {
+		t.Errorf("expected the preview of talk, got %+v", preview)
+	}
+	if _, err := app.RenderPreview(20, 30); err == nil {
+		t.Errorf("expected an error for a range past the end of the timeline")
+	}
+}
+
+func TestRenderPreviewTransitionsAndTracks(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	mockPreviewSources(t, sources)
+	if _, err := app.SetTransition(0, video.TRANSITION_CROSSFADE, 1); err != nil {
+		t.Fatal(err)
+	}
+	track, err := app.AddTrack(video.TRACK_VIDEO, "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.InsertTrackInterval(track.ID, sources[0], "logo", 0, 2, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	// the crossfade moves talk 1s earlier, its window starts with the transition
+	preview, err := app.RenderPreview(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Rendered != 1 || preview.Start != 3 || preview.Duration != 6 {
+		t.Errorf("expected the preview of talk from the crossfade, got %+v", preview)
+	}
+	segment := fake.commands("ffmpeg")[0].String()
+	if !strings.Contains(segment, "xfade") || !strings.Contains(segment, "overlay") {
+		t.Errorf("expected the transition and the overlay in the segment, got %s", segment)
+	}
+
+	// a new track changes the window, it is rendered again
+	if _, err := app.AddTrack(video.TRACK_AUDIO, "music"); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := app.RenderPreview(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Rendered != 1 {
+		t.Errorf("expected the window to be rendered with the new track, got %+v", cached)
+	}
+}
+
+func TestRenderPreviewFailure(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	mockPreviewSources(t, sources)
+	fake.on("ffmpeg", sources[1], "-g").withStderr("talk.mov: Invalid data found when processing input").withExitCode(1)
+
+	if _, err := app.RenderPreview(0, 0); err == nil || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Fatalf("expected the render of talk to fail, got %v", err)
+	}
+	// the failed segment is not cached, the rendered one is
+	segments, err := os.ReadDir(filepath.Join(app.config.ProjectDir, PREVIEW_DIR, "segments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || strings.Contains(segments[0].Name(), ".part") {
+		t.Errorf("expected only the segment of intro in the cache, got %v", segments)
+	}
+}
+
+func TestPrunePreviewSegments(t *testing.T) {
+	segmentsDir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"oldest.mp4", "old.mp4", "recent.mp4", "rendering.part.mp4"} {
+		segment := filepath.Join(segmentsDir, name)
+		if err := os.WriteFile(segment, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		usedAt := now.Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(segment, usedAt, usedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prunePreviewSegments(segmentsDir, 2)
+	kept := []string{}
+	entries, err := os.ReadDir(segmentsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+	if strings.Join(kept, ",") != "old.mp4,recent.mp4,rendering.part.mp4" {
+		t.Errorf("expected the least recently used segment to be removed, got %v", kept)
+	}
+}
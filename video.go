@@ -1,21 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/k1nho/gahara/ffmpegbuilder"
+	"github.com/k1nho/gahara/internal/probe"
+	"github.com/k1nho/gahara/internal/progress"
+	"github.com/k1nho/gahara/internal/storage"
 	"github.com/k1nho/gahara/internal/video"
 	wruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -47,6 +48,25 @@ type VideoProcessingResult struct {
 
 type MonitoringOpts struct {
 	terms map[string]bool
+	// pass, passes: the pass of a multi-pass encoding being monitored, the progress spans all the passes
+	pass, passes int
+	// jobID: the job of the monitored query, its progress is emitted with the id
+	jobID string
+	// duration: the duration expected of the output in seconds, the percent and eta are unknown if it is not positive
+	duration float64
+}
+
+// EncodingProgress: the progress of a job, emitted with EVT_ENCODING_PROGRESS
+type EncodingProgress struct {
+	// JobID: the id of the job
+	JobID string `json:"job_id"`
+	// Pass, Passes: the pass encoded of a multi-pass encoding (1 of 1 otherwise)
+	Pass   int `json:"pass"`
+	Passes int `json:"passes"`
+	// Estimate: the percent and eta of the job, across all its passes
+	progress.Estimate
+	// Report: the last progress reported by ffmpeg
+	Report progress.Report `json:"report"`
 }
 
 func NewVideo(name string, extension string, filepath string, duration float64) *Video {
@@ -65,10 +85,24 @@ func NewMonitoringOpts(observeParams ...string) *MonitoringOpts {
 		terms[word] = true
 	}
 	return &MonitoringOpts{
-		terms: terms,
+		terms:  terms,
+		pass:   1,
+		passes: 1,
 	}
 }
 
+// forJob: sets the job monitored, and the duration expected of its output in seconds
+func (m *MonitoringOpts) forJob(jobID string, duration float64) *MonitoringOpts {
+	m.jobID, m.duration = jobID, duration
+	return m
+}
+
+// withPass: sets the pass of a multi-pass encoding monitored (1 is the first pass)
+func (m *MonitoringOpts) withPass(pass, passes int) *MonitoringOpts {
+	m.pass, m.passes = pass, passes
+	return m
+}
+
 func NewVideoProcessingResult(id string, name string, status string, msg string) *VideoProcessingResult {
 	if id == "" {
 		id = strings.Replace(uuid.New().String(), "-", "", -1)
@@ -85,21 +119,28 @@ func NewVideoProcessingResult(id string, name string, status string, msg string)
 // createProxyFile: creates the proxy file to be used for editing (preserve original media)
 func (a *App) createProxyFile(inputFilePath string) {
 	if inputFilePath == "" {
-		wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, "no file selected")
+		a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, "no file selected")
 		return
 	}
 
 	fileName := video.GetFilename(inputFilePath)
 	name, ext, err := video.GetNameAndExtension(fileName)
 	if err != nil {
-		wruntime.LogError(a.ctx, "invalid file format")
-		wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, "invalid file format")
+		a.notifier.LogError("invalid file format")
+		a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, "invalid file format")
 		return
 	}
 
 	if !video.IsValidExtension("." + ext) {
-		wruntime.LogError(a.ctx, "invalid file extension")
-		wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, "invalid file extension")
+		a.notifier.LogError("invalid file extension")
+		a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, "invalid file extension")
+		return
+	}
+
+	info, err := a.probeMedia(inputFilePath)
+	if err != nil || !info.HasVideo() {
+		a.notifier.LogError(fmt.Sprintf("%s is not a valid video file", inputFilePath))
+		a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("%s is not a valid video file", fileName))
 		return
 	}
 
@@ -109,13 +150,8 @@ func (a *App) createProxyFile(inputFilePath string) {
 	// check that a proxy has not already been created for the file
 	_, err = os.Stat(pathProxyFile)
 	if os.IsNotExist(err) {
-		pfile := NewVideo(name, filepath.Ext(proxyFile), a.config.ProjectDir, 0)
-
-		cancelDurationListener := wruntime.EventsOnce(a.ctx, video.EVT_DURATION_EXTRACTED, func(duration ...interface{}) {
-			pfile.Duration = duration[0].(float64)
-			wruntime.EventsEmit(a.ctx, video.EVT_PROXY_FILE_CREATED, pfile)
-		})
-		defer cancelDurationListener()
+		// the streams are copied to the proxy, so it has the duration of the input
+		pfile := NewVideo(name, filepath.Ext(proxyFile), a.config.ProjectDir, info.Duration())
 
 		err := a.FFmpegQuery(video.QUERY_CREATE_PROXY_FILE, video.ProcessingOpts{
 			Filename:    name,
@@ -124,21 +160,22 @@ func (a *App) createProxyFile(inputFilePath string) {
 			OutputPath:  a.config.ProjectDir,
 		})
 		if err != nil {
-			wruntime.LogError(a.ctx, fmt.Sprintf("could not create the proxy file for %s: %s", inputFilePath, err.Error()))
-			wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("failed to import %s", fileName))
+			a.notifier.LogError(fmt.Sprintf("could not create the proxy file for %s: %s", inputFilePath, err.Error()))
+			a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("failed to import %s", fileName))
 			return
 		}
 
-		wruntime.LogInfo(a.ctx, fmt.Sprintf("proxy file created: %s", fileName))
+		a.notifier.EventsEmit(video.EVT_PROXY_FILE_CREATED, pfile)
+		a.notifier.LogInfo(fmt.Sprintf("proxy file created: %s", fileName))
 		return
 	} else if err != nil {
-		wruntime.LogError(a.ctx, fmt.Sprintf("file finding error: %s", err.Error()))
-		wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("failed to import %s", fileName))
+		a.notifier.LogError(fmt.Sprintf("file finding error: %s", err.Error()))
+		a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("failed to import %s", fileName))
 		return
 	}
 
-	wruntime.LogInfo(a.ctx, fmt.Sprintf("proxy file found: %s", fileName))
-	wruntime.EventsEmit(a.ctx, video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("file is already in project %s", fileName))
+	a.notifier.LogInfo(fmt.Sprintf("proxy file found: %s", fileName))
+	a.notifier.EventsEmit(video.EVT_PROXY_ERROR_MSG, fmt.Sprintf("file is already in project %s", fileName))
 
 }
 
@@ -157,7 +194,7 @@ func (a *App) GenerateThumbnail(inputFilePath string) error {
 	thumbnailPath := fmt.Sprintf("%s/%s.png", a.config.ProjectDir, filename)
 	_, err = os.Stat(thumbnailPath)
 	if err == nil {
-		wruntime.LogInfo(a.ctx, fmt.Sprintf("thumbnail of video %s already exists", filename))
+		a.notifier.LogInfo(fmt.Sprintf("thumbnail of video %s already exists", filename))
 		return nil
 	}
 
@@ -165,11 +202,11 @@ func (a *App) GenerateThumbnail(inputFilePath string) error {
 	err = cmd.Run()
 	if err != nil {
 		errMsg := fmt.Sprintf("could not generate the thumbnail for file %s: %s", filename, err.Error())
-		wruntime.LogError(a.ctx, errMsg)
+		a.notifier.LogError(errMsg)
 		return fmt.Errorf(errMsg)
 	}
 
-	wruntime.LogInfo(a.ctx, fmt.Sprintf("thumbnail for video: %s has been created", filename))
+	a.notifier.LogInfo(fmt.Sprintf("thumbnail for video: %s has been created", filename))
 	return nil
 }
 
@@ -195,14 +232,14 @@ func (a *App) GetProjectThumbnail(projectName string) (string, error) {
 	thumbnailDir := path.Join(a.config.GaharaDir, projectName)
 	projectDir, err := os.Open(thumbnailDir)
 	if err != nil {
-		wruntime.LogError(a.ctx, "directory does not exists for the project")
+		a.notifier.LogError("directory does not exists for the project")
 		return "", err
 	}
 	defer projectDir.Close()
 
 	files, err := projectDir.ReadDir(0)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the files of the project")
+		a.notifier.LogError("could not read the files of the project")
 		return "", err
 	}
 
@@ -227,30 +264,39 @@ func (a *App) SaveProjectFiles(projectFiles []Video) error {
 		return err
 	}
 
-	err = os.WriteFile(path.Join(a.config.ProjectDir, "metadata.json"), data, 0644)
+	err = storage.WriteFile(path.Join(a.config.ProjectDir, "metadata.json"), data, 0644, PROJECT_BACKUPS)
 	if err != nil {
 		return err
 	}
 
-	wruntime.LogInfo(a.ctx, "project files have been saved")
+	a.notifier.LogInfo("project files have been saved")
 	return nil
 }
 
 // SaveTimeline: save project timeline into the project filesystem
 func (a *App) SaveTimeline() error {
-	if a.Timeline.VideoNodes == nil && len(a.Timeline.VideoNodes) <= 0 {
+	// the timeline is read once the autosave is done, an older timeline never replaces its autosave
+	a.saveLock.Lock()
+	defer a.saveLock.Unlock()
+
+	timeline := a.snapshotTimeline()
+	if timeline.VideoNodes == nil && len(timeline.VideoNodes) <= 0 {
 		return fmt.Errorf("timeline is empty, could not save timeline")
 	}
-	data, err := json.MarshalIndent(a.Timeline, "", "  ")
+	data, err := video.MarshalTimeline(timeline)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(path.Join(a.config.ProjectDir, "timeline.json"), data, 0644)
+	err = storage.WriteFile(path.Join(a.config.ProjectDir, "timeline.json"), data, 0644, PROJECT_BACKUPS)
 	if err != nil {
 		return err
 	}
-	wruntime.LogInfo(a.ctx, fmt.Sprintf("%s: timeline has been saved", time.Now().String()))
+	a.lastSaved = data
+	// the saved timeline is newer than the autosave
+	_ = os.Remove(path.Join(a.config.ProjectDir, AUTOSAVE_FILE))
+
+	a.notifier.LogInfo(fmt.Sprintf("%s: timeline has been saved", time.Now().String()))
 	return nil
 }
 
@@ -264,23 +310,52 @@ func (a *App) LoadTimeline() (video.Timeline, error) {
 
 	bytes, err := os.ReadFile(timelinePath)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the timeline file")
+		a.notifier.LogError("could not read the timeline file")
 		return timeline, fmt.Errorf("could not read timeline file")
 	}
 
-	err = json.Unmarshal(bytes, &a.Timeline)
+	loaded, err := video.UnmarshalTimeline(bytes)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not unmarshal the timeline")
+		a.notifier.LogError(fmt.Sprintf("could not load the timeline: %s", err.Error()))
 		return timeline, err
 	}
 
+	// timelines saved before frame accurate intervals are conformed to the frame rate of their media, the media
+	// is probed before the timeline is locked so that the timeline can be read meanwhile
+	rates := map[string]video.Rational{}
+	for _, rid := range loaded.LegacyRIDs() {
+		if _, ok := loaded.FrameRates[rid]; !ok {
+			rates[rid] = a.probeFrameRate(rid)
+		}
+	}
+
+	a.timelineLock.Lock()
+	a.Timeline = loaded
+
 	if len(a.Timeline.VideoNodes) == 0 {
-		wruntime.LogInfo(a.ctx, "empty timeline")
+		a.timelineLock.Unlock()
+		a.notifier.LogInfo("empty timeline")
 		return timeline, fmt.Errorf("empty timeline")
 	}
 
-	wruntime.LogInfo(a.ctx, "timeline has been loaded!")
-	return a.GetTimeline(), nil
+	for rid, rate := range rates {
+		if err := a.Timeline.SetFrameRate(rid, rate); err != nil {
+			a.notifier.LogError(err.Error())
+		}
+	}
+	a.Timeline.ConformLegacyNodes()
+	timeline = a.Timeline.Clone()
+	a.timelineLock.Unlock()
+
+	// the loaded timeline is not autosaved until it changes
+	if data, err := video.MarshalTimeline(timeline); err == nil {
+		a.saveLock.Lock()
+		a.lastSaved = data
+		a.saveLock.Unlock()
+	}
+
+	a.notifier.LogInfo("timeline has been loaded!")
+	return timeline, nil
 }
 
 // LoadTimeline: retrieves saved project files, if any, from filesystem
@@ -293,83 +368,319 @@ func (a *App) LoadProjectFiles() ([]Video, error) {
 
 	bytes, err := os.ReadFile(metadataPath)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not read the video files metadata file")
+		a.notifier.LogError("could not read the video files metadata file")
 		return videoFiles, fmt.Errorf("could not read timeline file")
 	}
 
 	err = json.Unmarshal(bytes, &videoFiles)
 	if err != nil {
-		wruntime.LogError(a.ctx, "could not unmarshal the files")
+		a.notifier.LogError("could not unmarshal the files")
 		return videoFiles, err
 	}
 
 	if len(videoFiles) == 0 {
-		wruntime.LogInfo(a.ctx, "empty video files")
+		a.notifier.LogInfo("empty video files")
 		return videoFiles, fmt.Errorf("empty video files")
 	}
 
-	wruntime.LogInfo(a.ctx, "video files loaded")
+	a.notifier.LogInfo("video files loaded")
 	return videoFiles, nil
 
 }
 
+// loadFrameRate: registers the frame rate of the source media of a root id in the timeline, if unknown. The
+// timeline lock is held by the caller
+func (a *App) loadFrameRate(rid string) {
+	if _, ok := a.Timeline.FrameRates[rid]; ok {
+		return
+	}
+
+	if err := a.Timeline.SetFrameRate(rid, a.probeFrameRate(rid)); err != nil {
+		a.notifier.LogError(err.Error())
+	}
+}
+
+// probeFrameRate: probes the frame rate of the source media of a root id, the default frame rate if it cannot be read
+func (a *App) probeFrameRate(rid string) video.Rational {
+	rate, err := a.getFrameRate(rid)
+	if err != nil {
+		a.notifier.LogError(fmt.Sprintf("could not read the frame rate, using %s: %s", video.DefaultFrameRate().String(), err.Error()))
+		return video.DefaultFrameRate()
+	}
+	return rate
+}
+
+// loadSourceDuration: registers the duration of the source media of a root id in the timeline, if unknown. The
+// timeline lock is held by the caller
+func (a *App) loadSourceDuration(rid string) error {
+	if _, ok := a.Timeline.SourceDurations[rid]; ok {
+		return nil
+	}
+
+	info, err := a.probeMedia(rid)
+	if err != nil {
+		return fmt.Errorf("could not read the duration of %s: %s", rid, err.Error())
+	}
+	return a.Timeline.SetSourceDuration(rid, info.Duration())
+}
+
+/*
+loadSourceDurations: registers the duration of the source media of the main track nodes in [from, to]. A trim
+is bounded by the duration of its sources, so it fails if one of them is unknown
+*/
+func (a *App) loadSourceDurations(from, to int) error {
+	for i := from; i <= to; i++ {
+		if i >= 0 && i < len(a.Timeline.VideoNodes) {
+			if err := a.loadSourceDuration(a.Timeline.VideoNodes[i].RID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProbeMedia: returns the description of the media of a root id (format, streams, codecs)
+func (a *App) ProbeMedia(rid string) (probe.MediaInfo, error) {
+	return a.probeMedia(rid)
+}
+
 // GetTimeline: returns the video timeline which is composed of video nodes
 func (a *App) GetTimeline() video.Timeline {
-	return a.Timeline
+	return a.snapshotTimeline()
+}
+
+// snapshotTimeline: returns a copy of the timeline, it is read without the lock while the timeline is edited
+func (a *App) snapshotTimeline() video.Timeline {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.Clone()
 }
 
 // InsertInterval: inserts a video node with some interval [a,b]
 func (a *App) InsertInterval(rid string, name string, start, end float64, pos int) (video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	a.loadFrameRate(rid)
 	return a.Timeline.Insert(rid, name, start, end, pos)
 }
 
 // RemoveInterval: removes a video node with some interval [a,b]
 func (a *App) RemoveInterval(pos int) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.Delete(pos)
 }
 
 // SplitInterval: splits a video node with some interval [a,b].
 func (a *App) SplitInterval(eventType string, pos int, start, end float64) ([]video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.Split(eventType, pos, start, end)
 }
 
 // DeleteRIDReferences: removes all timeline references of a root id
 func (a *App) DeleteRIDReferences(rid string) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.DeleteRIDReferences(rid)
 }
 
 func (a *App) RenameVideoNode(pos int, name string) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.RenameVideoNode(pos, name)
 }
 
 func (a *App) ToggleLossless(pos int) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.ToggleLossless(pos)
 }
 
 func (a *App) MarkAllLossless() error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.MarkAllLossless()
 }
 
 func (a *App) UnmarkAllLossless() error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	return a.Timeline.UnmarkAllLossless()
 }
 
+// AddTrack: adds a video or audio track to the timeline
+func (a *App) AddTrack(trackType string, name string) (video.Track, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.AddTrack(trackType, name)
+}
+
+// RemoveTrack: removes a track, and all of its video nodes, from the timeline
+func (a *App) RemoveTrack(trackID string) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.RemoveTrack(trackID)
+}
+
+// MoveTrack: reorders a track among the tracks of its type
+func (a *App) MoveTrack(trackID string, idx int) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.MoveTrack(trackID, idx)
+}
+
+// InsertTrackInterval: inserts a video node with some interval [a,b] at a position (seconds) of a track
+func (a *App) InsertTrackInterval(trackID string, rid string, name string, start, end, position float64) (video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	a.loadFrameRate(rid)
+	return a.Timeline.InsertTrackNode(trackID, rid, name, start, end, position)
+}
+
+// RemoveTrackInterval: removes a video node of a track
+func (a *App) RemoveTrackInterval(trackID string, pos int) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.DeleteTrackNode(trackID, pos)
+}
+
+// SplitTrackInterval: splits a video node of a track with some interval [a,b]
+func (a *App) SplitTrackInterval(trackID string, eventType string, pos int, start, end float64) ([]video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.SplitTrackNode(trackID, eventType, pos, start, end)
+}
+
+// SetTransition: sets a transition between the clip at pos and the next clip of the main track
+func (a *App) SetTransition(pos int, transitionType string, duration float64) (video.Transition, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.SetTransition(pos, transitionType, duration)
+}
+
+// RemoveTransition: removes the transition between the clip at pos and the next clip of the main track
+func (a *App) RemoveTransition(pos int) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.RemoveTransition(pos)
+}
+
+// RippleTrim: moves the in or out point of the clip at pos, the following clips shift with it
+func (a *App) RippleTrim(pos int, edge string, delta float64) (video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	if err := a.loadSourceDurations(pos, pos); err != nil {
+		return video.VideoNode{}, err
+	}
+	return a.Timeline.RippleTrim(pos, edge, delta)
+}
+
+// RollTrim: moves the edit point between the clip at pos and the next clip
+func (a *App) RollTrim(pos int, delta float64) ([]video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	if err := a.loadSourceDurations(pos, pos+1); err != nil {
+		return nil, err
+	}
+	return a.Timeline.RollTrim(pos, delta)
+}
+
+// SlipTrim: moves the source window of the clip at pos, keeping its length
+func (a *App) SlipTrim(pos int, delta float64) (video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	if err := a.loadSourceDurations(pos, pos); err != nil {
+		return video.VideoNode{}, err
+	}
+	return a.Timeline.SlipTrim(pos, delta)
+}
+
+// SlideTrim: moves the clip at pos between its neighbours, keeping its source window
+func (a *App) SlideTrim(pos int, delta float64) ([]video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	if err := a.loadSourceDurations(pos-1, pos+1); err != nil {
+		return nil, err
+	}
+	return a.Timeline.SlideTrim(pos, delta)
+}
+
+// SetClipSpeed: changes the playback speed of the clip at pos of a track (main for the main track)
+func (a *App) SetClipSpeed(trackID string, pos int, speed float64) (video.VideoNode, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.SetSpeed(trackID, pos, speed)
+}
+
+// AddMarker: places a named marker at a position (seconds) of the timeline
+func (a *App) AddMarker(name string, color string, position float64) (video.Marker, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.AddMarker(name, color, position)
+}
+
+// MoveMarker: changes the position (seconds) of a marker
+func (a *App) MoveMarker(markerID string, position float64) (video.Marker, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.MoveMarker(markerID, position)
+}
+
+// RemoveMarker: deletes a marker from the timeline
+func (a *App) RemoveMarker(markerID string) error {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.RemoveMarker(markerID)
+}
+
+// ListMarkers: returns the markers of the timeline ordered by their position
+func (a *App) ListMarkers() []video.Marker {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	return a.Timeline.ListMarkers()
+}
+
+// Undo: reverts the last edit made to the timeline
+func (a *App) Undo() (video.Timeline, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	cmd, err := a.Timeline.Undo()
+	if err != nil {
+		return a.Timeline.Clone(), err
+	}
+	a.notifier.LogInfo(fmt.Sprintf("undo: %s", cmd.Op))
+	return a.Timeline.Clone(), nil
+}
+
+// Redo: performs again the last edit that was undone
+func (a *App) Redo() (video.Timeline, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
+	cmd, err := a.Timeline.Redo()
+	if err != nil {
+		return a.Timeline.Clone(), err
+	}
+	a.notifier.LogInfo(fmt.Sprintf("redo: %s", cmd.Op))
+	return a.Timeline.Clone(), nil
+}
+
 // ResetTimeline: cleanup timeline state in memory
 func (a *App) ResetTimeline() {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	a.Timeline = video.NewTimeline()
 }
 
 // GetTrackDuration: retrieves the total video duration of a track
 func (a *App) GetTrackDuration() (float64, error) {
+	a.timelineLock.Lock()
+	defer a.timelineLock.Unlock()
 	if a.Timeline.VideoNodes == nil {
 		return 0, fmt.Errorf("no timeline exists")
 	}
 
-	duration := 0.0
-	for _, videoNode := range a.Timeline.VideoNodes {
-		duration += videoNode.End - videoNode.Start
-	}
-	return duration, nil
+	return a.Timeline.Duration(), nil
 }
 
 // GetOutputFileSavePath: retrieves the output path where the resulting video should be saved
@@ -394,7 +705,19 @@ func (a *App) GetOutputFileSavePath() (string, error) {
 
 // FFmpegQuery: produces an asset (video, image) with FFmpeg given a query type, and processing opts
 func (a *App) FFmpegQuery(queryType string, userOpts video.ProcessingOpts) error {
-	defer wruntime.EventsEmit(a.ctx, video.EVT_FFMPEG_EXEC_ENDED)
+	return a.ffmpegQuery(queryType, userOpts, a.snapshotTimeline())
+}
+
+// ffmpegQuery: runs a query type on a snapshot of the timeline, the snapshot is recorded with the job in the history
+func (a *App) ffmpegQuery(queryType string, userOpts video.ProcessingOpts, timeline video.Timeline) (err error) {
+	defer a.notifier.EventsEmit(video.EVT_FFMPEG_EXEC_ENDED)
+	defer func() {
+		// the frontend highlights the fields of the violations
+		var verr *video.ValidationError
+		if errors.As(err, &verr) {
+			a.notifier.EventsEmit(video.EVT_VALIDATION_FAILED, verr.Violations)
+		}
+	}()
 
 	if userOpts.InputPath == "" {
 		userOpts.InputPath = a.config.ProjectDir
@@ -403,91 +726,320 @@ func (a *App) FFmpegQuery(queryType string, userOpts video.ProcessingOpts) error
 		return err
 	}
 
+	job := a.jobs.Start(queryType, userOpts.Filename+userOpts.VideoFormat)
+	defer a.jobs.End(job)
+	// the job is recorded in the history of the project it was started in, once its outcome is known
+	projectDir := a.config.ProjectDir
+	defer func() {
+		if herr := a.recordJob(projectDir, job, userOpts, timeline, err); herr != nil {
+			a.notifier.LogError(fmt.Sprintf("could not record the job %s: %s", job.ID, herr.Error()))
+		}
+	}()
+	defer func() {
+		// a job cancelled once its queries have ended is not reported as cancelled
+		if err != nil && job.Cancelled() {
+			err = ErrJobCancelled
+			a.notifier.EventsEmit(video.EVT_FFMPEG_RESULT, NewVideoProcessingResult(job.ID, job.Name, Cancelled, "the job was cancelled"))
+		}
+	}()
+	a.notifier.EventsEmit(video.EVT_JOB_STARTED, job)
+
 	switch queryType {
 	case video.QUERY_FILTERGRAPH:
-		if err := a.queryFiltergraph(userOpts); err != nil {
+		if err := a.queryFiltergraph(job, userOpts, timeline); err != nil {
 			return err
 		}
 	case video.QUERY_LOSSLESS_CUT:
-		if err := a.queryLosslessCut(userOpts); err != nil {
+		if err := a.queryLosslessCut(job, userOpts, timeline); err != nil {
+			return err
+		}
+	case video.QUERY_LOSSLESS_MERGE:
+		if err := a.queryLosslessMerge(job, userOpts, timeline); err != nil {
+			return err
+		}
+	case video.QUERY_SMART_RENDER:
+		if err := a.querySmartRender(job, userOpts, timeline); err != nil {
 			return err
 		}
 	case video.QUERY_CREATE_PROXY_FILE:
-		if err := a.queryCreateProxyFile(userOpts); err != nil {
+		if err := a.queryCreateProxyFile(job, userOpts); err != nil {
 			return err
 		}
 	case video.QUERY_CREATE_THUMBNAIL:
-		if err := a.queryCreateThumbnail(userOpts); err != nil {
+		if err := a.queryCreateThumbnail(job, userOpts); err != nil {
 			return err
 		}
 	default:
-		return fmt.Errorf("invalid query type (q_filtergraph, q_create_proxy_file, q_create_thumbnail, q_lossless_cut)")
+		return fmt.Errorf("invalid query type (q_filtergraph, q_create_proxy_file, q_create_thumbnail, q_lossless_cut, q_lossless_merge, q_smart_render)")
 	}
 	return nil
 }
 
-// queryFiltergraph: executes a filtergraph query, currently merge clips
-func (a *App) queryFiltergraph(userOpts video.ProcessingOpts) error {
-	query, err := ffmpegbuilder.MergeClipsQuery(a.FFmpegPath, a.Timeline.VideoNodes, userOpts)
+// ValidateProcessingOpts: returns the violations of the options of a query type, empty if they are valid
+func (a *App) ValidateProcessingOpts(queryType string, userOpts video.ProcessingOpts) []video.FieldViolation {
+	if userOpts.InputPath == "" {
+		userOpts.InputPath = a.config.ProjectDir
+	}
+	var verr *video.ValidationError
+	if err := userOpts.ValidateRequiredFields(queryType); errors.As(err, &verr) {
+		return verr.Violations
+	}
+	return []video.FieldViolation{}
+}
+
+// queryFiltergraph: executes a filtergraph query, merges the clips of the timeline tracks
+func (a *App) queryFiltergraph(job *Job, userOpts video.ProcessingOpts, timeline video.Timeline) error {
+	infos, err := a.probeTimelineInputs(timeline)
 	if err != nil {
 		return err
 	}
-	err = a.executeFFmpegQuery(query, NewMonitoringOpts(video.OBV_OUT_TIME_US))
+	silentInputs := getSilentInputs(infos)
+
+	chaptersPath := ""
+	if userOpts.Chapters {
+		metadata, err := ffmpegbuilder.ChaptersMetadata(timeline)
+		if err != nil {
+			return err
+		}
+		// the exports of a project run concurrently, each one writes its own chapters file
+		chaptersFile, err := os.CreateTemp(a.config.ProjectDir, ".chapters-*.txt")
+		if err != nil {
+			return fmt.Errorf("could not create the chapters file: %s", err.Error())
+		}
+		chaptersPath = chaptersFile.Name()
+		defer os.Remove(chaptersPath)
+		_, err = chaptersFile.WriteString(metadata)
+		if closeErr := chaptersFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("could not write the chapters file: %s", err.Error())
+		}
+	}
+
+	// the statistics of the first pass of a two-pass encoding
+	passLogFile := path.Join(a.config.ProjectDir, fmt.Sprintf(".passlog-%s", strings.Replace(uuid.New().String(), "-", "", -1)))
+	defer removePassLogs(passLogFile)
+
+	queries, err := ffmpegbuilder.MergeTimelinePasses(a.FFmpegPath, timeline, userOpts, chaptersPath, passLogFile, silentInputs...)
 	if err != nil {
 		return err
 	}
+	for i, query := range queries {
+		if len(queries) > 1 {
+			a.notifier.EventsEmit(video.EVT_EXPORT_MSG, fmt.Sprintf("Encoding pass %d of %d", i+1, len(queries)))
+		}
+		err = a.executeFFmpegQuery(job, query, NewMonitoringOpts(video.OBV_OUT_TIME_US).forJob(job.ID, timeline.Duration()).withPass(i+1, len(queries)))
+		if err != nil {
+			return err
+		}
+	}
 
-	wruntime.EventsEmit(a.ctx, video.EVT_FFMPEG_RESULT, NewVideoProcessingResult("", userOpts.Filename, Success, ffmpegbuilder.GetFullOutputPath(userOpts)))
-	wruntime.EventsEmit(a.ctx, video.EVT_EXPORT_MSG, fmt.Sprintf("Finished exporting %s%s", userOpts.Filename, userOpts.VideoFormat))
+	a.notifier.EventsEmit(video.EVT_FFMPEG_RESULT, NewVideoProcessingResult(job.ID, userOpts.Filename, Success, ffmpegbuilder.GetFullOutputPath(userOpts)))
+	a.notifier.EventsEmit(video.EVT_EXPORT_MSG, fmt.Sprintf("Finished exporting %s%s", userOpts.Filename, userOpts.VideoFormat))
 	return nil
 }
 
-// queryLosslessCut: executes LosslessCut for a batch of video nodes
-func (a *App) queryLosslessCut(userOpts video.ProcessingOpts) error {
-	var (
-		wg         = new(sync.WaitGroup)
-		msgChannel = make(chan VideoProcessingResult)
-	)
+// removePassLogs: removes the statistics written by the passes of a two-pass encoding
+func removePassLogs(passLogFile string) {
+	logs, err := filepath.Glob(passLogFile + "*")
+	if err != nil {
+		return
+	}
+	for _, log := range logs {
+		_ = os.Remove(log)
+	}
+}
+
+// queryLosslessCut: executes LosslessCut for the video nodes marked as lossless, at most exportConcurrency at a
+// time. The results are emitted in the order of the nodes, followed by the summary of the batch
+func (a *App) queryLosslessCut(job *Job, userOpts video.ProcessingOpts, timeline video.Timeline) error {
+	videoNodes := []video.VideoNode{}
+	for _, videoNode := range timeline.VideoNodes {
+		if videoNode.LosslessExport {
+			videoNodes = append(videoNodes, videoNode)
+		}
+	}
 
-	go func() {
-		defer close(msgChannel)
-		for msg := range msgChannel {
-			wruntime.EventsEmit(a.ctx, video.EVT_FFMPEG_RESULT, msg)
+	filenames := losslessCutFilenames(videoNodes)
+	summary := BatchSummary{JobID: job.ID, Total: len(videoNodes)}
+	cut := func(i int) VideoProcessingResult {
+		vNode := videoNodes[i]
+		// every node has its own copy of the options
+		opts := userOpts
+		opts.Filename = filenames[i]
+		query, err := ffmpegbuilder.LosslessSegmentQuery(a.FFmpegPath, vNode, ffmpegbuilder.GetFullOutputPath(opts))
+		if err != nil {
+			return VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Failed, Message: err.Error()}
 		}
-	}()
+		err = a.executeFFmpegQuery(job, query, nil)
+		if err != nil && job.Cancelled() {
+			return VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Cancelled}
+		} else if err != nil {
+			return VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Failed, Message: err.Error()}
+		}
+		return VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Success, Message: ffmpegbuilder.GetFullOutputPath(opts)}
+	}
+	report := func(i int, result VideoProcessingResult) {
+		switch result.Status {
+		case Success:
+			summary.Succeeded++
+		case Failed:
+			summary.Failed++
+		case Cancelled:
+			// the cancellation is reported for the whole job
+			summary.Cancelled++
+			return
+		}
+		a.notifier.EventsEmit(video.EVT_FFMPEG_RESULT, result)
+	}
+
+	runBatch(job.ctx, len(videoNodes), a.exportConcurrency(), cut, report)
+	a.notifier.EventsEmit(video.EVT_BATCH_SUMMARY, summary)
+	if summary.Cancelled > 0 {
+		return ErrJobCancelled
+	}
+	return nil
+}
+
+/*
+losslessCutFilenames: the output filename of each node of a lossless cut. The nodes are named after their clip, the
+nodes sharing a name (e.g. the halves of a split clip) are suffixed with their position among them so that no two
+workers write to the same file
+*/
+func losslessCutFilenames(videoNodes []video.VideoNode) []string {
+	// the names of the clips are kept for their first node, the suffixed names never take one of them
+	names := map[string]bool{}
+	for _, videoNode := range videoNodes {
+		names[strings.ToLower(videoNode.Name)] = true
+	}
+
+	taken := map[string]bool{}
+	filenames := make([]string, len(videoNodes))
+	for i, videoNode := range videoNodes {
+		filename := videoNode.Name
+		for n := 2; taken[strings.ToLower(filename)] || (filename != videoNode.Name && names[strings.ToLower(filename)]); n++ {
+			filename = fmt.Sprintf("%s-%d", videoNode.Name, n)
+		}
+		taken[strings.ToLower(filename)] = true
+		filenames[i] = filename
+	}
+	return filenames
+}
+
+// LosslessPreflight: checks if the timeline can be exported losslessly as a single file, reports the nodes that block it
+func (a *App) LosslessPreflight() ffmpegbuilder.LosslessReport {
+	timeline := a.snapshotTimeline()
+	return ffmpegbuilder.LosslessPreflight(timeline, a.probeSources(timeline.VideoNodes))
+}
 
-	for _, videoNode := range a.Timeline.VideoNodes {
-		if !videoNode.LosslessExport {
+// probeSources: probes the sources of video nodes, the sources that cannot be probed are left out
+func (a *App) probeSources(videoNodes []video.VideoNode) map[string]probe.MediaInfo {
+	infos := map[string]probe.MediaInfo{}
+	for _, videoNode := range videoNodes {
+		if _, ok := infos[videoNode.RID]; ok {
+			continue
+		}
+		info, err := a.probeMedia(videoNode.RID)
+		if err != nil {
+			a.notifier.LogError(err.Error())
 			continue
 		}
-		wg.Add(1)
-		go func(vNode video.VideoNode) {
-			defer wg.Done()
-			userOpts.Filename = vNode.Name
-			query, err := ffmpegbuilder.LosslessCutQuery(a.FFmpegPath, vNode, userOpts)
+		infos[videoNode.RID] = info
+	}
+	return infos
+}
+
+// queryLosslessMerge: exports the main track as a single file without re-encoding. Every node is copied to a
+// temporary segment, and the segments are joined by the concat demuxer
+func (a *App) queryLosslessMerge(job *Job, userOpts video.ProcessingOpts, timeline video.Timeline) error {
+	return a.stitchTimeline(job, userOpts, timeline, false)
+}
+
+// querySmartRender: exports the main track as a single frame accurate file, only the partial GOPs at the edges
+// of the nodes are re-encoded (see ffmpegbuilder.SmartRenderPlan)
+func (a *App) querySmartRender(job *Job, userOpts video.ProcessingOpts, timeline video.Timeline) error {
+	return a.stitchTimeline(job, userOpts, timeline, true)
+}
+
+// stitchTimeline: renders the nodes of the main track to temporary segments, and joins them without re-encoding.
+// The segments are copied, or planned around the keyframes of their source with smart rendering
+func (a *App) stitchTimeline(job *Job, userOpts video.ProcessingOpts, timeline video.Timeline, smart bool) error {
+	infos := a.probeSources(timeline.VideoNodes)
+	if err := ffmpegbuilder.LosslessPreflight(timeline, infos).Error(); err != nil {
+		return err
+	}
+
+	var params ffmpegbuilder.SmartRenderParams
+	if smart {
+		// the preflight checked that all the sources share the codec parameters of the first one
+		var err error
+		params, err = ffmpegbuilder.NewSmartRenderParams(infos[timeline.VideoNodes[0].RID], userOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	segmentsDir, err := os.MkdirTemp(a.config.ProjectDir, ".segments-")
+	if err != nil {
+		return fmt.Errorf("could not create the segments directory: %s", err.Error())
+	}
+	defer os.RemoveAll(segmentsDir)
+
+	segments := []string{}
+	for i, videoNode := range timeline.VideoNodes {
+		plan := []ffmpegbuilder.RenderSegment{{Start: videoNode.Start, End: videoNode.End, Copy: true}}
+		if smart {
+			keyframes, err := a.readKeyframes(videoNode.RID)
 			if err != nil {
-				msgChannel <- VideoProcessingResult{ID: vNode.ID, Status: Failed, Message: err.Error()}
-				return
+				return err
 			}
-			err = a.executeFFmpegQuery(query, nil)
+			plan = ffmpegbuilder.SmartRenderPlan(videoNode, keyframes)
+		}
+
+		for j, renderSegment := range plan {
+			segment := path.Join(segmentsDir, fmt.Sprintf("segment%04d_%d%s", i, j, userOpts.VideoFormat))
+			query, err := ffmpegbuilder.SmartRenderSegmentQuery(a.FFmpegPath, videoNode, renderSegment, params, segment)
 			if err != nil {
-				msgChannel <- VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Failed, Message: err.Error()}
-				return
+				return err
 			}
-			msgChannel <- VideoProcessingResult{ID: vNode.ID, Name: vNode.Name, Status: Success, Message: ffmpegbuilder.GetFullOutputPath(userOpts)}
-		}(videoNode)
+			if err := a.executeFFmpegQuery(job, query, nil); err != nil {
+				return fmt.Errorf("could not render %s: %s", videoNode.Name, err.Error())
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	listPath := path.Join(segmentsDir, "segments.txt")
+	if err := os.WriteFile(listPath, []byte(ffmpegbuilder.ConcatList(segments)), 0644); err != nil {
+		return fmt.Errorf("could not write the segments list: %s", err.Error())
 	}
-	wg.Wait()
+	query, err := ffmpegbuilder.LosslessMergeQuery(a.FFmpegPath, listPath, userOpts)
+	if err != nil {
+		return err
+	}
+	// the segments of the main track are joined, the output lasts as long as the timeline
+	if err := a.executeFFmpegQuery(job, query, NewMonitoringOpts(video.OBV_OUT_TIME_US).forJob(job.ID, timeline.Duration())); err != nil {
+		return err
+	}
+
+	a.notifier.EventsEmit(video.EVT_FFMPEG_RESULT, NewVideoProcessingResult(job.ID, userOpts.Filename, Success, ffmpegbuilder.GetFullOutputPath(userOpts)))
+	a.notifier.EventsEmit(video.EVT_EXPORT_MSG, fmt.Sprintf("Finished exporting %s%s", userOpts.Filename, userOpts.VideoFormat))
 	return nil
 }
 
 // queryCreateProxyFile: executes a conversion query for the given video
-func (a *App) queryCreateProxyFile(userOpts video.ProcessingOpts) error {
+func (a *App) queryCreateProxyFile(job *Job, userOpts video.ProcessingOpts) error {
 	query, err := ffmpegbuilder.CreateProxyFileQuery(a.FFmpegPath, userOpts, ".mov")
 	if err != nil {
 		return err
 	}
-	err = a.executeFFmpegQuery(query, NewMonitoringOpts(video.OBV_OUT_TIME))
+	// the streams are copied, the proxy lasts as long as its input (unknown if it cannot be probed)
+	duration := 0.0
+	if info, err := a.probeMedia(ffmpegbuilder.GetFullInputPath(userOpts)); err == nil {
+		duration = info.Duration()
+	}
+	err = a.executeFFmpegQuery(job, query, NewMonitoringOpts(video.OBV_OUT_TIME, video.OBV_OUT_TIME_US).forJob(job.ID, duration))
 	if err != nil {
 		return err
 	}
@@ -496,13 +1048,13 @@ func (a *App) queryCreateProxyFile(userOpts video.ProcessingOpts) error {
 }
 
 // queryCreateThumbnail: executes a query to generate a thumbnail for a video (picks 1st frame)
-func (a *App) queryCreateThumbnail(userOpts video.ProcessingOpts) error {
+func (a *App) queryCreateThumbnail(job *Job, userOpts video.ProcessingOpts) error {
 	query, err := ffmpegbuilder.CreateThumbnailQuery(a.FFmpegPath, userOpts, ".png")
 	if err != nil {
 		return err
 	}
 
-	err = a.executeFFmpegQuery(query, nil)
+	err = a.executeFFmpegQuery(job, query, nil)
 	if err != nil {
 		return err
 	}
@@ -510,142 +1062,204 @@ func (a *App) queryCreateThumbnail(userOpts video.ProcessingOpts) error {
 	return nil
 }
 
-// executeFFmpegQuery: executes an ffmpeg query
-func (a *App) executeFFmpegQuery(query string, monitoringOpts *MonitoringOpts) error {
-	// TODO: implement windows
-	cmd := exec.Command("bash", "-c", query)
-
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("could not initialize ffmpeg monitoring")
+// executeFFmpegQuery: executes an ffmpeg query of a job, the progress is monitored until the query exits
+func (a *App) executeFFmpegQuery(job *Job, query ffmpegbuilder.Command, monitoringOpts *MonitoringOpts) error {
+	ctx := job.ctx
+	if ctx.Err() != nil {
+		return ErrJobCancelled
 	}
+	a.notifier.LogDebug(query.String())
 
-	err = cmd.Start()
-	if err != nil {
-		return fmt.Errorf("could not initialize video export")
-	}
-	if monitoringOpts != nil {
-		go a.monitorFFmpegOuput(stderrPipe, monitoringOpts)
-	}
+	stderrReader, stderrWriter := io.Pipe()
+	stderr := &stderrTail{}
+	monitored := make(chan struct{})
+	go func() {
+		defer close(monitored)
+		output := io.TeeReader(stderrReader, stderr)
+		if monitoringOpts != nil {
+			a.monitorFFmpegOuput(output, monitoringOpts)
+		}
+		// the output is drained so ffmpeg never blocks on a full pipe
+		_, _ = io.Copy(io.Discard, output)
+	}()
 
-	err = cmd.Wait()
+	err := a.executor.Run(ctx, query, stderrWriter)
+	stderrWriter.Close()
+	<-monitored
+	job.record(query.Outputs, stderr.logs(), err != nil)
+	// a query that ended before the job was cancelled keeps its outputs
+	if err != nil && ctx.Err() != nil {
+		removePartialOutputs(query.Outputs)
+		return ErrJobCancelled
+	}
 	if err != nil {
-		return fmt.Errorf("could not export the video")
+		if line := stderr.lastLine(); line != "" {
+			return fmt.Errorf("could not export the video: %s", line)
+		}
+		return fmt.Errorf("could not export the video: %s", err.Error())
 	}
 	return nil
 }
 
-// monitorFFmpegOuput: monitors ffmpeg query progress
-func (a *App) monitorFFmpegOuput(FFmpegOut io.ReadCloser, monitoringOpts *MonitoringOpts) {
-	wruntime.LogInfo(a.ctx, "monitoring FFmpeg query")
-	total, err := a.GetTrackDuration()
-	if err != nil {
-		return
+// STDERR_TAIL_SIZE: the bytes of the stderr of ffmpeg kept to describe a failed query
+const STDERR_TAIL_SIZE = 4096
+
+// stderrTail: keeps the last bytes written to the stderr of ffmpeg
+type stderrTail struct {
+	tail []byte
+}
+
+func (s *stderrTail) Write(p []byte) (int, error) {
+	s.tail = append(s.tail, p...)
+	if len(s.tail) > STDERR_TAIL_SIZE {
+		s.tail = s.tail[len(s.tail)-STDERR_TAIL_SIZE:]
 	}
-	scanner := bufio.NewScanner(FFmpegOut)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, video.OBV_OUT_TIME_US) && monitoringOpts.terms[video.OBV_OUT_TIME_US] {
-			args := strings.Split(line, "=")
-			timeMicro, err := strconv.Atoi(args[1])
-			if err != nil {
-				continue
-			}
-			timeSeconds := (timeMicro / 1000000)
-			if timeSeconds < 0 {
-				continue
-			}
-			wruntime.EventsEmit(a.ctx, video.EVT_ENCODING_PROGRESS, (timeSeconds*100)/int(total))
+	return len(p), nil
+}
+
+// logs: returns the lines written that are not progress reports (key=value)
+func (s *stderrTail) logs() string {
+	logs := []string{}
+	for _, line := range strings.Split(string(s.tail), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
 		}
-		if strings.Contains(line, video.OBV_OUT_TIME) && monitoringOpts.terms[video.OBV_OUT_TIME] {
-			args := strings.Split(line, "=")
-			if args[0] != video.OBV_OUT_TIME {
-				continue
-			}
-			duration, err := convertHMStoSeconds(args[1])
-			if err != nil {
-				// TODO: handle conversion error
-				continue
-			}
-			if duration < video.Epsilon {
-				continue
-			}
-			wruntime.EventsEmit(a.ctx, video.EVT_DURATION_EXTRACTED, duration)
+		if key, _, ok := strings.Cut(line, "="); ok && !strings.Contains(key, " ") {
+			continue
 		}
+		logs = append(logs, line)
 	}
+	return strings.Join(logs, "\n")
 }
 
-func convertHMStoSeconds(hms string) (float64, error) {
-	parts := strings.Split(hms, ".")
-	if len(parts) != 2 {
-		return 0.0, fmt.Errorf("could not parse decimal part")
-	}
-
-	timeParts := strings.Split(parts[0], ":")
-	if len(timeParts) != 3 {
-		return 0.0, fmt.Errorf("could not parse time part")
-	}
+// lastLine: returns the last line written that is not a progress report (key=value)
+func (s *stderrTail) lastLine() string {
+	logs := s.logs()
+	return logs[strings.LastIndex(logs, "\n")+1:]
+}
 
-	hours, err := strconv.Atoi(timeParts[0])
+// monitorFFmpegOuput: monitors the -progress output of a ffmpeg query
+func (a *App) monitorFFmpegOuput(FFmpegOut io.Reader, monitoringOpts *MonitoringOpts) {
+	a.notifier.LogInfo("monitoring FFmpeg query")
+	err := progress.Scan(FFmpegOut, func(report progress.Report) {
+		if monitoringOpts.terms[video.OBV_OUT_TIME_US] {
+			a.notifier.EventsEmit(video.EVT_ENCODING_PROGRESS, NewEncodingProgress(monitoringOpts, report))
+		}
+		if monitoringOpts.terms[video.OBV_OUT_TIME] && report.OutTime >= video.Epsilon {
+			a.notifier.EventsEmit(video.EVT_DURATION_EXTRACTED, report.OutTime)
+		}
+	})
 	if err != nil {
-		return 0.0, fmt.Errorf("could not convert hours to int")
+		a.notifier.LogError(fmt.Sprintf("could not monitor FFmpeg query: %s", err.Error()))
 	}
+}
 
-	minutes, err := strconv.Atoi(timeParts[1])
-	if err != nil {
-		return 0.0, fmt.Errorf("could not convert minutes to int")
+// NewEncodingProgress: the progress of the monitored job given a report of the pass being encoded
+func NewEncodingProgress(monitoringOpts *MonitoringOpts, report progress.Report) EncodingProgress {
+	estimate := progress.NewEstimate(report, monitoringOpts.duration)
+	pass, passes := monitoringOpts.pass, monitoringOpts.passes
+	// the progress of a pass is a share of the progress of all the passes, which are assumed as long
+	if estimate.Percent != progress.UNKNOWN {
+		estimate.Percent = (float64(pass-1)*100 + estimate.Percent) / float64(passes)
+	}
+	if estimate.ETA != progress.UNKNOWN && pass < passes {
+		if report.Speed > 0 {
+			estimate.ETA += float64(passes-pass) * monitoringOpts.duration / report.Speed
+		} else {
+			// the end of a pass reports no speed on short encodings, the time left of the next passes is unknown
+			estimate.ETA = progress.UNKNOWN
+		}
 	}
+	return EncodingProgress{JobID: monitoringOpts.jobID, Pass: pass, Passes: passes, Estimate: estimate, Report: report}
+}
 
-	seconds, err := strconv.Atoi(timeParts[2])
+// probeMedia: probes an input with ffprobe
+func (a *App) probeMedia(input string) (probe.MediaInfo, error) {
+	output, err := a.executor.Output(ffmpegbuilder.Command{Path: a.FFprobePath, Args: probe.Args(input)})
 	if err != nil {
-		return 0.0, fmt.Errorf("could not convert seconds to int")
+		return probe.MediaInfo{}, fmt.Errorf("could not probe %s: %s", filepath.Base(input), err.Error())
 	}
-
-	microseconds, err := strconv.Atoi(parts[1])
+	info, err := probe.Parse(output)
 	if err != nil {
-		return 0.0, fmt.Errorf("could not convert microseconds to int")
+		return probe.MediaInfo{}, fmt.Errorf("could not probe %s: %s", filepath.Base(input), err.Error())
 	}
-
-	totalSeconds := float64(hours*3600+minutes*60+seconds) + float64(microseconds)/1000000
-	return totalSeconds, nil
+	return info, nil
 }
 
-func getVideoDuration(FFmpegPath string, userOpts video.ProcessingOpts) (float64, error) {
-	query, err := ffmpegbuilder.CheckVideoDuration(FFmpegPath, userOpts)
+// readKeyframes: reads the timestamps of the keyframes of the first video stream of an input with ffprobe
+func (a *App) readKeyframes(input string) ([]float64, error) {
+	output, err := a.executor.Output(ffmpegbuilder.Command{Path: a.FFprobePath, Args: probe.KeyframeArgs(input)})
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("could not read the keyframes of %s: %s", filepath.Base(input), err.Error())
 	}
-	cmd := exec.Command("bash", "-c", query)
-
-	stderrPipe, err := cmd.StderrPipe()
+	keyframes, err := probe.ParseKeyframes(output)
 	if err != nil {
-		return 0, fmt.Errorf("could not initialize ffmpeg monitoring")
+		return nil, fmt.Errorf("could not read the keyframes of %s: %s", filepath.Base(input), err.Error())
 	}
+	return keyframes, nil
+}
 
-	scanner := bufio.NewScanner(stderrPipe)
+// probeTimelineInputs: probes the inputs of a timeline before an export, the inputs of the main and video tracks
+// must have a video stream and the intervals of the timeline must be within the duration of their media
+func (a *App) probeTimelineInputs(tl video.Timeline) (map[string]probe.MediaInfo, error) {
+	// the sources of the audio tracks only need an audio stream
+	videoInputs := ffmpegbuilder.ExtractInputs(tl.VideoNodes)
+	for _, track := range tl.VideoTracks {
+		videoInputs = append(videoInputs, ffmpegbuilder.ExtractInputs(track.Nodes)...)
+	}
 
-	err = cmd.Start()
-	if err != nil {
-		return 0, fmt.Errorf("could not initialize video duration extraction")
+	infos := map[string]probe.MediaInfo{}
+	for _, input := range ffmpegbuilder.ExtractTimelineInputs(tl) {
+		if _, ok := infos[input]; ok {
+			continue
+		}
+		info, err := a.probeMedia(input)
+		if err != nil {
+			return nil, err
+		}
+		if !info.HasVideo() && slices.Contains(videoInputs, input) {
+			return nil, fmt.Errorf("%s has no video stream", video.GetFilename(input))
+		}
+		infos[input] = info
 	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, video.OBV_DURATION) {
-			hms := strings.Split(strings.TrimSpace(strings.Split(line, ",")[0]), "Duration: ")[1]
-			duration, err := convertHMStoSeconds(hms)
-			if err != nil {
-				continue
-			}
-			return duration, nil
+	nodes := append([]video.VideoNode{}, tl.VideoNodes...)
+	for _, track := range tl.VideoTracks {
+		nodes = append(nodes, track.Nodes...)
+	}
+	for _, track := range tl.AudioTracks {
+		nodes = append(nodes, track.Nodes...)
+	}
+	for _, node := range nodes {
+		if duration := infos[node.RID].Duration(); duration > 0 && node.End > duration+probe.DURATION_TOLERANCE {
+			return nil, fmt.Errorf("%s ends at %.3fs, after the end of its media (%.3fs)", node.Name, node.End, duration)
 		}
+	}
+	return infos, nil
+}
 
+// getSilentInputs: returns the probed inputs that do not have an audio stream
+func getSilentInputs(infos map[string]probe.MediaInfo) []string {
+	silentInputs := []string{}
+	for input, info := range infos {
+		if !info.HasAudio() {
+			silentInputs = append(silentInputs, input)
+		}
 	}
+	slices.Sort(silentInputs)
+	return silentInputs
+}
 
-	err = cmd.Wait()
+// getFrameRate: retrieves the frame rate of the first video stream of an input
+func (a *App) getFrameRate(input string) (video.Rational, error) {
+	info, err := a.probeMedia(input)
 	if err != nil {
-		return 0, fmt.Errorf("could not extract duration of the video")
+		return video.Rational{}, err
 	}
-	return 0, nil
-
+	stream, ok := info.VideoStream()
+	if !ok || !stream.FrameRate.IsValid() {
+		return video.Rational{}, fmt.Errorf("could not find the frame rate of %s", video.GetFilename(input))
+	}
+	return stream.FrameRate, nil
 }
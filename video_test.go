@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/k1nho/gahara/internal/progress"
+	"github.com/k1nho/gahara/internal/video"
+)
+
+func TestImportFlow(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	input := "/media/holiday.mp4"
+	fake.on("ffprobe", input).withStdout(mockProbeOutput(12.5, true))
+	fake.on("ffmpeg", input).withProgress("out_time=00:00:06.250000", "speed=2.5x", "progress=continue", "out_time=00:00:12.500000", "progress=end")
+
+	app.createProxyFile(input)
+
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 1 || !slices.Contains(commands[0].Args, "copy") {
+		t.Fatalf("expected a single proxy query copying the streams, got %v", commands)
+	}
+	durations := notifier.eventsOf(video.EVT_DURATION_EXTRACTED)
+	if len(durations) != 2 || durations[1][0] != 12.5 {
+		t.Errorf("expected the durations of the progress, got %v", durations)
+	}
+	// the progress of the proxy is measured against the duration of its input
+	progress := notifier.eventsOf(video.EVT_ENCODING_PROGRESS)
+	if len(progress) != 2 {
+		t.Fatalf("expected the progress of the proxy, got %v", progress)
+	}
+	if first := progress[0][0].(EncodingProgress); first.JobID == "" || first.Percent != 50 || first.ETA != 2.5 {
+		t.Errorf("expected 50%% with 2.5s left, got %+v", first)
+	}
+	created := notifier.eventsOf(video.EVT_PROXY_FILE_CREATED)
+	if len(created) != 1 {
+		t.Fatalf("expected the proxy file to be created, got %v", notifier.events)
+	}
+	if proxy := created[0][0].(*Video); proxy.Name != "holiday" || proxy.Duration != 12.5 {
+		t.Errorf("unexpected proxy file %+v", proxy)
+	}
+
+	// the proxy written by the first import is found
+	app.createProxyFile(input)
+	if len(fake.commands("ffmpeg")) != 1 {
+		t.Errorf("expected the proxy not to be created twice")
+	}
+	if errors := notifier.eventsOf(video.EVT_PROXY_ERROR_MSG); len(errors) != 1 || !strings.Contains(errors[0][0].(string), "already in project") {
+		t.Errorf("expected the file to be reported as imported, got %v", errors)
+	}
+}
+
+func TestImportInvalidFile(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	fake.on("ffprobe", "/media/notes.mp4").withExitCode(1)
+
+	app.createProxyFile("/media/notes.mp4")
+	if len(fake.commands("ffmpeg")) != 0 {
+		t.Errorf("expected no proxy query for an invalid file")
+	}
+	if errors := notifier.eventsOf(video.EVT_PROXY_ERROR_MSG); len(errors) != 1 || !strings.Contains(errors[0][0].(string), "not a valid video file") {
+		t.Errorf("expected the file to be rejected, got %v", errors)
+	}
+}
+
+// mockEditedTimeline: inserts 10s of two sources in the main track of the app
+func mockEditedTimeline(t *testing.T, app *App, fake *fakeFFmpeg) []string {
+	t.Helper()
+	sources := []string{filepath.Join(app.config.ProjectDir, "intro.mov"), filepath.Join(app.config.ProjectDir, "talk.mov")}
+	fake.on("ffprobe", sources[0]).withStdout(mockProbeOutput(8, true))
+	fake.on("ffprobe", sources[1]).withStdout(mockProbeOutput(60, false))
+
+	if _, err := app.InsertInterval(sources[0], "intro", 0, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.InsertInterval(sources[1], "talk", 10, 16, 1); err != nil {
+		t.Fatal(err)
+	}
+	return sources
+}
+
+func TestLoadLegacyTimeline(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	source := filepath.Join(app.config.ProjectDir, "intro.mov")
+	legacy := `{"video_nodes": [{"id": "1", "rid": "` + filepath.ToSlash(source) + `", "name": "intro", "start": 1, "end": 3}]}`
+	if err := os.WriteFile(filepath.Join(app.config.ProjectDir, "timeline.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the source is probed while the timeline can still be read
+	locked := false
+	fake.on("ffprobe", filepath.ToSlash(source)).withStdout(mockProbeOutput(8, true)).onExit(func() {
+		if app.timelineLock.TryLock() {
+			app.timelineLock.Unlock()
+		} else {
+			locked = true
+		}
+	})
+	timeline, err := app.LoadTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		t.Errorf("expected the frame rate to be probed without the timeline lock")
+	}
+	if len(fake.commands("ffprobe")) != 1 {
+		t.Fatalf("expected the source to be probed, got %v", fake.commands("ffprobe"))
+	}
+	if intro := timeline.VideoNodes[0]; intro.StartFrame != 30 || intro.EndFrame != 90 || timeline.FrameRate(intro.RID) != (video.Rational{Num: 30, Den: 1}) {
+		t.Errorf("expected the node to be conformed to 30 fps, got %+v", intro)
+	}
+}
+
+func TestTrimUnknownDuration(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	fake.on("ffprobe", sources[0]).withExitCode(1)
+	edited := slices.Clone(app.Timeline.VideoNodes)
+
+	// the source of intro cannot be probed, its out point could be moved past the end of the media
+	if _, err := app.RippleTrim(0, video.TRIM_OUT, 10); err == nil || !strings.Contains(err.Error(), "duration") {
+		t.Errorf("expected the trim to fail, got %v", err)
+	}
+	if _, err := app.RollTrim(0, 10); err == nil {
+		t.Errorf("expected the roll to fail")
+	}
+	if !slices.Equal(app.Timeline.VideoNodes, edited) {
+		t.Errorf("expected the timeline to be unchanged, got %+v", app.Timeline.VideoNodes)
+	}
+
+	// talk is probed, it is trimmed within its 60s
+	if _, err := app.RippleTrim(1, video.TRIM_OUT, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.RippleTrim(1, video.TRIM_OUT, 60); err == nil {
+		t.Errorf("expected a trim past the end of talk to fail")
+	}
+}
+
+// encodingProgress: returns the percents emitted during an export
+func encodingProgress(notifier *fakeNotifier) []float64 {
+	percents := []float64{}
+	for _, event := range notifier.eventsOf(video.EVT_ENCODING_PROGRESS) {
+		percents = append(percents, event[0].(EncodingProgress).Percent)
+	}
+	return percents
+}
+
+func TestExportFlow(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=2500000", "progress=continue", "out_time_us=5000000", "progress=continue", "out_time_us=10000000", "progress=end")
+
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 1 || commands[0].Args[len(commands[0].Args)-1] != filepath.Join(app.config.ProjectDir, "export.mp4") {
+		t.Fatalf("expected a single export query, got %v", commands)
+	}
+	// talk.mov has no audio, a silent source is generated for it
+	if !strings.Contains(commands[0].String(), "anullsrc") {
+		t.Errorf("expected a silent audio source, got %s", commands[0].String())
+	}
+
+	progress := encodingProgress(notifier)
+	if !slices.Equal(progress, []float64{25, 50, 100}) {
+		t.Errorf("expected the progress 25, 50, 100, got %v", progress)
+	}
+	results := notifier.eventsOf(video.EVT_FFMPEG_RESULT)
+	if len(results) != 1 || results[0][0].(*VideoProcessingResult).Status != Success {
+		t.Errorf("expected a successful export, got %v", results)
+	}
+	if len(notifier.eventsOf(video.EVT_FFMPEG_EXEC_ENDED)) != 1 {
+		t.Errorf("expected the end of the query to be signaled")
+	}
+}
+
+func TestExportChapters(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	if _, err := app.AddMarker("Talk", "", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := mockExportOpts(app)
+	opts.Chapters = true
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// every export writes its own chapters file to the project directory, and removes it
+	commands := fake.commands("ffmpeg")
+	if len(commands) != 1 {
+		t.Fatalf("expected a single export query, got %v", commands)
+	}
+	chapters := commands[0].Args[slices.Index(commands[0].Args, "-filter_complex")-1]
+	if filepath.Dir(chapters) != app.config.ProjectDir || !strings.HasPrefix(filepath.Base(chapters), ".chapters-") {
+		t.Errorf("expected a chapters file in the project directory, got %s", chapters)
+	}
+	if _, err := os.Stat(chapters); !os.IsNotExist(err) {
+		t.Errorf("expected the chapters file to be removed")
+	}
+}
+
+func TestExportAudioTrack(t *testing.T) {
+	app, fake, _ := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	music := filepath.Join(app.config.ProjectDir, "music.wav")
+	fake.on("ffprobe", music).withStdout(`{"streams": [{"index": 0, "codec_type": "audio", "codec_name": "pcm_s16le", "sample_rate": "48000", "channels": 2, "duration": "30.000000"}], "format": {"filename": "music.wav", "format_name": "wav", "duration": "30.000000"}}`)
+	track, err := app.AddTrack(video.TRACK_AUDIO, "music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.InsertTrackInterval(track.ID, music, "music", 0, 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the source of an audio track has no video stream
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)); err != nil {
+		t.Fatal(err)
+	}
+	if commands := fake.commands("ffmpeg"); len(commands) != 1 || !slices.Contains(commands[0].Args, music) {
+		t.Errorf("expected the music to be an input of the export, got %v", commands)
+	}
+
+	// a video track needs a video stream
+	broll, err := app.AddTrack(video.TRACK_VIDEO, "b-roll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.InsertTrackInterval(broll.ID, music, "music", 0, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app)); err == nil || !strings.Contains(err.Error(), "no video stream") {
+		t.Errorf("expected the export to fail, got %v", err)
+	}
+}
+
+func TestExportTwoPass(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=5000000", "progress=continue", "out_time_us=10000000", "progress=end")
+
+	opts := mockExportOpts(app)
+	opts.CRF, opts.RateControl, opts.VideoBitrate, opts.TwoPass = "", video.RATE_CONTROL_BITRATE, "4M", true
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands := fake.commands("ffmpeg"); len(commands) != 2 {
+		t.Fatalf("expected two passes, got %d", len(commands))
+	}
+	progress := encodingProgress(notifier)
+	if !slices.Equal(progress, []float64{25, 50, 75, 100}) {
+		t.Errorf("expected the progress to span both passes, got %v", progress)
+	}
+}
+
+func TestExportFailure(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+	fake.on("ffmpeg", "-filter_complex").withProgress("out_time_us=2500000").
+		withStderr("Error initializing output stream 0:0 -- Error while opening encoder").withExitCode(1)
+
+	err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, mockExportOpts(app))
+	if err == nil || !strings.Contains(err.Error(), "Error while opening encoder") {
+		t.Fatalf("expected the error of ffmpeg, got %v", err)
+	}
+	if len(notifier.eventsOf(video.EVT_FFMPEG_RESULT)) != 0 {
+		t.Errorf("expected no export result")
+	}
+	if len(notifier.eventsOf(video.EVT_FFMPEG_EXEC_ENDED)) != 1 {
+		t.Errorf("expected the end of the query to be signaled")
+	}
+}
+
+func TestExportValidation(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	mockEditedTimeline(t, app, fake)
+
+	opts := mockExportOpts(app)
+	opts.Filename, opts.Preset = "", ""
+	if err := app.FFmpegQuery(video.QUERY_FILTERGRAPH, opts); err == nil {
+		t.Fatal("expected the options to be invalid")
+	}
+	if len(fake.commands("ffmpeg")) != 0 {
+		t.Errorf("expected no query to be executed")
+	}
+	violations := notifier.eventsOf(video.EVT_VALIDATION_FAILED)
+	if len(violations) != 1 || len(violations[0][0].([]video.FieldViolation)) != 1 {
+		t.Errorf("expected the violations of the options, got %v", violations)
+	}
+}
+
+func TestLosslessCut(t *testing.T) {
+	app, fake, notifier := newTestApp(t)
+	sources := mockEditedTimeline(t, app, fake)
+	if err := app.MarkAllLossless(); err != nil {
+		t.Fatal(err)
+	}
+	fake.on("ffmpeg", sources[1]).withStderr("talk.mov: Invalid data found when processing input").withExitCode(1)
+
+	if err := app.FFmpegQuery(video.QUERY_LOSSLESS_CUT, video.ProcessingOpts{VideoFormat: ".mov", OutputPath: app.config.ProjectDir, Filename: "cut"}); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]string{}
+	for _, event := range notifier.eventsOf(video.EVT_FFMPEG_RESULT) {
+		result := event[0].(VideoProcessingResult)
+		statuses[result.Name] = result.Status
+	}
+	if statuses["intro"] != Success || statuses["talk"] != Failed {
+		t.Errorf("expected intro to be cut and talk to fail, got %v", statuses)
+	}
+}
+
+func TestEncodingProgress(t *testing.T) {
+	report := progress.Report{OutTime: 5, Speed: 2}
+	// ffmpeg reports speed=N/A at the end of short encodings
+	end := progress.Report{OutTime: 10, End: true}
+	tests := []struct {
+		name    string
+		opts    *MonitoringOpts
+		report  progress.Report
+		percent float64
+		eta     float64
+	}{
+		{name: "single pass", opts: NewMonitoringOpts().forJob("job", 10), report: report, percent: 50, eta: 2.5},
+		{name: "first of two passes", opts: NewMonitoringOpts().forJob("job", 10).withPass(1, 2), report: report, percent: 25, eta: 7.5},
+		{name: "second of two passes", opts: NewMonitoringOpts().forJob("job", 10).withPass(2, 2), report: report, percent: 75, eta: 2.5},
+		{name: "unknown duration", opts: NewMonitoringOpts().forJob("job", 0), report: report, percent: progress.UNKNOWN, eta: progress.UNKNOWN},
+		{name: "end of a single pass without speed", opts: NewMonitoringOpts().forJob("job", 10), report: end, percent: 100, eta: 0},
+		{name: "end of the first pass without speed", opts: NewMonitoringOpts().forJob("job", 10).withPass(1, 2), report: end, percent: 50, eta: progress.UNKNOWN},
+		{name: "end of the last pass without speed", opts: NewMonitoringOpts().forJob("job", 10).withPass(2, 2), report: end, percent: 100, eta: 0},
+	}
+
+	for _, tt := range tests {
+		got := NewEncodingProgress(tt.opts, tt.report)
+		if got.Percent != tt.percent || got.ETA != tt.eta || got.JobID != "job" {
+			t.Errorf("%s: expected %.2f%% with %.2fs left, got %+v", tt.name, tt.percent, tt.eta, got)
+		}
+		// the progress is sent to the frontend as json
+		if _, err := json.Marshal(got); err != nil {
+			t.Errorf("%s: %s", tt.name, err.Error())
+		}
+		if line := formatProgress(got); strings.Contains(line, "NaN") || strings.Contains(line, "Inf") {
+			t.Errorf("%s: unexpected progress line %q", tt.name, line)
+		}
+	}
+}